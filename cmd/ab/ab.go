@@ -0,0 +1,248 @@
+package ab
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/d7561985/mongo-ab/pkg/ab"
+	"github.com/d7561985/mongo-ab/pkg/results"
+	"github.com/d7561985/mongo-ab/pkg/store"
+	"github.com/d7561985/mongo-ab/pkg/worker"
+	"github.com/d7561985/mongo-ab/pkg/workload"
+	"github.com/pkg/errors"
+	"github.com/urfave/cli/v2"
+)
+
+const defDuration = time.Minute
+
+const (
+	fParallel = "parallel"
+	fDuration = "duration"
+	fSeed     = "seed"
+	fTeardown = "teardown"
+)
+
+const (
+	EnvParallel = "AB_PARALLEL"
+	EnvDuration = "AB_DURATION"
+	EnvSeed     = "SEED"
+	EnvTeardown = "AB_TEARDOWN"
+)
+
+type abCommand struct {
+	// command builds benchmark command of backend, every configuration runs its own one
+	command func(store.Backend) *cli.Command
+}
+
+// New returns ab command which runs configurations with commands built by command, e.g. bench.New
+func New(command func(store.Backend) *cli.Command) *cli.Command {
+	c := &abCommand{command: command}
+
+	return &cli.Command{
+		Name:        "ab",
+		Usage:       "Compare backends or their configurations under the same workload",
+		ArgsUsage:   "-- <backend> [flags] -- <backend> [flags] ..., e.g. -- mongo --compression snappy -- mongo --compression zstd",
+		Description: "ab runs every configuration with the same seed and duration, one after another or in parallel, and prints throughput, latency, error rate and storage size with deltas to the first one",
+		Flags: []cli.Flag{
+			&cli.BoolFlag{Name: fParallel, Usage: "Run configurations at the same time, every one with its own connection pool and threads", EnvVars: []string{EnvParallel}},
+			&cli.DurationFlag{Name: fDuration, Value: defDuration, Usage: "Duration of every configuration, 0 - until its profile ends", EnvVars: []string{EnvDuration}},
+			&cli.Int64Flag{Name: fSeed, Value: 0, Usage: "Seed of workload stream of all configurations, which don't set their own, 0 - random", EnvVars: []string{EnvSeed}},
+			&cli.BoolFlag{Name: fTeardown, Usage: "Drop data of every configuration after its storage size is measured, so the next one could use the same database", EnvVars: []string{EnvTeardown}},
+		},
+		Action: c.Action,
+	}
+}
+
+func (m *abCommand) Action(c *cli.Context) error {
+	configs := ab.Split(c.Args().Slice())
+	if len(configs) < 2 {
+		return errors.New("at least two configurations are required, e.g. ab -- mongo --compression snappy -- mongo --compression zstd")
+	}
+
+	for _, args := range configs {
+		if _, err := store.Get(args[0]); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	if err := m.shared(c, configs); err != nil {
+		return err
+	}
+
+	seed := workload.Seed(c.Int64(fSeed))
+	fmt.Println("seed:", seed)
+
+	runs := make([]ab.Run, len(configs))
+	for i, args := range configs {
+		runs[i] = ab.Run{Args: ab.WithSeed(args, seed), Storage: -1}
+	}
+
+	if c.Bool(fParallel) {
+		wg := sync.WaitGroup{}
+		for i := range runs {
+			wg.Add(1)
+			go func(r *ab.Run) {
+				defer wg.Done()
+				m.run(c, r)
+			}(&runs[i])
+		}
+
+		wg.Wait()
+
+		for i := range runs {
+			m.measure(c, &runs[i])
+		}
+	} else {
+		for i := range runs {
+			if c.Context.Err() != nil {
+				break
+			}
+
+			m.run(c, &runs[i])
+			m.measure(c, &runs[i])
+		}
+	}
+
+	for i := range runs {
+		for j, a := range runs[i].Args {
+			runs[i].Args[j] = results.Mask(a)
+		}
+	}
+
+	fmt.Println(ab.Table(runs))
+
+	for i, r := range runs {
+		if r.Err != nil {
+			return errors.Errorf("configuration #%d: %v", i+1, r.Err)
+		}
+	}
+
+	return nil
+}
+
+// run is ordinary command of configuration, its summary is collected by sink
+func (m *abCommand) run(c *cli.Context, r *ab.Run) {
+	ctx := c.Context
+	if d := c.Duration(fDuration); d > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d)
+
+		defer cancel()
+	}
+
+	fmt.Println("==== run:", results.Mask(strings.Join(r.Args, " ")))
+
+	b, err := store.Get(r.Args[0])
+	if err != nil {
+		r.Err = errors.WithStack(err)
+		return
+	}
+
+	// own app and command: cli appends help flag to command on every run, parallel runs can't share it
+	app := &cli.App{Name: c.App.Name, Commands: []*cli.Command{m.command(b)}}
+
+	sink := &worker.Collector{}
+	if err = app.RunContext(worker.ContextWithSink(ctx, sink), append([]string{app.Name}, r.Args...)); err != nil {
+		r.Err = err
+	}
+
+	r.Summary = sink.Merged()
+}
+
+// measure sets storage size of configuration and drops its data if requested
+func (m *abCommand) measure(c *cli.Context, r *ab.Run) {
+	db, err := m.open(c, r.Args)
+	if err != nil {
+		if r.Err == nil {
+			r.Err = err
+		}
+
+		return
+	}
+
+	defer db.Close(context.Background())
+
+	if s, ok := db.(store.Sizer); ok {
+		if size, err := s.Size(c.Context); err == nil {
+			r.Storage = size
+		}
+	}
+
+	if c.Bool(fTeardown) {
+		if err = db.Teardown(c.Context); err != nil && r.Err == nil {
+			r.Err = err
+		}
+	}
+}
+
+// shared refuses configurations which write the same data: every one of them would start on data of the previous
+// one or, in parallel, write it at the same time, and storage of both would be measured together.
+// Sequential runs could share it with teardown, which drops data of configuration before the next one starts.
+func (m *abCommand) shared(c *cli.Context, configs [][]string) error {
+	if !c.Bool(fParallel) && c.Bool(fTeardown) {
+		return nil
+	}
+
+	targets := map[string]int{}
+
+	for i, args := range configs {
+		b, ctx, err := m.parse(c, args)
+		if err != nil {
+			return errors.Wrapf(err, "configuration #%d", i+1)
+		}
+
+		if b.Target == nil {
+			continue
+		}
+
+		t := b.Target(ctx)
+		if j, ok := targets[b.Name+" "+t]; ok {
+			return errors.Errorf("configurations #%d and #%d write the same %s data %s: give them own database, "+
+				"collections or schema, or run them one after another with --%s", j+1, i+1, b.Name, results.Mask(t), fTeardown)
+		}
+
+		targets[b.Name+" "+t] = i
+	}
+
+	return nil
+}
+
+// open connects to backend of configuration with its flags
+func (m *abCommand) open(c *cli.Context, args []string) (store.Store, error) {
+	b, ctx, err := m.parse(c, args)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := b.Open(ctx)
+
+	return db, errors.WithStack(err)
+}
+
+// parse returns backend of configuration and context of its flags
+func (m *abCommand) parse(c *cli.Context, args []string) (store.Backend, *cli.Context, error) {
+	b, err := store.Get(args[0])
+	if err != nil {
+		return store.Backend{}, nil, errors.WithStack(err)
+	}
+
+	set := flag.NewFlagSet(args[0], flag.ContinueOnError)
+	set.SetOutput(io.Discard)
+
+	for _, f := range m.command(b).Flags {
+		if err = f.Apply(set); err != nil {
+			return store.Backend{}, nil, errors.WithStack(err)
+		}
+	}
+
+	if err = set.Parse(args[1:]); err != nil {
+		return store.Backend{}, nil, errors.WithStack(err)
+	}
+
+	return b, cli.NewContext(c.App, set, c), nil
+}
@@ -0,0 +1,73 @@
+package ab
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/d7561985/mongo-ab/cmd/bench"
+	"github.com/d7561985/mongo-ab/pkg/store"
+	"github.com/d7561985/mongo-ab/pkg/store/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v2"
+)
+
+func TestParallel(t *testing.T) {
+	var (
+		mu   sync.Mutex
+		runs = map[*cli.Command]bool{}
+	)
+
+	command := func(b store.Backend) *cli.Command {
+		cmd := bench.New(b)
+		action := cmd.Action
+
+		cmd.Action = func(c *cli.Context) error {
+			mu.Lock()
+			runs[c.Command] = true
+			mu.Unlock()
+
+			return action(c)
+		}
+
+		return cmd
+	}
+
+	app := &cli.App{Name: "ab", Commands: []*cli.Command{New(command)}}
+
+	args := []string{"ab", "ab", "--parallel", "--duration", "200ms", "--seed", "1",
+		"--", "memory", "--threads", "2",
+		"--", "memory", "--threads", "2", "--idempotent",
+		"--", "memory", "--threads", "2", "--operation", "insert",
+	}
+
+	require.NoError(t, app.RunContext(context.Background(), args))
+
+	// cli appends help flag to command it runs, so configurations don't share one
+	assert.Len(t, runs, 3)
+}
+
+func TestShared(t *testing.T) {
+	store.Register(store.Backend{
+		Name:   "shared",
+		Flags:  []cli.Flag{&cli.StringFlag{Name: "db", Value: "db"}},
+		Open:   func(*cli.Context) (store.Store, error) { return memory.New(), nil },
+		Target: func(c *cli.Context) string { return c.String("db") },
+	})
+
+	run := func(flags ...string) error {
+		app := &cli.App{Name: "ab", Commands: []*cli.Command{New(bench.New)}}
+		args := append([]string{"ab", "ab", "--duration", "50ms", "--seed", "1"}, flags...)
+
+		return app.RunContext(context.Background(), append(args, "--", "shared", "--", "shared", "--db", "other", "--", "shared"))
+	}
+
+	err := run("--parallel")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "configurations #1 and #3 write the same shared data db")
+
+	assert.Error(t, run("--parallel", "--teardown"))
+	assert.Error(t, run())
+	assert.NoError(t, run("--teardown"))
+}
@@ -0,0 +1,66 @@
+package agent
+
+import (
+	"context"
+	"net"
+	"os"
+
+	"github.com/d7561985/mongo-ab/pkg/cluster"
+	"github.com/pkg/errors"
+	"github.com/urfave/cli/v2"
+)
+
+const (
+	fListen = "listen"
+	fName   = "name"
+)
+
+const (
+	EnvListen = "AGENT_LISTEN"
+	EnvName   = "AGENT_NAME"
+)
+
+const defListen = ":7070"
+
+type agentCommand struct{}
+
+func New() *cli.Command {
+	c := new(agentCommand)
+
+	return &cli.Command{
+		Name:        "agent",
+		Usage:       "Run workloads sent by coordinator",
+		Description: "agent waits for coordinator, runs received command line (e.g. mongo --threads 50) locally and reports its histograms and counters",
+		Flags: []cli.Flag{
+			&cli.StringFlag{Name: fListen, Value: defListen, Usage: "TCP address coordinator connects to", EnvVars: []string{EnvListen}},
+			&cli.StringFlag{Name: fName, Usage: "Agent name in reports (default: hostname)", EnvVars: []string{EnvName}},
+		},
+		Action: c.Action,
+	}
+}
+
+func (a *agentCommand) Action(c *cli.Context) error {
+	name := c.String(fName)
+	if name == "" {
+		name, _ = os.Hostname()
+	}
+
+	l, err := net.Listen("tcp", c.String(fListen))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	agent := cluster.NewAgent(name, func(ctx context.Context, args []string) error {
+		if len(args) == 0 {
+			return errors.New("empty workload")
+		}
+
+		if cmd := c.App.Command(args[0]); cmd == nil || cmd.Name == "agent" || cmd.Name == "coordinator" {
+			return errors.Errorf("unsupported workload command %q", args[0])
+		}
+
+		return c.App.RunContext(ctx, append([]string{c.App.Name}, args...))
+	})
+
+	return errors.WithStack(agent.Serve(c.Context, l))
+}
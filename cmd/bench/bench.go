@@ -0,0 +1,523 @@
+package bench
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/d7561985/mongo-ab/pkg/changing"
+	"github.com/d7561985/mongo-ab/pkg/fault"
+	"github.com/d7561985/mongo-ab/pkg/history"
+	"github.com/d7561985/mongo-ab/pkg/keys"
+	"github.com/d7561985/mongo-ab/pkg/metrics"
+	"github.com/d7561985/mongo-ab/pkg/results"
+	"github.com/d7561985/mongo-ab/pkg/store"
+	"github.com/d7561985/mongo-ab/pkg/trace"
+	"github.com/d7561985/mongo-ab/pkg/worker"
+	"github.com/d7561985/mongo-ab/pkg/workload"
+	"github.com/pkg/errors"
+	"github.com/urfave/cli/v2"
+)
+
+const (
+	Transaction = "tx"
+	Insert      = "insert"
+	// Balance reads balance of account
+	Balance = "balance"
+	// Journal reads the latest page of journal of account
+	Journal = "journal"
+	// Revert reverts the latest revertible record of the latest page of journal of account
+	Revert = "revert"
+)
+
+// kinds of operations which workload could mix, the first one is default
+var kinds = []string{Transaction, Insert, Balance, Journal, Revert}
+
+// Duplicate is operation name of redelivered transaction
+const Duplicate = "duplicate"
+
+const defMaxUserID = 100_000
+const defThreads = 100
+const defMaxErrorRate = 0.05
+const defTrial = 30 * time.Second
+const defSloP99 = 100 * time.Millisecond
+const defSloErrorRate = 0.01
+
+// DefJournalLimit is page size of journal operation
+const DefJournalLimit = 20
+
+const (
+	fOpt     = "operation"
+	fThreads = "threads"
+	fMaxUser = "maxUser"
+	fRate    = "rate"
+	fArrival = "arrival"
+	fProfile = "profile"
+
+	fMaxErrors    = "max-errors"
+	fMaxErrorRate = "max-error-rate"
+	fWarmup       = "warmup"
+	fWarmupOps    = "warmup-ops"
+
+	fResultsOut    = "results-out"
+	fResultsFormat = "results-format"
+	fMetricsAddr   = "metrics-addr"
+
+	fFindCapacity = "find-capacity"
+	fCapacityStep = "capacity-step"
+	fTrial        = "trial"
+	fSloP99       = "slo-p99"
+	fSloErrorRate = "slo-error-rate"
+
+	fKeyDist   = "key-dist"
+	fSeed      = "seed"
+	fWorkload  = "workload"
+	fGenerator = "generator"
+	fTraceOut  = "trace-out"
+
+	fHistoryOut = "history-out"
+	fFault      = "fault"
+
+	fDuplicateRate = "duplicate-rate"
+
+	fMix           = "mix"
+	fJournalLimit  = "journal-limit"
+	fJournalWindow = "journal-window"
+)
+
+const (
+	EnvThreads   = "THREADS"
+	EnvMaxUser   = "MAX_USER"
+	EnvOperation = "OPERATION"
+	EnvRate      = "RATE"
+	EnvArrival   = "ARRIVAL"
+	EnvProfile   = "PROFILE"
+
+	EnvMaxErrors    = "MAX_ERRORS"
+	EnvMaxErrorRate = "MAX_ERROR_RATE"
+	EnvWarmup       = "WARMUP"
+	EnvWarmupOps    = "WARMUP_OPS"
+
+	EnvResultsOut    = "RESULTS_OUT"
+	EnvResultsFormat = "RESULTS_FORMAT"
+	EnvMetricsAddr   = "METRICS_ADDR"
+
+	EnvFindCapacity = "FIND_CAPACITY"
+	EnvCapacityStep = "CAPACITY_STEP"
+	EnvTrial        = "TRIAL"
+	EnvSloP99       = "SLO_P99"
+	EnvSloErrorRate = "SLO_ERROR_RATE"
+
+	EnvKeyDist   = "KEY_DIST"
+	EnvSeed      = "SEED"
+	EnvWorkload  = "WORKLOAD"
+	EnvGenerator = "GENERATOR"
+	EnvTraceOut  = "TRACE_OUT"
+
+	EnvHistoryOut = "HISTORY_OUT"
+	EnvFault      = "FAULT"
+
+	EnvDuplicateRate = "DUPLICATE_RATE"
+
+	EnvMix           = "MIX"
+	EnvJournalLimit  = "JOURNAL_LIMIT"
+	EnvJournalWindow = "JOURNAL_WINDOW"
+)
+
+type benchCommand struct {
+	backend store.Backend
+}
+
+// New is command of registered backend, it is named after backend
+func New(b store.Backend) *cli.Command {
+	c := &benchCommand{backend: b}
+
+	cmd := &cli.Command{
+		Name:        b.Name,
+		Description: fmt.Sprintf("run %s compliance test which runs transactions", b.Name),
+		Flags: append([]cli.Flag{
+			&cli.IntFlag{Name: fThreads, Value: defThreads, Aliases: []string{"t"}, EnvVars: []string{EnvThreads}},
+			&cli.IntFlag{Name: fMaxUser, Value: defMaxUserID, Aliases: []string{"m"}, EnvVars: []string{EnvMaxUser}},
+			&cli.StringFlag{Name: fOpt, Value: Transaction, Usage: "What test start: tx - transaction intense, insert - only insert, balance - balance reads, journal - journal page reads, revert - reverts of transactions", Aliases: []string{"o"}, EnvVars: []string{EnvOperation}},
+			&cli.Float64Flag{Name: fRate, Value: 0, Usage: "Open-loop target rate op/sec for all threads, 0 - closed-loop", EnvVars: []string{EnvRate}},
+			&cli.StringFlag{Name: fArrival, Value: string(worker.Fixed), Usage: "Open-loop arrivals: fixed, poisson", EnvVars: []string{EnvArrival}},
+			&cli.StringFlag{Name: fProfile, Usage: "Load profile stages, e.g. ramp:1m:10-200,soak:10m:200,spike:30s:500,step:5m:100-500x5", EnvVars: []string{EnvProfile}},
+			&cli.Uint64Flag{Name: fMaxErrors, Value: 0, Usage: "Error budget: abort after this number of failed operations, 0 - unlimited", EnvVars: []string{EnvMaxErrors}},
+			&cli.Float64Flag{Name: fMaxErrorRate, Value: defMaxErrorRate, Usage: "Error budget: abort when share of failed operations exceeds it, 0 - unlimited", EnvVars: []string{EnvMaxErrorRate}},
+			&cli.DurationFlag{Name: fWarmup, Value: 0, Usage: "Warm-up duration excluded from statistics", EnvVars: []string{EnvWarmup}},
+			&cli.Uint64Flag{Name: fWarmupOps, Value: 0, Usage: "Warm-up operations excluded from statistics, warm-up ends with whichever limit comes first", EnvVars: []string{EnvWarmupOps}},
+			&cli.StringFlag{Name: fResultsOut, Usage: "File for per-interval results and summary with effective configuration", EnvVars: []string{EnvResultsOut}},
+			&cli.StringFlag{Name: fResultsFormat, Usage: "Results format: json, csv (default: by file extension, json)", EnvVars: []string{EnvResultsFormat}},
+			&cli.StringFlag{Name: fMetricsAddr, Usage: "Address of HTTP listener with Prometheus metrics on /metrics, e.g. :9100 (default: disabled)", EnvVars: []string{EnvMetricsAddr}},
+			&cli.StringFlag{Name: fFindCapacity, Usage: "Search max throughput under SLO in load range: 10-500 threads or 1000-50000/s rate", EnvVars: []string{EnvFindCapacity}},
+			&cli.Float64Flag{Name: fCapacityStep, Value: 0, Usage: "Capacity search raises load by this step, 0 - binary search", EnvVars: []string{EnvCapacityStep}},
+			&cli.DurationFlag{Name: fTrial, Value: defTrial, Usage: "Duration of every capacity trial, warm-up precedes each trial", EnvVars: []string{EnvTrial}},
+			&cli.DurationFlag{Name: fSloP99, Value: defSloP99, Usage: "Capacity SLO: p99 latency, 0 - not checked", EnvVars: []string{EnvSloP99}},
+			&cli.Float64Flag{Name: fSloErrorRate, Value: defSloErrorRate, Usage: "Capacity SLO: share of failed operations, 0 - not checked", EnvVars: []string{EnvSloErrorRate}},
+			&cli.StringFlag{Name: fKeyDist, Value: keys.Uniform, Usage: "Account access distribution: uniform, zipfian[:theta], hotspot[:ops%:keys%], latest[:theta], sequential", EnvVars: []string{EnvKeyDist}},
+			&cli.Int64Flag{Name: fSeed, Value: 0, Usage: "Seed of workload stream, the same seed gives every thread the same operations, 0 - random", EnvVars: []string{EnvSeed}},
+			&cli.StringFlag{Name: fWorkload, Usage: "YAML or JSON file with weighted operations, amounts and account distribution, replaces operation", EnvVars: []string{EnvWorkload}},
+			&cli.StringFlag{Name: fGenerator, Value: workload.Fuzz, Usage: "Transactions: fuzz - random fields with operation amount, requests - valid deposits, bets, withdrawals and wins built by ChangeRequest rules", EnvVars: []string{EnvGenerator}},
+			&cli.StringFlag{Name: fTraceOut, Usage: "Record every operation with its start time to trace file, JSON lines, .gz - compressed", EnvVars: []string{EnvTraceOut}},
+			&cli.StringFlag{Name: fHistoryOut, Usage: "Record invoke and complete time, thread and returned balance of every operation for history check, JSON lines, .gz - compressed", EnvVars: []string{EnvHistoryOut}},
+			&cli.StringFlag{Name: fFault, Usage: "Faults injected into transactions point:kind:probability[:latency], kinds: latency, error, abort, panic, e.g. update.after-upsert:latency:0.1:20ms,update.before-commit:abort:0.01", EnvVars: []string{EnvFault}},
+			&cli.Float64Flag{Name: fDuplicateRate, Value: 0, Usage: "Share of operations which redeliver the previous transaction of thread, see idempotent flag of store", EnvVars: []string{EnvDuplicateRate}},
+			&cli.StringFlag{Name: fMix, Usage: "Weights of operation kinds instead of operation flag, e.g. tx:80,balance:15,journal:5; kinds: tx, insert, balance, journal, revert", EnvVars: []string{EnvMix}},
+			&cli.IntFlag{Name: fJournalLimit, Value: DefJournalLimit, Usage: "Records per page of journal operation", EnvVars: []string{EnvJournalLimit}},
+			&cli.DurationFlag{Name: fJournalWindow, Value: 0, Usage: "Journal operation reads records of this last period only, 0 - whole journal", EnvVars: []string{EnvJournalWindow}},
+		}, b.Flags...),
+		Action: c.Action,
+	}
+
+	return cmd
+}
+
+func getWorkerCfg(c *cli.Context) (*worker.Config, error) {
+	cfg := &worker.Config{
+		Threads: c.Int(fThreads),
+		Rate:    c.Float64(fRate),
+		Arrival: worker.Arrival(c.String(fArrival)),
+		Budget: worker.ErrorBudget{
+			MaxErrors: c.Uint64(fMaxErrors),
+			MaxRate:   c.Float64(fMaxErrorRate),
+		},
+		Warmup:    c.Duration(fWarmup),
+		WarmupOps: c.Uint64(fWarmupOps),
+		Operation: c.String(fOpt),
+	}
+
+	if err := cfg.Arrival.Validate(); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	if err := cfg.Budget.Validate(); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	if p := c.String(fProfile); p != "" {
+		profile, err := worker.ParseProfile(p)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		cfg.Profile = profile
+	}
+
+	if out := c.String(fResultsOut); out != "" {
+		sink, err := results.Open(out, c.String(fResultsFormat), results.Config(c))
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		cfg.Sinks = append(cfg.Sinks, sink)
+	}
+
+	return cfg, nil
+}
+
+// getSearch returns nil when capacity search is not requested
+func getSearch(c *cli.Context) (*worker.Search, error) {
+	in := c.String(fFindCapacity)
+	if in == "" {
+		return nil, nil
+	}
+
+	if c.String(fProfile) != "" {
+		return nil, errors.New("find-capacity and profile are exclusive")
+	}
+
+	s, err := worker.ParseSearch(in)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	s.Step = c.Float64(fCapacityStep)
+	s.Trial = c.Duration(fTrial)
+	s.SLO = worker.SLO{P99: c.Duration(fSloP99), ErrorRate: c.Float64(fSloErrorRate)}
+
+	return &s, nil
+}
+
+// Reads configures read operations
+type Reads struct {
+	// JournalLimit is page size of journal operation
+	JournalLimit int
+	// JournalWindow limits journal operation to records of the last period, 0 - whole journal
+	JournalWindow time.Duration
+}
+
+// DefReads is Reads of flag defaults
+var DefReads = Reads{JournalLimit: DefJournalLimit}
+
+func getReads(c *cli.Context) (Reads, error) {
+	r := Reads{JournalLimit: c.Int(fJournalLimit), JournalWindow: c.Duration(fJournalWindow)}
+	if r.JournalLimit <= 0 {
+		return Reads{}, errors.Errorf("%s should be positive", fJournalLimit)
+	}
+
+	return r, nil
+}
+
+// Operations returns how every operation kind is applied to store, reads use account of transaction only.
+// Operations run with ctx, so operations in flight are interrupted with the run.
+func Operations(ctx context.Context, s store.Store, r Reads) map[string]func(changing.Transaction) error {
+	return map[string]func(tx changing.Transaction) error{
+		Insert: func(tx changing.Transaction) error {
+			return errors.WithStack(s.InsertJournal(ctx, tx))
+		},
+		Transaction: func(tx changing.Transaction) error {
+			_, err := s.UpdateTX(ctx, tx)
+			return errors.WithStack(err)
+		},
+		Balance: func(tx changing.Transaction) error {
+			// account without transactions yet is valid read
+			_, err := s.GetBalance(ctx, tx.AccountID)
+			if errors.Is(err, store.ErrNotFound) {
+				return nil
+			}
+
+			return errors.WithStack(err)
+		},
+		Journal: func(tx changing.Transaction) error {
+			l, ok := s.(store.JournalLister)
+			if !ok {
+				return errors.Errorf("%T doesn't list journal", s)
+			}
+
+			var from time.Time
+			if r.JournalWindow > 0 {
+				from = time.Now().Add(-r.JournalWindow)
+			}
+
+			_, err := l.ListJournal(ctx, tx.AccountID, from, time.Time{}, "", r.JournalLimit)
+			return errors.WithStack(err)
+		},
+		Revert: func(tx changing.Transaction) error {
+			l, lok := s.(store.JournalLister)
+			rv, rok := s.(store.Reverter)
+			if !lok || !rok {
+				return errors.Errorf("%T doesn't revert journal", s)
+			}
+
+			page, err := l.ListJournal(ctx, tx.AccountID, time.Time{}, time.Time{}, "", r.JournalLimit)
+			if err != nil {
+				return errors.WithStack(err)
+			}
+
+			for _, rec := range page.Records {
+				if rec.Revertible() {
+					_, err = rv.Revert(ctx, rec.ID)
+					return errors.WithStack(err)
+				}
+			}
+
+			// latest page has nothing to revert
+			return nil
+		},
+	}
+}
+
+// Open connects to backend of command flags and sets its schema up
+func Open(c *cli.Context, b store.Backend) (store.Store, error) {
+	db, err := b.Open(c)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	if err = db.Setup(c.Context); err != nil {
+		_ = db.Close(c.Context)
+		return nil, errors.WithStack(err)
+	}
+
+	return db, nil
+}
+
+// getMix returns workload file, mix of kinds or single operation of operation flag
+func getMix(c *cli.Context) (*workload.Mix, error) {
+	path, mix := c.String(fWorkload), c.String(fMix)
+
+	switch {
+	case path != "" && mix != "":
+		return nil, errors.Errorf("%s and %s are exclusive", fWorkload, fMix)
+	case path != "":
+		return workload.Load(path, kinds...)
+	case mix != "":
+		return workload.ParseMix(mix, kinds...)
+	}
+
+	return workload.Single(c.String(fOpt), kinds...)
+}
+
+// has reports whether mix has operation of kind
+func has(m *workload.Mix, kind string) bool {
+	for _, op := range m.Operations {
+		if op.Kind == kind {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (m *benchCommand) Action(c *cli.Context) error {
+	search, err := getSearch(c)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	wcfg, err := getWorkerCfg(c)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	mix, err := getMix(c)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	dist := c.String(fKeyDist)
+	if mix.Accounts != "" && !c.IsSet(fKeyDist) {
+		dist = mix.Accounts
+	}
+
+	users, err := keys.Parse(dist, uint64(c.Int(fMaxUser)))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	// dates of requests start with run, so journal window reads them
+	gen, err := workload.NewGenerator(c.String(fGenerator), time.Now())
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	faults, err := fault.Parse(c.String(fFault))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	reads, err := getReads(c)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	dupRate := c.Float64(fDuplicateRate)
+	if dupRate < 0 || dupRate >= 1 {
+		return errors.Errorf("%s should be in [0, 1)", fDuplicateRate)
+	}
+
+	seed, threads := workload.Seed(c.Int64(fSeed)), wcfg.GetWithDefault().Threads
+	fmt.Println("seed:", seed)
+
+	// arrivals of open-loop run have own source, so they don't follow operations of the first thread
+	wcfg.Seed = seed + 2
+	fmt.Println("workload:", mix)
+
+	if addr := c.String(fMetricsAddr); addr != "" {
+		srv, err := metrics.Listen(addr)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		defer srv.Close()
+
+		wcfg.Metrics = srv.Metrics
+	}
+
+	db, err := Open(c, m.backend)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	defer db.Close(context.Background())
+
+	if len(faults) > 0 {
+		inj, ok := db.(fault.Injectable)
+		if !ok {
+			return errors.Errorf("%s doesn't support fault injection", m.backend.Name)
+		}
+
+		// faults have own source after redeliveries and arrivals
+		fault.Inject(inj, faults, seed+3)
+		fmt.Println("faults:", faults)
+	}
+
+	if r, ok := db.(store.Retrier); ok {
+		wcfg.Retries = r.Retries
+	}
+
+	if _, ok := db.(store.JournalLister); !ok && (has(mix, Journal) || has(mix, Revert)) {
+		return errors.Errorf("%s doesn't support journal operation", m.backend.Name)
+	}
+
+	if _, ok := db.(store.Reverter); !ok && has(mix, Revert) {
+		return errors.Errorf("%s doesn't support revert operation", m.backend.Name)
+	}
+
+	var rec *trace.Writer
+	if out := c.String(fTraceOut); out != "" {
+		if rec, err = trace.Create(out, trace.Header{Source: c.Command.Name, Threads: threads, Seed: seed}); err != nil {
+			return errors.WithStack(err)
+		}
+
+		wcfg.Sinks = append(wcfg.Sinks, rec)
+	}
+
+	var hist *history.Writer
+	if out := c.String(fHistoryOut); out != "" {
+		if hist, err = history.Create(out); err != nil {
+			return errors.WithStack(err)
+		}
+
+		wcfg.Sinks = append(wcfg.Sinks, hist)
+	}
+
+	factory := func(thread int) worker.Timed {
+		r := workload.Rand(seed, thread)
+		next, txs, ops := users.Generator(r, thread, threads), gen(r, thread, threads), mix.Stream(r)
+		do := Operations(c.Context, history.Wrap(db, hist, thread), reads)
+
+		// redeliveries have own source, so the same seed gives the same new transactions
+		dups := workload.Rand(seed+1, thread)
+		var last *changing.Transaction
+
+		return worker.Timed{Do: func(begin time.Time) (string, error) {
+			var (
+				name, kind string
+				tx         changing.Transaction
+			)
+
+			if last != nil && dupRate > 0 && dups.Float64() < dupRate {
+				name, kind, tx = Duplicate, Transaction, *last
+			} else {
+				op := ops.Next()
+				name, kind, tx = op.Name, op.Kind, txs.Make(next.Next(), op)
+
+				if kind == Transaction {
+					last = &tx
+				}
+			}
+
+			rec.Add(thread, begin, name, kind, tx)
+
+			if len(faults) > 0 {
+				// injected panic fails operation instead of run
+				return name, fault.Recover(func() error { return do[kind](tx) })
+			}
+
+			return name, do[kind](tx)
+		}}
+	}
+
+	if search != nil {
+		res, err := worker.FindCapacity(c.Context, *wcfg, *search, factory)
+		fmt.Println(res)
+
+		return errors.WithStack(err)
+	}
+
+	w := worker.New(wcfg)
+	w.RunThreads(c.Context, factory)
+
+	return errors.WithStack(w.Wait())
+}
@@ -0,0 +1,95 @@
+package coordinator
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/d7561985/mongo-ab/pkg/cluster"
+	"github.com/d7561985/mongo-ab/pkg/results"
+	"github.com/pkg/errors"
+	"github.com/urfave/cli/v2"
+)
+
+const (
+	fAgents        = "agents"
+	fResultsOut    = "results-out"
+	fResultsFormat = "results-format"
+)
+
+const (
+	EnvAgents        = "AGENTS"
+	EnvResultsOut    = "RESULTS_OUT"
+	EnvResultsFormat = "RESULTS_FORMAT"
+)
+
+type coordinatorCommand struct{}
+
+func New() *cli.Command {
+	c := new(coordinatorCommand)
+
+	return &cli.Command{
+		Name:        "coordinator",
+		Usage:       "Run the same workload on several agents and merge their results",
+		ArgsUsage:   "-- <command> [flags], e.g. -- mongo --threads 50 --addr mongodb://...",
+		Description: "coordinator sends workload command line to every agent, starts them together and merges histograms and counters into one report",
+		Flags: []cli.Flag{
+			&cli.StringFlag{Name: fAgents, Usage: "Comma separated agent addresses, e.g. host1:7070,host2:7070", Required: true, EnvVars: []string{EnvAgents}},
+			&cli.StringFlag{Name: fResultsOut, Usage: "File for merged summary with effective configuration", EnvVars: []string{EnvResultsOut}},
+			&cli.StringFlag{Name: fResultsFormat, Usage: "Results format: json, csv (default: by file extension, json)", EnvVars: []string{EnvResultsFormat}},
+		},
+		Action: c.Action,
+	}
+}
+
+func (m *coordinatorCommand) Action(c *cli.Context) error {
+	args := c.Args().Slice()
+	if len(args) == 0 {
+		return errors.New("workload command is required, e.g. coordinator --agents host:7070 -- mongo --threads 50")
+	}
+
+	var agents []string
+	for _, a := range strings.Split(c.String(fAgents), ",") {
+		if a = strings.TrimSpace(a); a != "" {
+			agents = append(agents, a)
+		}
+	}
+
+	res, err := cluster.Coordinate(c.Context, agents, cluster.Workload{Args: args})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	fmt.Println("==== agents ====")
+	for _, r := range res.Reports {
+		status := "ok"
+		if r.Err != "" {
+			status = r.Err
+		}
+
+		fmt.Printf("%s: ops: %d errors: %d comb/sec: %.2f | %s | %s\n",
+			r.Agent, r.Summary.Ops, r.Summary.Failed, r.Summary.Throughput, r.Summary.Latency, status)
+	}
+
+	fmt.Println(res.Summary)
+
+	if out := c.String(fResultsOut); out != "" {
+		cfg := results.Config(c)
+		masked := make([]string, 0, len(args))
+		for _, a := range args {
+			masked = append(masked, results.Mask(a))
+		}
+
+		cfg["workload"] = strings.Join(masked, " ")
+
+		sink, err := results.Open(out, c.String(fResultsFormat), cfg)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		if err = sink.Finish(res.Summary); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	return errors.WithStack(res.Failed())
+}
@@ -0,0 +1,70 @@
+package history
+
+import (
+	"fmt"
+
+	"github.com/d7561985/mongo-ab/pkg/history"
+	"github.com/pkg/errors"
+	"github.com/urfave/cli/v2"
+)
+
+const defMaxAnomalies = 100
+
+const (
+	fHistory      = "history"
+	fMaxAnomalies = "max-anomalies"
+)
+
+const (
+	EnvHistory      = "HISTORY"
+	EnvMaxAnomalies = "MAX_ANOMALIES"
+)
+
+type historyCommand struct{}
+
+func New() *cli.Command {
+	c := new(historyCommand)
+
+	return &cli.Command{
+		Name:        "check-history",
+		Usage:       "Check operation history recorded with --history-out for isolation anomalies",
+		Description: "check-history orders successful writes of every account into one chain of balances and reports lost updates, duplicate post-balances, order which contradicts real time and reads of uncommitted or stale state",
+		Flags: []cli.Flag{
+			&cli.StringFlag{Name: fHistory, Usage: "History file, JSON lines, .gz - compressed", Required: true, EnvVars: []string{EnvHistory}},
+			&cli.IntFlag{Name: fMaxAnomalies, Value: defMaxAnomalies, Usage: "Anomalies printed, 0 - all", EnvVars: []string{EnvMaxAnomalies}},
+		},
+		Action: c.Action,
+	}
+}
+
+func (m *historyCommand) Action(c *cli.Context) error {
+	var events []history.Event
+
+	err := history.Load(c.String(fHistory), func(e history.Event) error {
+		events = append(events, e)
+		return nil
+	})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	rep := history.Check(events)
+
+	limit := c.Int(fMaxAnomalies)
+	for i, a := range rep.Anomalies {
+		if limit > 0 && i == limit {
+			fmt.Printf("... %d more\n", len(rep.Anomalies)-limit)
+			break
+		}
+
+		fmt.Println(a)
+	}
+
+	fmt.Println(rep)
+
+	if len(rep.Anomalies) > 0 {
+		return errors.Errorf("%d anomalies", len(rep.Anomalies))
+	}
+
+	return nil
+}
@@ -3,6 +3,13 @@ package mongoproduction
 import (
 	"time"
 
+	"github.com/d7561985/mongo-ab/pkg/funds"
+	"github.com/d7561985/mongo-ab/pkg/keys"
+	"github.com/d7561985/mongo-ab/pkg/metrics"
+	"github.com/d7561985/mongo-ab/pkg/results"
+	"github.com/d7561985/mongo-ab/pkg/retry"
+	"github.com/d7561985/mongo-ab/pkg/worker"
+	"github.com/d7561985/mongo-ab/pkg/workload"
 	"github.com/pkg/errors"
 	"github.com/urfave/cli/v2"
 )
@@ -13,7 +20,7 @@ func Command() *cli.Command {
 		Name:        "mongo-production",
 		Usage:       "Run production MongoDB load test with financial transactions",
 		Description: "Load test MongoDB with realistic financial transaction patterns from production service",
-		Flags: []cli.Flag{
+		Flags: append([]cli.Flag{
 			&cli.IntFlag{
 				Name:    "threads",
 				Aliases: []string{"t"},
@@ -47,6 +54,78 @@ func Command() *cli.Command {
 				Value:   5 * time.Minute,
 				EnvVars: []string{"DURATION"},
 			},
+			&cli.Float64Flag{
+				Name:    "rate",
+				Usage:   "Open-loop target rate of transactions per second for all threads, 0 - closed-loop",
+				Value:   0,
+				EnvVars: []string{"RATE"},
+			},
+			&cli.StringFlag{
+				Name:    "arrival",
+				Usage:   "Open-loop arrivals: fixed, poisson",
+				Value:   string(worker.Fixed),
+				EnvVars: []string{"ARRIVAL"},
+			},
+			&cli.StringFlag{
+				Name:    "profile",
+				Usage:   "Load profile stages, e.g. ramp:1m:10-200,soak:10m:200,spike:30s:500,step:5m:100-500x5 (--duration still caps the run)",
+				EnvVars: []string{"PROFILE"},
+			},
+			&cli.Uint64Flag{
+				Name:    "max-errors",
+				Usage:   "Error budget: abort after this number of failed transactions, 0 - unlimited",
+				Value:   0,
+				EnvVars: []string{"MAX_ERRORS"},
+			},
+			&cli.Float64Flag{
+				Name:    "max-error-rate",
+				Usage:   "Error budget: abort when share of failed transactions exceeds it, 0 - unlimited",
+				Value:   0.05,
+				EnvVars: []string{"MAX_ERROR_RATE"},
+			},
+			&cli.DurationFlag{
+				Name:    "warmup",
+				Usage:   "Warm-up duration excluded from statistics",
+				Value:   0,
+				EnvVars: []string{"WARMUP"},
+			},
+			&cli.Uint64Flag{
+				Name:    "warmup-ops",
+				Usage:   "Warm-up transactions excluded from statistics, warm-up ends with whichever limit comes first",
+				Value:   0,
+				EnvVars: []string{"WARMUP_OPS"},
+			},
+			&cli.StringFlag{
+				Name:    "results-out",
+				Usage:   "File for per-interval results and summary with effective configuration",
+				EnvVars: []string{"RESULTS_OUT"},
+			},
+			&cli.StringFlag{
+				Name:    "results-format",
+				Usage:   "Results format: json, csv (default: by file extension, json)",
+				EnvVars: []string{"RESULTS_FORMAT"},
+			},
+			&cli.StringFlag{
+				Name:    "metrics-addr",
+				Usage:   "Address of HTTP listener with Prometheus metrics on /metrics, e.g. :9100 (default: disabled)",
+				EnvVars: []string{"METRICS_ADDR"},
+			},
+			&cli.StringFlag{
+				Name:    "key-dist",
+				Usage:   "Account access distribution over pool shared by threads: uniform, zipfian[:theta], hotspot[:ops%:keys%], latest[:theta], sequential (default: every thread uses its own 10 accounts)",
+				EnvVars: []string{"KEY_DIST"},
+			},
+			&cli.Int64Flag{
+				Name:    "seed",
+				Usage:   "Seed of transaction stream, the same seed gives every thread the same transactions, 0 - random",
+				Value:   0,
+				EnvVars: []string{"SEED"},
+			},
+			&cli.StringFlag{
+				Name:    "workload",
+				Usage:   "YAML or JSON file with weighted operations (kind: debit, credit, transfer, zero, squash), amounts and account distribution, replaces operation",
+				EnvVars: []string{"WORKLOAD"},
+			},
 			&cli.Float64Flag{
 				Name:    "initial-balance",
 				Usage:   "Initial balance for each account",
@@ -97,7 +176,7 @@ func Command() *cli.Command {
 				Value:   0,
 				EnvVars: []string{"MONGO_WRITE_CONCERN_W"},
 			},
-		},
+		}, append(retry.Flags(), funds.Flags()...)...),
 		Action: RunCommand,
 	}
 }
@@ -110,6 +189,8 @@ func RunCommand(c *cli.Context) error {
 		Operation:             c.String("operation"),
 		TransactionsPerThread: c.Int("transactions-per-thread"),
 		Duration:              c.Duration("duration"),
+		Rate:                  c.Float64("rate"),
+		Arrival:               worker.Arrival(c.String("arrival")),
 		InitialBalance:        c.Float64("initial-balance"),
 		MongoDB:               c.String("addr"),
 		Database:              c.String("db"),
@@ -118,6 +199,16 @@ func RunCommand(c *cli.Context) error {
 		WriteConcern:          c.Bool("wc"),
 		WriteConcernJournal:   c.Bool("wcJournal"),
 		WriteConcernW:         c.Int("W"),
+		Budget: worker.ErrorBudget{
+			MaxErrors: c.Uint64("max-errors"),
+			MaxRate:   c.Float64("max-error-rate"),
+		},
+		Warmup:    c.Duration("warmup"),
+		WarmupOps: c.Uint64("warmup-ops"),
+		KeyDist:   c.String("key-dist"),
+		Seed:      c.Int64("seed"),
+		Funds:     funds.Get(c),
+		Retry:     retry.Get(c),
 	}
 
 	// Validate configuration
@@ -130,9 +221,48 @@ func RunCommand(c *cli.Context) error {
 	if config.TransactionsPerThread <= 0 {
 		return errors.New("transactions-per-thread must be greater than 0")
 	}
+	if err := config.Budget.Validate(); err != nil {
+		return errors.WithStack(err)
+	}
+	if config.Rate < 0 {
+		return errors.New("rate cannot be negative")
+	}
+	if err := config.Arrival.Validate(); err != nil {
+		return errors.WithStack(err)
+	}
+	if err := config.Funds.Validate(); err != nil {
+		return errors.WithStack(err)
+	}
+	if p := c.String("profile"); p != "" {
+		profile, err := worker.ParseProfile(p)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		config.Profile = profile
+		config.NumThreads = profile.Threads(config.NumThreads)
+	}
 	if config.InitialBalance < 0 {
 		return errors.New("initial-balance cannot be negative")
 	}
+	if path := c.String("workload"); path != "" {
+		mix, err := workload.Load(path, string(OperationTypeDebit), string(OperationTypeCredit),
+			string(OperationTypeTransfer), string(OperationTypeZero), string(OperationTypeSquash))
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		config.Workload = mix
+		if mix.Accounts != "" && !c.IsSet("key-dist") {
+			config.KeyDist = mix.Accounts
+		}
+	}
+	if config.KeyDist != "" {
+		// pool size is known only after accounts are created, syntax is checked now
+		if _, err := keys.Parse(config.KeyDist, 1); err != nil {
+			return errors.WithStack(err)
+		}
+	}
 
 	// Validate operation type
 	validOps := map[string]bool{
@@ -143,6 +273,27 @@ func RunCommand(c *cli.Context) error {
 		return errors.Errorf("invalid operation type: %s", config.Operation)
 	}
 
+	// Results file is opened last so that invalid flags don't leave empty file behind
+	if out := c.String("results-out"); out != "" {
+		sink, err := results.Open(out, c.String("results-format"), results.Config(c))
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		config.Sinks = append(config.Sinks, sink)
+	}
+
+	if addr := c.String("metrics-addr"); addr != "" {
+		srv, err := metrics.Listen(addr)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		defer srv.Close()
+
+		config.Metrics = srv.Metrics
+	}
+
 	// Use context from CLI for proper shutdown handling
 	ctx := c.Context
 	return RunLoadTest(ctx, config)
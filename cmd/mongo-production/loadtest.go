@@ -8,6 +8,13 @@ import (
 	"sync/atomic"
 	"time"
 
+	"github.com/d7561985/mongo-ab/pkg/errclass"
+	"github.com/d7561985/mongo-ab/pkg/funds"
+	"github.com/d7561985/mongo-ab/pkg/keys"
+	"github.com/d7561985/mongo-ab/pkg/metrics"
+	"github.com/d7561985/mongo-ab/pkg/retry"
+	"github.com/d7561985/mongo-ab/pkg/worker"
+	"github.com/d7561985/mongo-ab/pkg/workload"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -33,6 +40,30 @@ type LoadTestConfig struct {
 	WriteConcern        bool
 	WriteConcernJournal bool
 	WriteConcernW       int
+	// Open-loop settings, zero rate keeps closed-loop
+	Rate    float64
+	Arrival worker.Arrival
+	// Staged load, empty keeps flat NumThreads
+	Profile worker.Profile
+	// Failed transactions allowed before the test is aborted
+	Budget worker.ErrorBudget
+	// Warm-up excluded from statistics
+	Warmup    time.Duration
+	WarmupOps uint64
+	// Receivers of per-interval results and summary
+	Sinks []worker.Sink
+	// Live metrics for Prometheus, nil when disabled
+	Metrics *metrics.Metrics
+	// Key distribution over shared account pool, empty keeps accounts owned by threads
+	KeyDist string
+	// Seed of transaction stream of every thread, zero is random
+	Seed int64
+	// Operation mix of workload file, nil keeps Operation
+	Workload *workload.Mix
+	// Insufficient funds rule of balance updates
+	Funds funds.Mode
+	// Retry of application funds check transaction
+	Retry retry.Policy
 }
 
 // LoadTestStats statistics for load testing
@@ -43,6 +74,8 @@ type LoadTestStats struct {
 	TotalUsers          int64
 	StartTime           time.Time
 	EndTime             time.Time
+	// Summary of measured part of the test, warm-up excluded
+	Summary worker.Summary
 }
 
 // LoadTester performs load testing
@@ -68,10 +101,20 @@ func (lt *LoadTester) Run(ctx context.Context) error {
 	log.Printf("🚀 Starting Production MongoDB Load Test")
 	log.Printf("Threads: %d, MaxUserID: %d, Operation: %s, Transactions per thread: %d, Duration: %v",
 		lt.config.NumThreads, lt.config.MaxUserID, lt.config.Operation, lt.config.TransactionsPerThread, lt.config.Duration)
+	if lt.config.Rate > 0 {
+		log.Printf("⏱️ Open-loop rate: %.2f tx/s (%s arrival)", lt.config.Rate, lt.config.Arrival)
+	}
+	for _, st := range lt.config.Profile {
+		log.Printf("📶 Stage: %s", st)
+	}
 
 	// Validate operation configuration
-	log.Printf("📝 Operation mode: %s", lt.config.Operation)
-	if lt.config.Operation == "all" {
+	if lt.config.Workload != nil {
+		log.Printf("📝 Workload %q: %s", lt.config.Workload.Name, lt.config.Workload)
+	} else {
+		log.Printf("📝 Operation mode: %s", lt.config.Operation)
+	}
+	if lt.config.Workload == nil && lt.config.Operation == "all" {
 		log.Printf("📊 Transaction distribution:")
 		log.Printf("   • 40%% Deposits (debit)")
 		log.Printf("   • 30%% Withdrawals (credit)")
@@ -89,6 +132,10 @@ func (lt *LoadTester) Run(ctx context.Context) error {
 		log.Printf("✅ Indexes created successfully")
 	}
 
+	if err := lt.service.ApplyFunds(ctx); err != nil {
+		return err
+	}
+
 	// Create test context with timeout
 	testCtx, cancel := context.WithTimeout(ctx, lt.config.Duration)
 	defer cancel()
@@ -102,24 +149,47 @@ func (lt *LoadTester) Run(ctx context.Context) error {
 		return fmt.Errorf("failed to create accounts: %w", err)
 	}
 
-	// Run parallel load test with threads
-	g := errgroup.Group{}
-	for i := 0; i < lt.config.NumThreads; i++ {
-		threadID := i
-		g.Go(func() error {
-			return lt.runThreadTransactions(testCtx, threadID, accounts)
-		})
+	// Pre-create accounts for every thread
+	pools, err := lt.createThreadAccounts(testCtx, accounts)
+	if err != nil {
+		return fmt.Errorf("failed to create thread accounts: %w", err)
 	}
 
-	// Wait for all goroutines
-	if err := g.Wait(); err != nil {
-		log.Printf("Load test completed with errors: %v", err)
+	pick, err := lt.accountPicker(pools)
+	if err != nil {
+		return fmt.Errorf("failed to set up key distribution: %w", err)
 	}
 
+	seed := workload.Seed(lt.config.Seed)
+	log.Printf("🎲 Seed: %d", seed)
+
+	// Run parallel load test with threads
+	w := worker.New(&worker.Config{
+		Threads:    lt.config.NumThreads,
+		Rate:       lt.config.Rate,
+		Arrival:    lt.config.Arrival,
+		Seed:       seed + 2, // arrivals have own source apart from stream of the first thread
+		Profile:    lt.config.Profile,
+		Budget:     lt.config.Budget,
+		Warmup:     lt.config.Warmup,
+		WarmupOps:  lt.config.WarmupOps,
+		Iterations: lt.config.TransactionsPerThread,
+		Interval:   5 * time.Second,
+		Sinks:      lt.config.Sinks,
+		Metrics:    lt.config.Metrics,
+	})
+
+	w.RunThreads(testCtx, func(threadID int) worker.Timed {
+		r := workload.Rand(seed, threadID)
+		return lt.threadTransaction(testCtx, r, pick(threadID, r))
+	})
+	runErr := w.Wait()
+
 	lt.stats.EndTime = time.Now()
+	lt.stats.Summary = w.Summary()
 	lt.printFinalStats()
 
-	return nil
+	return runErr
 }
 
 // createAccountsForThreads creates initial accounts for testing
@@ -170,59 +240,136 @@ func (lt *LoadTester) createAccountsForThreads(ctx context.Context) (map[int]*Ac
 	return accounts, nil
 }
 
-// runThreadTransactions runs transactions for a single thread
-func (lt *LoadTester) runThreadTransactions(ctx context.Context, threadID int, existingAccounts map[int]*Account) error {
-	// Create account cache for this thread
-	accountCache := make(map[int]*Account)
+// createThreadAccounts pre-creates a few accounts per thread, threads work concurrently
+func (lt *LoadTester) createThreadAccounts(ctx context.Context, existingAccounts map[int]*Account) ([][]*Account, error) {
+	pools := make([][]*Account, lt.config.NumThreads)
 
-	// Pre-create accounts for this thread (create a few accounts per thread)
-	threadAccounts := make([]*Account, 0, 10)
-	for j := 0; j < 10; j++ {
-		userID := (threadID*10 + j) % lt.config.MaxUserID
-		account, err := lt.getOrCreateAccount(ctx, userID, existingAccounts, accountCache)
-		if err != nil {
-			log.Printf("Thread %d: failed to create account %d: %v", threadID, userID, err)
-			continue
-		}
-		threadAccounts = append(threadAccounts, account)
-	}
+	g := errgroup.Group{}
+	for i := 0; i < lt.config.NumThreads; i++ {
+		threadID := i
+		g.Go(func() error {
+			// Create account cache for this thread
+			accountCache := make(map[int]*Account)
+
+			threadAccounts := make([]*Account, 0, 10)
+			for j := 0; j < 10; j++ {
+				userID := (threadID*10 + j) % lt.config.MaxUserID
+				account, err := lt.getOrCreateAccount(ctx, userID, existingAccounts, accountCache)
+				if err != nil {
+					log.Printf("Thread %d: failed to create account %d: %v", threadID, userID, err)
+					continue
+				}
+				threadAccounts = append(threadAccounts, account)
+			}
 
-	if len(threadAccounts) == 0 {
-		return fmt.Errorf("thread %d: no accounts created", threadID)
-	}
+			if len(threadAccounts) == 0 {
+				return fmt.Errorf("thread %d: no accounts created", threadID)
+			}
 
-	for i := 0; i < lt.config.TransactionsPerThread; i++ {
-		select {
-		case <-ctx.Done():
+			pools[threadID] = threadAccounts
 			return nil
-		default:
-			// Select random account from thread's account pool
-			account := threadAccounts[rand.Intn(len(threadAccounts))]
+		})
+	}
 
-			// Generate transaction based on operation type
-			tx := lt.generateTransaction()
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
 
-			// Execute transaction
-			_, err := lt.service.CreateTransaction(ctx, account.ID, tx.amount, tx.opType)
+	return pools, nil
+}
 
-			atomic.AddInt64(&lt.stats.TotalTransactions, 1)
-			if err != nil {
-				atomic.AddInt64(&lt.stats.FailedTransactions, 1)
-				// Continue on error (like insufficient balance)
-				continue
+// accountPicker returns account chooser for every thread: random account of thread's own pool by default,
+// or account of pool shared by all threads selected with configured key distribution
+func (lt *LoadTester) accountPicker(pools [][]*Account) (func(threadID int, r *rand.Rand) func() *Account, error) {
+	if lt.config.KeyDist == "" {
+		return func(threadID int, r *rand.Rand) func() *Account {
+			threadAccounts := pools[threadID]
+
+			return func() *Account {
+				return threadAccounts[r.Intn(len(threadAccounts))]
 			}
-			atomic.AddInt64(&lt.stats.SuccessTransactions, 1)
+		}, nil
+	}
+
+	var all []*Account
+	for _, p := range pools {
+		all = append(all, p...)
+	}
+
+	dist, err := keys.Parse(lt.config.KeyDist, uint64(len(all)))
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("🔑 Key distribution: %s shared by all threads", dist)
+
+	return func(threadID int, r *rand.Rand) func() *Account {
+		next := dist.Generator(r, threadID, len(pools))
+
+		return func() *Account {
+			return all[next.Next()]
+		}
+	}, nil
+}
+
+// threadTransaction returns single transaction step of thread, the step reports operation type of transaction it made
+func (lt *LoadTester) threadTransaction(ctx context.Context, r *rand.Rand, pick func() *Account) worker.Timed {
+	next := lt.transactionSource(r)
+
+	return worker.Timed{Do: func(time.Time) (string, error) {
+		account := pick()
+
+		tx := next()
+
+		// Execute transaction
+		_, err := lt.service.CreateTransaction(ctx, account.ID, tx.amount, tx.opType)
+
+		atomic.AddInt64(&lt.stats.TotalTransactions, 1)
+		if err != nil {
+			atomic.AddInt64(&lt.stats.FailedTransactions, 1)
+			// Worker classifies the error and continues until error budget is exhausted
+			return tx.label(), err
 		}
+		atomic.AddInt64(&lt.stats.SuccessTransactions, 1)
+
+		return tx.label(), nil
+	}}
+}
+
+// transactionSource returns transaction generator of thread: operations of workload file when it is set,
+// built-in distribution of operation mode otherwise
+func (lt *LoadTester) transactionSource(r *rand.Rand) func() transactionInfo {
+	if lt.config.Workload == nil {
+		return func() transactionInfo {
+			return lt.generateTransaction(r)
+		}
+	}
+
+	ops := lt.config.Workload.Stream(r)
+
+	return func() transactionInfo {
+		op := ops.Next()
+		return transactionInfo{name: op.Name, amount: op.Amount, opType: OperationType(op.Kind)}
 	}
-	return nil
 }
 
 // transactionInfo holds transaction generation info
 type transactionInfo struct {
+	// name of workload operation, empty for built-in distribution
+	name   string
 	amount float64
 	opType OperationType
 }
 
+// label is type of transaction in statistics
+func (t transactionInfo) label() string {
+	if t.name != "" {
+		return t.name
+	}
+
+	return string(t.opType)
+}
+
 // getOrCreateAccount gets existing account or creates new one
 func (lt *LoadTester) getOrCreateAccount(ctx context.Context, userID int, existingAccounts, cache map[int]*Account) (*Account, error) {
 	// Check cache first
@@ -262,20 +409,20 @@ func (lt *LoadTester) getOrCreateAccount(ctx context.Context, userID int, existi
 }
 
 // generateSpecificTransaction generates a transaction for specific operation type
-func (lt *LoadTester) generateSpecificTransaction(opType string) transactionInfo {
+func (lt *LoadTester) generateSpecificTransaction(r *rand.Rand, opType string) transactionInfo {
 	switch opType {
 	case "debit":
 		return transactionInfo{
-			amount: rand.Float64()*990 + 10, // $10-$1000
+			amount: r.Float64()*990 + 10, // $10-$1000
 			opType: OperationTypeDebit,
 		}
 	case "credit":
 		return transactionInfo{
-			amount: -(rand.Float64()*490 + 10), // -$10 to -$500
+			amount: -(r.Float64()*490 + 10), // -$10 to -$500
 			opType: OperationTypeCredit,
 		}
 	case "transfer":
-		amount := rand.Float64()*200 - 100
+		amount := r.Float64()*200 - 100
 		if amount > 0 {
 			return transactionInfo{amount: amount, opType: OperationTypeDebit}
 		}
@@ -287,43 +434,43 @@ func (lt *LoadTester) generateSpecificTransaction(opType string) transactionInfo
 		}
 	case "squash":
 		return transactionInfo{
-			amount: -(rand.Float64() * 50),
+			amount: -(r.Float64() * 50),
 			opType: OperationTypeSquash,
 		}
 	default:
 		// Default to debit
 		return transactionInfo{
-			amount: rand.Float64()*100 + 10,
+			amount: r.Float64()*100 + 10,
 			opType: OperationTypeDebit,
 		}
 	}
 }
 
 // generateTransaction generates a transaction based on operation type or random distribution
-func (lt *LoadTester) generateTransaction() transactionInfo {
+func (lt *LoadTester) generateTransaction(r *rand.Rand) transactionInfo {
 	// If specific operation is selected
 	if lt.config.Operation != "all" {
-		return lt.generateSpecificTransaction(lt.config.Operation)
+		return lt.generateSpecificTransaction(r, lt.config.Operation)
 	}
 
 	// Random distribution for "all"
-	r := rand.Float32()
+	p := r.Float32()
 
 	switch {
-	case r < 0.40: // 40% deposits (debit)
+	case p < 0.40: // 40% deposits (debit)
 		return transactionInfo{
-			amount: rand.Float64()*990 + 10, // $10-$1000
+			amount: r.Float64()*990 + 10, // $10-$1000
 			opType: OperationTypeDebit,
 		}
 
-	case r < 0.70: // 30% withdrawals (credit)
+	case p < 0.70: // 30% withdrawals (credit)
 		return transactionInfo{
-			amount: -(rand.Float64()*490 + 10), // -$10 to -$500
+			amount: -(r.Float64()*490 + 10), // -$10 to -$500
 			opType: OperationTypeCredit,
 		}
 
-	case r < 0.85: // 15% transfers
-		amount := rand.Float64()*200 - 100 // -$100 to $100
+	case p < 0.85: // 15% transfers
+		amount := r.Float64()*200 - 100 // -$100 to $100
 		if amount > 0 {
 			return transactionInfo{
 				amount: amount,
@@ -335,15 +482,15 @@ func (lt *LoadTester) generateTransaction() transactionInfo {
 			opType: OperationTypeCredit,
 		}
 
-	case r < 0.95: // 10% small transactions
+	case p < 0.95: // 10% small transactions
 		return transactionInfo{
-			amount: rand.Float64()*9 + 1, // $1-$10
+			amount: r.Float64()*9 + 1, // $1-$10
 			opType: OperationTypeDebit,
 		}
 
 	default: // 5% squash operations
 		return transactionInfo{
-			amount: -(rand.Float64() * 50), // negative for squash
+			amount: -(r.Float64() * 50), // negative for squash
 			opType: OperationTypeSquash,
 		}
 	}
@@ -382,10 +529,11 @@ func (lt *LoadTester) reportStats(ctx context.Context) {
 
 // printFinalStats prints final statistics
 func (lt *LoadTester) printFinalStats() {
-	duration := lt.stats.EndTime.Sub(lt.stats.StartTime)
-	total := atomic.LoadInt64(&lt.stats.TotalTransactions)
-	success := atomic.LoadInt64(&lt.stats.SuccessTransactions)
-	failed := atomic.LoadInt64(&lt.stats.FailedTransactions)
+	summary := lt.stats.Summary
+	duration := summary.Duration
+	total := int64(summary.Ops + summary.Failed)
+	success := int64(summary.Ops)
+	failed := int64(summary.Failed)
 	users := atomic.LoadInt64(&lt.stats.TotalUsers)
 
 	tps := float64(total) / duration.Seconds()
@@ -394,6 +542,11 @@ func (lt *LoadTester) printFinalStats() {
 	fmt.Println("\n╔══════════════════════════════════════════════╗")
 	fmt.Println("║   PRODUCTION MONGODB LOAD TEST RESULTS      ║")
 	fmt.Println("╠══════════════════════════════════════════════╣")
+	if summary.Warmup.Ops > 0 || summary.Warmup.Failed > 0 {
+		fmt.Printf("║ Warm-up (excluded):    %-22v ║\n", summary.Warmup.Duration.Round(time.Second))
+		fmt.Printf("║ Warm-up Transactions:  %-22d ║\n", summary.Warmup.Ops+summary.Warmup.Failed)
+		fmt.Println("╠══════════════════════════════════════════════╣")
+	}
 	fmt.Printf("║ Duration:              %-22v ║\n", duration.Round(time.Second))
 	fmt.Printf("║ Total Users:           %-22d ║\n", users)
 	fmt.Printf("║ Total Transactions:    %-22d ║\n", total)
@@ -401,6 +554,10 @@ func (lt *LoadTester) printFinalStats() {
 	fmt.Printf("║ Failed:                %-22d ║\n", failed)
 	fmt.Printf("║ Success Rate:          %-21.2f%% ║\n", successRate)
 	fmt.Printf("║ Average TPS:           %-22.2f ║\n", tps)
+	fmt.Printf("║ Latency p50:           %-22v ║\n", summary.Latency.P50)
+	fmt.Printf("║ Latency p99:           %-22v ║\n", summary.Latency.P99)
+	fmt.Printf("║ Latency p99.9:         %-22v ║\n", summary.Latency.P999)
+	fmt.Printf("║ Latency max:           %-22v ║\n", summary.Latency.Max)
 	fmt.Println("╚══════════════════════════════════════════════╝")
 
 	fmt.Println("\n📈 Transaction Distribution:")
@@ -426,7 +583,16 @@ func (lt *LoadTester) printFinalStats() {
 	}
 
 	if failed > 0 {
-		fmt.Printf("\n⚠️ Failed transactions may be due to insufficient balance (expected behavior)\n")
+		fmt.Println("\n❌ Errors by class:")
+		for _, class := range errclass.Classes {
+			if n := summary.Errors[class]; n > 0 {
+				fmt.Printf("   • %s: %d\n", class, n)
+			}
+		}
+	}
+
+	if summary.Rejected > 0 {
+		fmt.Printf("\n⚠️ Rejected by %s funds check (expected behavior): %d\n", lt.config.Funds, summary.Rejected)
 	}
 }
 
@@ -536,7 +702,7 @@ func RunLoadTest(ctx context.Context, config *LoadTestConfig) error {
 	}
 
 	// Create service
-	service := NewTransactionService(client, config.Database)
+	service := NewTransactionService(client, config.Database, config.Funds, config.Retry)
 
 	// Create and run load tester
 	tester := NewLoadTester(config, service)
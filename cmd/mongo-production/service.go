@@ -1,36 +1,53 @@
 package mongoproduction
 
 import (
+	"bytes"
 	"context"
 	"crypto/sha1"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"math/rand"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/d7561985/mongo-ab/pkg/errclass"
+	"github.com/d7561985/mongo-ab/pkg/funds"
+	"github.com/d7561985/mongo-ab/pkg/retry"
+	"github.com/d7561985/mongo-ab/pkg/store"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/x/mongo/driver"
 )
 
+// codeDocumentValidation is code of write which collection validator refused
+const codeDocumentValidation = 121
+
 // TransactionService handles financial transactions
 type TransactionService struct {
 	client       *mongo.Client
 	db           *mongo.Database
 	accounts     *mongo.Collection
 	transactions *mongo.Collection
+	// funds is insufficient funds rule of balance updates
+	funds funds.Mode
+	// retry is policy of transaction of application funds check
+	retry retry.Policy
 }
 
-// NewTransactionService creates a new transaction service
-func NewTransactionService(client *mongo.Client, dbName string) *TransactionService {
+// NewTransactionService creates a new transaction service, policy without MaxAttempts is retry.Default
+func NewTransactionService(client *mongo.Client, dbName string, mode funds.Mode, policy retry.Policy) *TransactionService {
 	db := client.Database(dbName)
 	return &TransactionService{
 		client:       client,
 		db:           db,
 		accounts:     db.Collection("accounts"),
 		transactions: db.Collection("transactions"),
+		funds:        mode,
+		retry:        policy.OrDefault(),
 	}
 }
 
@@ -133,13 +150,17 @@ func (s *TransactionService) CreateTransaction(ctx context.Context, accountID pr
 	defer session.EndSession(ctx)
 
 	var transaction *Transaction
-	err = mongo.WithSession(ctx, session, func(sc mongo.SessionContext) error {
+	fn := func(sc mongo.SessionContext) error {
 		// Get account with lock for update
 		var account Account
 		if err := s.accounts.FindOne(sc, bson.M{"_id": accountID}).Decode(&account); err != nil {
 			return fmt.Errorf("account not found: %w", err)
 		}
 
+		if err := s.checkFunds(account, amount); err != nil {
+			return err
+		}
+
 		// Update balance atomically
 		newBalance, err := s.updateBalance(sc, accountID, amount)
 		if err != nil {
@@ -182,7 +203,32 @@ func (s *TransactionService) CreateTransaction(ctx context.Context, accountID pr
 			bson.M{"$set": bson.M{"status": TransactionStatusSuccess}},
 		)
 		return err
-	})
+	}
+
+	if s.funds == funds.Application {
+		// balance which fn checked can't change before commit, concurrent update of account conflicts and is retried
+		_, err = s.retry.DoWhen(ctx, s.retryable, func() error {
+			return mongo.WithSession(ctx, session, func(sc mongo.SessionContext) error {
+				if err := sc.StartTransaction(); err != nil {
+					return fmt.Errorf("failed to start transaction: %w", err)
+				}
+
+				if err := fn(sc); err != nil {
+					_ = sc.AbortTransaction(context.Background())
+					return err
+				}
+
+				// transaction can't run again while its commit result is unknown, only commit is retried
+				_, err := s.retry.DoWhen(sc, unknownCommit, func() error {
+					return sc.CommitTransaction(sc)
+				})
+
+				return err
+			})
+		})
+	} else {
+		err = mongo.WithSession(ctx, session, fn)
+	}
 
 	if err != nil {
 		return nil, err
@@ -191,7 +237,36 @@ func (s *TransactionService) CreateTransaction(ctx context.Context, accountID pr
 	return transaction, nil
 }
 
-// updateBalance updates account balance atomically
+// retryable is error of transaction which could run again, commit with unknown result could be already applied
+func (s *TransactionService) retryable(err error) bool {
+	return !unknownCommit(err) && s.retry.Retryable(err)
+}
+
+func unknownCommit(err error) bool {
+	var se mongo.ServerError
+	return errors.As(err, &se) && se.HasErrorLabel(driver.UnknownTransactionCommitResult)
+}
+
+// checkFunds is application funds check of account balance read in transaction
+func (s *TransactionService) checkFunds(account Account, amount float64) error {
+	if s.funds != funds.Application || amount >= 0 {
+		return nil
+	}
+
+	balance, err := strconv.ParseFloat(account.Balance.String(), 64)
+	if err != nil {
+		return fmt.Errorf("parse balance %s: %w", account.Balance, err)
+	}
+
+	if s.funds.Refuses(balance, amount) {
+		return store.ErrInsufficientFunds
+	}
+
+	return nil
+}
+
+// updateBalance updates account balance atomically, decrement which conditional or db-constraint funds rule refuses
+// fails with store.ErrInsufficientFunds
 func (s *TransactionService) updateBalance(ctx context.Context, accountID primitive.ObjectID, amount float64) (primitive.Decimal128, error) {
 	// Use MongoDB $inc operator for atomic update
 	update := bson.M{
@@ -201,43 +276,132 @@ func (s *TransactionService) updateBalance(ctx context.Context, accountID primit
 
 	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
 
+	filter := bson.M{"_id": accountID}
+
+	conditional := s.funds == funds.Conditional && amount < 0
+	if conditional {
+		// balance covers decrement
+		filter["balance"] = bson.M{"$gte": -amount}
+	}
+
 	var account Account
-	err := s.accounts.FindOneAndUpdate(ctx, bson.M{"_id": accountID}, update, opts).Decode(&account)
-	if err != nil {
+	err := s.accounts.FindOneAndUpdate(ctx, filter, update, opts).Decode(&account)
+
+	var se mongo.ServerError
+	switch {
+	case err == mongo.ErrNoDocuments && conditional:
+		return primitive.Decimal128{}, store.ErrInsufficientFunds
+	case s.funds == funds.Constraint && errors.As(err, &se) && se.HasErrorCode(codeDocumentValidation):
+		return primitive.Decimal128{}, fmt.Errorf("%w: %v", store.ErrInsufficientFunds, err)
+	case err != nil:
 		return primitive.Decimal128{}, err
 	}
 
-	// Check if balance went negative (not allowed for financial accounts)
-	// For now, we'll skip this check as Decimal128 comparison is complex
-	// In production, you'd use a proper decimal library
-	// TODO: Implement proper decimal comparison
-
 	return account.Balance, nil
 }
 
+// fundsValidator is validator of non-negative balance which ApplyFunds installs
+var fundsValidator = bson.D{{Key: "balance", Value: bson.D{{Key: "$gte", Value: 0}}}}
+
+// ApplyFunds sets validator of non-negative balance up for db-constraint funds rule. Other rules remove it when
+// previous run installed it, validator of somebody else is never replaced or removed.
+// Validator of existing collection is moderate: accounts which are negative already are not checked.
+func (s *TransactionService) ApplyFunds(ctx context.Context) error {
+	cur, err := s.db.ListCollections(ctx, bson.M{"name": s.accounts.Name()})
+	if err != nil {
+		return fmt.Errorf("failed to list collections: %w", err)
+	}
+
+	var specs []struct {
+		Options struct {
+			Validator bson.Raw `bson:"validator"`
+		} `bson:"options"`
+	}
+
+	if err = cur.All(ctx, &specs); err != nil {
+		return fmt.Errorf("failed to list collections: %w", err)
+	}
+
+	if len(specs) == 0 {
+		if s.funds != funds.Constraint {
+			return nil
+		}
+
+		opts := options.CreateCollection().SetValidator(fundsValidator).SetValidationLevel("strict").SetValidationAction("error")
+		if err = s.db.CreateCollection(ctx, s.accounts.Name(), opts); err != nil {
+			return fmt.Errorf("failed to create accounts: %w", err)
+		}
+
+		return nil
+	}
+
+	current := specs[0].Options.Validator
+	own, err := isFundsValidator(current)
+	if err != nil {
+		return err
+	}
+
+	// collection without validator has none or empty one
+	elems, _ := current.Elements()
+
+	var cmd bson.D
+
+	switch {
+	case s.funds != funds.Constraint && !own:
+		return nil
+	case s.funds != funds.Constraint:
+		cmd = bson.D{{Key: "collMod", Value: s.accounts.Name()}, {Key: "validator", Value: bson.D{}}}
+	case len(elems) > 0 && !own:
+		return fmt.Errorf("accounts has validator %s, %s funds check doesn't replace it", current, funds.Constraint)
+	default:
+		cmd = bson.D{
+			{Key: "collMod", Value: s.accounts.Name()},
+			{Key: "validator", Value: fundsValidator},
+			{Key: "validationLevel", Value: "moderate"},
+			{Key: "validationAction", Value: "error"},
+		}
+	}
+
+	if err = s.db.RunCommand(ctx, cmd).Err(); err != nil {
+		return fmt.Errorf("failed to set accounts validator: %w", err)
+	}
+
+	return nil
+}
+
+// isFundsValidator reports whether validator is the one of ApplyFunds
+func isFundsValidator(validator bson.Raw) (bool, error) {
+	own, err := bson.Marshal(fundsValidator)
+	if err != nil {
+		return false, fmt.Errorf("marshal funds validator: %w", err)
+	}
+
+	return bytes.Equal(validator, own), nil
+}
+
 // validateOperation validates operation type and amount
 func (s *TransactionService) validateOperation(opType OperationType, amount float64) error {
 	switch opType {
 	case OperationTypeDebit:
 		if amount <= 0 {
-			return fmt.Errorf("debit operation must have positive amount")
+			return fmt.Errorf("%w: debit operation must have positive amount", errclass.ErrValidation)
 		}
 	case OperationTypeCredit:
 		if amount >= 0 {
-			return fmt.Errorf("credit operation must have negative amount")
+			return fmt.Errorf("%w: credit operation must have negative amount", errclass.ErrValidation)
 		}
 	case OperationTypeTransfer:
 		if amount == 0 {
-			return fmt.Errorf("transfer operation must not be zero")
+			return fmt.Errorf("%w: transfer operation must not be zero", errclass.ErrValidation)
 		}
 	case OperationTypeZero:
 		if amount != 0 {
-			return fmt.Errorf("zero operation must have zero amount")
+			return fmt.Errorf("%w: zero operation must have zero amount", errclass.ErrValidation)
 		}
 	case OperationTypeSquash:
 		// No validation for squash
 	default:
-		return fmt.Errorf("unknown operation type: %s", opType)
+		return fmt.Errorf("%w: unknown operation type: %s", errclass.ErrValidation, opType)
 	}
 	return nil
 }
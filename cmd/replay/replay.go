@@ -0,0 +1,238 @@
+package replay
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/d7561985/mongo-ab/cmd/bench"
+	"github.com/d7561985/mongo-ab/pkg/changing"
+	"github.com/d7561985/mongo-ab/pkg/metrics"
+	"github.com/d7561985/mongo-ab/pkg/results"
+	"github.com/d7561985/mongo-ab/pkg/store"
+	"github.com/d7561985/mongo-ab/pkg/store/memory"
+	"github.com/d7561985/mongo-ab/pkg/trace"
+	"github.com/d7561985/mongo-ab/pkg/worker"
+	"github.com/pkg/errors"
+	"github.com/urfave/cli/v2"
+)
+
+const defMaxErrorRate = 0.05
+
+const (
+	fTrace   = "trace"
+	fSpeed   = "speed"
+	fThreads = "threads"
+	fOracle  = "oracle"
+
+	fMaxErrors    = "max-errors"
+	fMaxErrorRate = "max-error-rate"
+
+	fResultsOut    = "results-out"
+	fResultsFormat = "results-format"
+	fMetricsAddr   = "metrics-addr"
+)
+
+const (
+	EnvTrace   = "TRACE"
+	EnvSpeed   = "SPEED"
+	EnvThreads = "THREADS"
+	EnvOracle  = "ORACLE"
+
+	EnvMaxErrors    = "MAX_ERRORS"
+	EnvMaxErrorRate = "MAX_ERROR_RATE"
+
+	EnvResultsOut    = "RESULTS_OUT"
+	EnvResultsFormat = "RESULTS_FORMAT"
+	EnvMetricsAddr   = "METRICS_ADDR"
+)
+
+type replayCommand struct{}
+
+func New() *cli.Command {
+	c := new(replayCommand)
+
+	return &cli.Command{
+		Name:        "replay",
+		Usage:       "Send recorded trace to backend",
+		Description: "replay applies operations of trace recorded with --trace-out, or imported one, at original timing or as fast as possible",
+		Flags: []cli.Flag{
+			&cli.StringFlag{Name: fTrace, Usage: "Trace file, JSON lines, .gz - compressed", Required: true, EnvVars: []string{EnvTrace}},
+			&cli.Float64Flag{Name: fSpeed, Value: 1, Usage: "Timing of trace: 1 - original, 2 - twice as fast, 0 - as fast as possible", EnvVars: []string{EnvSpeed}},
+			&cli.IntFlag{Name: fThreads, Value: 0, Usage: "Replay threads, operations of every recorded thread stay in order, 0 - as recorded", EnvVars: []string{EnvThreads}},
+			&cli.BoolFlag{Name: fOracle, Usage: "Apply successful operations to in-memory store as well and compare final balances with backend", EnvVars: []string{EnvOracle}},
+			&cli.Uint64Flag{Name: fMaxErrors, Value: 0, Usage: "Error budget: abort after this number of failed operations, 0 - unlimited", EnvVars: []string{EnvMaxErrors}},
+			&cli.Float64Flag{Name: fMaxErrorRate, Value: defMaxErrorRate, Usage: "Error budget: abort when share of failed operations exceeds it, 0 - unlimited", EnvVars: []string{EnvMaxErrorRate}},
+			&cli.StringFlag{Name: fResultsOut, Usage: "File for per-interval results and summary with effective configuration", EnvVars: []string{EnvResultsOut}},
+			&cli.StringFlag{Name: fResultsFormat, Usage: "Results format: json, csv (default: by file extension, json)", EnvVars: []string{EnvResultsFormat}},
+			&cli.StringFlag{Name: fMetricsAddr, Usage: "Address of HTTP listener with Prometheus metrics on /metrics, e.g. :9100 (default: disabled)", EnvVars: []string{EnvMetricsAddr}},
+		},
+		Subcommands: c.subcommands(),
+	}
+}
+
+// subcommands replay to every registered store, ephemeral one is skipped as it is the oracle and loses state on exit
+func (m *replayCommand) subcommands() []*cli.Command {
+	var out []*cli.Command
+	for _, b := range store.Backends() {
+		if b.Ephemeral {
+			continue
+		}
+
+		out = append(out, &cli.Command{Name: b.Name, Usage: "Replay to " + b.Name, Flags: b.Flags, Action: m.action(b)})
+	}
+
+	return out
+}
+
+func (m *replayCommand) action(b store.Backend) cli.ActionFunc {
+	return func(c *cli.Context) error {
+		speed := c.Float64(fSpeed)
+		if speed < 0 {
+			return errors.New("speed cannot be negative")
+		}
+
+		wcfg := &worker.Config{
+			Threads: c.Int(fThreads),
+			Budget: worker.ErrorBudget{
+				MaxErrors: c.Uint64(fMaxErrors),
+				MaxRate:   c.Float64(fMaxErrorRate),
+			},
+		}
+
+		if err := wcfg.Budget.Validate(); err != nil {
+			return errors.WithStack(err)
+		}
+
+		r, err := trace.Open(c.String(fTrace))
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		defer r.Close()
+
+		h := r.Header()
+		if wcfg.Threads == 0 {
+			wcfg.Threads = h.Threads
+		}
+
+		wcfg = wcfg.GetWithDefault()
+		fmt.Printf("trace: %s recorded by %q with %d threads, seed %d, replay with %d threads at speed %g\n",
+			c.String(fTrace), h.Source, h.Threads, h.Seed, wcfg.Threads, speed)
+
+		db, err := bench.Open(c, b)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		defer db.Close(context.Background())
+
+		do := bench.Operations(c.Context, db, bench.DefReads)
+
+		if r, ok := db.(store.Retrier); ok {
+			wcfg.Retries = r.Retries
+		}
+
+		var oracle map[string]func(changing.Transaction) error
+		ref := memory.New()
+		if d, ok := db.(store.Deduplicator); ok && d.Idempotent() {
+			// oracle applies redelivered transactions the same way
+			ref = memory.NewIdempotent()
+		}
+
+		if c.Bool(fOracle) {
+			oracle = bench.Operations(c.Context, ref, bench.DefReads)
+		}
+
+		if out := c.String(fResultsOut); out != "" {
+			sink, err := results.Open(out, c.String(fResultsFormat), results.Config(c))
+			if err != nil {
+				return errors.WithStack(err)
+			}
+
+			wcfg.Sinks = append(wcfg.Sinks, sink)
+		}
+
+		if addr := c.String(fMetricsAddr); addr != "" {
+			srv, err := metrics.Listen(addr)
+			if err != nil {
+				return errors.WithStack(err)
+			}
+
+			defer srv.Close()
+
+			wcfg.Metrics = srv.Metrics
+		}
+
+		ctx, cancel := context.WithCancel(c.Context)
+		defer cancel()
+
+		p := trace.NewPlayer(r, wcfg.Threads, speed)
+
+		played := make(chan error, 1)
+		go func() { played <- p.Run(ctx) }()
+
+		w := worker.New(wcfg)
+		w.RunThreads(ctx, func(thread int) worker.Timed {
+			return p.Thread(thread, func(rec trace.Record) error {
+				fn, ok := do[rec.Kind]
+				if !ok {
+					return errors.Errorf("unsupported operation kind %q", rec.Kind)
+				}
+
+				if err := fn(rec.Tx); err != nil || oracle == nil {
+					return err
+				}
+
+				return oracle[rec.Kind](rec.Tx)
+			})
+		})
+
+		err = w.Wait()
+
+		// player is blocked by threads which stopped on error budget or shutdown
+		cancel()
+
+		if perr := <-played; err == nil {
+			err = perr
+		}
+
+		if err == nil && oracle != nil {
+			err = compare(c.Context, ref, db)
+		}
+
+		return errors.WithStack(err)
+	}
+}
+
+// maxMismatches printed by compare
+const maxMismatches = 20
+
+// compare diffs final balances of backend with oracle
+func compare(ctx context.Context, oracle *memory.Repo, db store.Store) error {
+	res, err := oracle.Compare(ctx, db)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	fmt.Printf("oracle: %d accounts, %d mismatches\n", len(oracle.Balances()), len(res))
+
+	for i, m := range res {
+		if i == maxMismatches {
+			fmt.Printf("... %d more\n", len(res)-maxMismatches)
+			break
+		}
+
+		if m.Missing {
+			fmt.Printf("account %d: missing, want %+v\n", m.Want.AccountID, m.Want)
+			continue
+		}
+
+		fmt.Printf("account %d: want %+v, got %+v\n", m.Want.AccountID, m.Want, m.Got)
+	}
+
+	if len(res) > 0 {
+		return errors.Errorf("%d accounts differ from oracle", len(res))
+	}
+
+	return nil
+}
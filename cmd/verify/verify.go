@@ -0,0 +1,86 @@
+package verify
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/d7561985/mongo-ab/pkg/ledger"
+	"github.com/d7561985/mongo-ab/pkg/store"
+	"github.com/pkg/errors"
+	"github.com/urfave/cli/v2"
+)
+
+const defMaxMismatches = 100
+
+const fMaxMismatches = "max-mismatches"
+
+const EnvMaxMismatches = "MAX_MISMATCHES"
+
+type verifyCommand struct{}
+
+func New() *cli.Command {
+	c := new(verifyCommand)
+
+	return &cli.Command{
+		Name:        "verify",
+		Usage:       "Check that balances agree with journal after run",
+		Description: "verify recomputes every account from journal records of transactions, compares them with balance and checks that running totals of journal form one chain per account",
+		Flags: []cli.Flag{
+			&cli.IntFlag{Name: fMaxMismatches, Value: defMaxMismatches, Usage: "Mismatches printed, 0 - all", EnvVars: []string{EnvMaxMismatches}},
+		},
+		Subcommands: c.subcommands(),
+	}
+}
+
+// subcommands verify every registered store which could be read in full, ephemeral one is always empty
+func (m *verifyCommand) subcommands() []*cli.Command {
+	var out []*cli.Command
+	for _, b := range store.Backends() {
+		if b.Ephemeral {
+			continue
+		}
+
+		out = append(out, &cli.Command{Name: b.Name, Usage: "Verify " + b.Name, Flags: b.Flags, Action: m.action(b)})
+	}
+
+	return out
+}
+
+func (m *verifyCommand) action(b store.Backend) cli.ActionFunc {
+	return func(c *cli.Context) error {
+		db, err := b.Open(c)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		defer db.Close(context.Background())
+
+		l, ok := db.(store.Ledger)
+		if !ok {
+			return errors.Errorf("%s doesn't support verification", b.Name)
+		}
+
+		rep, err := ledger.Verify(c.Context, l)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		limit := c.Int(fMaxMismatches)
+		for i, mm := range rep.Mismatches {
+			if limit > 0 && i == limit {
+				fmt.Printf("... %d more\n", len(rep.Mismatches)-limit)
+				break
+			}
+
+			fmt.Println(mm)
+		}
+
+		fmt.Println(rep)
+
+		if len(rep.Mismatches) > 0 {
+			return errors.Errorf("%d mismatches", len(rep.Mismatches))
+		}
+
+		return nil
+	}
+}
@@ -1,5 +1,10 @@
 package config
 
+import (
+	"github.com/d7561985/mongo-ab/pkg/funds"
+	"github.com/d7561985/mongo-ab/pkg/retry"
+)
+
 type Mongo struct {
 	Addr string
 	DB   string
@@ -9,6 +14,15 @@ type Mongo struct {
 	Indexes    string
 	Validation bool
 
+	// Idempotent applies UpdateTX of the same transactionId once
+	Idempotent bool
+
+	// Retry of UpdateTX transaction
+	Retry retry.Policy
+
+	// Funds is insufficient funds rule of UpdateTX and Revert
+	Funds funds.Mode
+
 	Collections struct {
 		// for increment operation
 		Balance string
@@ -36,6 +50,15 @@ type Mongo struct {
 
 type Postgres struct {
 	Addr string
+
+	// Idempotent applies UpdateTX of the same transactionId once
+	Idempotent bool
+
+	// Retry of UpdateTX transaction
+	Retry retry.Policy
+
+	// Funds is insufficient funds rule of UpdateTX and Revert
+	Funds funds.Mode
 	//DB   string
 
 	//Table struct {
@@ -7,10 +7,19 @@ import (
 	"os/signal"
 	"syscall"
 
-	"github.com/d7561985/mongo-ab/cmd/mongo"
+	"github.com/d7561985/mongo-ab/cmd/ab"
+	"github.com/d7561985/mongo-ab/cmd/agent"
+	"github.com/d7561985/mongo-ab/cmd/bench"
+	"github.com/d7561985/mongo-ab/cmd/coordinator"
+	"github.com/d7561985/mongo-ab/cmd/history"
 	mongoproduction "github.com/d7561985/mongo-ab/cmd/mongo-production"
 	mongoreport "github.com/d7561985/mongo-ab/cmd/mongo-report"
-	"github.com/d7561985/mongo-ab/cmd/postgres"
+	"github.com/d7561985/mongo-ab/cmd/replay"
+	"github.com/d7561985/mongo-ab/cmd/verify"
+	"github.com/d7561985/mongo-ab/pkg/store"
+	_ "github.com/d7561985/mongo-ab/pkg/store/memory"
+	_ "github.com/d7561985/mongo-ab/pkg/store/mongo"
+	_ "github.com/d7561985/mongo-ab/pkg/store/postgres"
 	"github.com/urfave/cli/v2" // imports as package "cli"
 )
 
@@ -32,13 +41,22 @@ func main() {
 		Name:  "mongo ab",
 		Usage: "Compliance benchmark",
 		Commands: []*cli.Command{
-			mongo.New(),
 			mongoproduction.Command(),
 			mongoreport.Command(),
-			postgres.New(),
+			agent.New(),
+			coordinator.New(),
+			replay.New(),
+			ab.New(bench.New),
+			verify.New(),
+			history.New(),
 		},
 	}
 
+	// every registered store gets its benchmark command
+	for _, b := range store.Backends() {
+		app.Commands = append(app.Commands, bench.New(b))
+	}
+
 	err := app.RunContext(ctx, os.Args)
 	if err != nil {
 		log.Fatal(err)
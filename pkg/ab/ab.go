@@ -0,0 +1,147 @@
+package ab
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/d7561985/mongo-ab/pkg/worker"
+)
+
+// Separator of configurations in command line
+const Separator = "--"
+
+// Run is result of single configuration
+type Run struct {
+	// Args is command line of configuration, e.g. mongo --compression zstd
+	Args    []string
+	Summary worker.Summary
+	// Storage is bytes of data and indexes after run, negative - unknown
+	Storage int64
+	Err     error
+}
+
+// ErrorRate is share of failed operations
+func (r Run) ErrorRate() float64 {
+	total := r.Summary.Ops + r.Summary.Failed
+	if total == 0 {
+		return 0
+	}
+
+	return float64(r.Summary.Failed) / float64(total)
+}
+
+// Split returns configurations of command line separated by Separator, empty ones are skipped
+func Split(args []string) [][]string {
+	var (
+		out [][]string
+		cur []string
+	)
+
+	for _, a := range append(args, Separator) {
+		if a != Separator {
+			cur = append(cur, a)
+			continue
+		}
+
+		if len(cur) > 0 {
+			out = append(out, cur)
+		}
+
+		cur = nil
+	}
+
+	return out
+}
+
+// WithSeed adds seed flag after command name unless configuration has its own
+func WithSeed(args []string, seed int64) []string {
+	for _, a := range args[1:] {
+		name := strings.SplitN(strings.TrimLeft(a, "-"), "=", 2)[0]
+		if strings.HasPrefix(a, "-") && name == "seed" {
+			return args
+		}
+	}
+
+	return append([]string{args[0], "--seed", strconv.FormatInt(seed, 10)}, args[1:]...)
+}
+
+// Table compares every run with the first one, relative delta follows value
+func Table(runs []Run) string {
+	b := &strings.Builder{}
+
+	fmt.Fprintln(b, "==== configurations ====")
+	for i, r := range runs {
+		status := ""
+		if r.Err != nil {
+			status = " | failed: " + r.Err.Error()
+		}
+
+		fmt.Fprintf(b, "#%d: %s%s\n", i+1, strings.Join(r.Args, " "), status)
+	}
+
+	fmt.Fprintln(b, "==== comparison ====")
+
+	w := tabwriter.NewWriter(b, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "config\tops\tcomb/sec\tp50\tp90\tp99\tp99.9\terror rate\tstorage")
+
+	base := runs[0]
+	for i, r := range runs {
+		s := r.Summary
+		fmt.Fprintf(w, "#%d\t%d\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", i+1, s.Ops,
+			compare(fmt.Sprintf("%.2f", s.Throughput), s.Throughput, base.Summary.Throughput, i),
+			duration(s.Latency.P50, base.Summary.Latency.P50, i),
+			duration(s.Latency.P90, base.Summary.Latency.P90, i),
+			duration(s.Latency.P99, base.Summary.Latency.P99, i),
+			duration(s.Latency.P999, base.Summary.Latency.P999, i),
+			compare(fmt.Sprintf("%.2f%%", r.ErrorRate()*100), r.ErrorRate(), base.ErrorRate(), i),
+			storage(r.Storage, base.Storage, i))
+	}
+
+	_ = w.Flush()
+
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+func duration(v, base time.Duration, i int) string {
+	return compare(v.Round(time.Microsecond).String(), float64(v), float64(base), i)
+}
+
+func storage(v, base int64, i int) string {
+	if v < 0 {
+		return "n/a"
+	}
+
+	if base < 0 {
+		return bytes(v)
+	}
+
+	return compare(bytes(v), float64(v), float64(base), i)
+}
+
+// compare adds relative delta to formatted value, baseline and zero base have none
+func compare(formatted string, v, base float64, i int) string {
+	if i == 0 || base == 0 {
+		return formatted
+	}
+
+	return fmt.Sprintf("%s (%+.1f%%)", formatted, (v-base)/base*100)
+}
+
+func bytes(v int64) string {
+	const unit = 1024
+
+	if v < unit {
+		return fmt.Sprintf("%d B", v)
+	}
+
+	f, exp := float64(v), 0
+	for f >= unit && exp < 4 {
+		f /= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f %ciB", f, "KMGT"[exp-1])
+}
@@ -0,0 +1,61 @@
+package ab
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/d7561985/mongo-ab/pkg/worker"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplit(t *testing.T) {
+	got := Split([]string{"mongo", "--compression", "zstd", "--", "--", "postgres", "--addr", "x", "--"})
+
+	assert.Equal(t, [][]string{{"mongo", "--compression", "zstd"}, {"postgres", "--addr", "x"}}, got)
+	assert.Empty(t, Split(nil))
+}
+
+func TestWithSeed(t *testing.T) {
+	assert.Equal(t, []string{"mongo", "--seed", "7", "-t", "5"}, WithSeed([]string{"mongo", "-t", "5"}, 7))
+	assert.Equal(t, []string{"mongo", "--seed=3"}, WithSeed([]string{"mongo", "--seed=3"}, 7))
+	assert.Equal(t, []string{"mongo", "-seed", "3"}, WithSeed([]string{"mongo", "-seed", "3"}, 7))
+}
+
+func TestTable(t *testing.T) {
+	runs := []Run{
+		{
+			Args:    []string{"mongo", "--compression", "snappy"},
+			Summary: worker.Summary{Ops: 1000, Failed: 10, Throughput: 100, Latency: worker.Latency{P50: time.Millisecond, P99: 4 * time.Millisecond}},
+			Storage: 2048,
+		},
+		{
+			Args:    []string{"mongo", "--compression", "zstd"},
+			Summary: worker.Summary{Ops: 1200, Throughput: 120, Latency: worker.Latency{P50: time.Millisecond / 2, P99: 6 * time.Millisecond}},
+			Storage: 1024,
+		},
+		{
+			Args:    []string{"postgres"},
+			Storage: -1,
+			Err:     errors.New("connection refused"),
+		},
+	}
+
+	out := Table(runs)
+
+	assert.Contains(t, out, "#1: mongo --compression snappy\n")
+	assert.Contains(t, out, "#3: postgres | failed: connection refused")
+	assert.Contains(t, out, "120.00 (+20.0%)")
+	assert.Contains(t, out, "500µs (-50.0%)")
+	assert.Contains(t, out, "6ms (+50.0%)")
+	assert.Contains(t, out, "0.99%")
+	assert.Contains(t, out, "0.00% (-100.0%)")
+	assert.Contains(t, out, "1.0 KiB (-50.0%)")
+	assert.Contains(t, out, "n/a")
+}
+
+func TestBytes(t *testing.T) {
+	assert.Equal(t, "512 B", bytes(512))
+	assert.Equal(t, "1.5 MiB", bytes(3<<19))
+	assert.Equal(t, "2.0 GiB", bytes(2<<30))
+}
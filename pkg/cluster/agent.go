@@ -0,0 +1,103 @@
+package cluster
+
+import (
+	"context"
+	"log"
+	"net"
+	"strings"
+	"sync/atomic"
+
+	"github.com/d7561985/mongo-ab/pkg/worker"
+	"github.com/pkg/errors"
+)
+
+// Runner runs workload command line locally until ctx is done
+type Runner func(ctx context.Context, args []string) error
+
+// Agent runs workloads received from coordinator, one at a time
+type Agent struct {
+	name string
+	run  Runner
+	busy int32
+}
+
+func NewAgent(name string, run Runner) *Agent {
+	return &Agent{name: name, run: run}
+}
+
+// Serve accepts coordinators on l until ctx is done
+func (a *Agent) Serve(ctx context.Context, l net.Listener) error {
+	go func() {
+		<-ctx.Done()
+		_ = l.Close()
+	}()
+
+	log.Printf("agent %s: listen %s", a.name, l.Addr())
+
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+
+			return errors.WithStack(err)
+		}
+
+		go func() {
+			defer c.Close()
+
+			if err := a.handle(ctx, newConn(c)); err != nil {
+				log.Printf("agent %s: coordinator %s: %v", a.name, c.RemoteAddr(), err)
+			}
+		}()
+	}
+}
+
+func (a *Agent) handle(ctx context.Context, c *conn) error {
+	var w Workload
+	if err := c.receive(&w); err != nil {
+		return err
+	}
+
+	if !atomic.CompareAndSwapInt32(&a.busy, 0, 1) {
+		return c.send(Ready{Agent: a.name, Err: "agent is busy with another workload"})
+	}
+
+	defer atomic.StoreInt32(&a.busy, 0)
+
+	if err := c.send(Ready{Agent: a.name}); err != nil {
+		return err
+	}
+
+	var cmd Command
+	if err := c.receive(&cmd); err != nil {
+		return err
+	}
+
+	if cmd.Kind != Start {
+		return errors.Errorf("unexpected command %q", cmd.Kind)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// any message or closed connection stops the run
+	go func() {
+		_ = c.receive(&cmd)
+		cancel()
+	}()
+
+	log.Printf("agent %s: run %s", a.name, strings.Join(w.Args, " "))
+
+	sink := &worker.Collector{}
+	rep := Report{Agent: a.name}
+
+	if err := a.run(worker.ContextWithSink(ctx, sink), w.Args); err != nil {
+		rep.Err = err.Error()
+	}
+
+	rep.Summary = sink.Merged()
+
+	return c.send(rep)
+}
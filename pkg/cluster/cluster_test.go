@@ -0,0 +1,87 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/d7561985/mongo-ab/pkg/worker"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func startAgent(t *testing.T, ctx context.Context, name string, run Runner) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	go func() { _ = NewAgent(name, run).Serve(ctx, l) }()
+
+	return l.Addr().String()
+}
+
+func iterations(ctx context.Context, args []string) error {
+	w := worker.New(&worker.Config{Threads: 2, Iterations: 50})
+	w.Run(ctx, func() error {
+		time.Sleep(time.Millisecond)
+		return nil
+	})
+
+	return w.Wait()
+}
+
+func TestCoordinate(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	agents := []string{
+		startAgent(t, ctx, "a", iterations),
+		startAgent(t, ctx, "b", iterations),
+		startAgent(t, ctx, "c", iterations),
+	}
+
+	res, err := Coordinate(ctx, agents, Workload{Args: []string{"test"}})
+	require.NoError(t, err)
+	require.NoError(t, res.Failed())
+
+	require.Len(t, res.Reports, 3)
+	assert.EqualValues(t, 300, res.Summary.Ops)
+	assert.EqualValues(t, 300, res.Summary.Histogram.Count())
+	assert.Greater(t, res.Summary.Latency.P50, time.Duration(0))
+}
+
+func TestCoordinateStop(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	endless := func(ctx context.Context, args []string) error {
+		w := worker.New(&worker.Config{Threads: 1})
+		w.Run(ctx, func() error {
+			time.Sleep(time.Millisecond)
+			return nil
+		})
+
+		return w.Wait()
+	}
+
+	agents := []string{startAgent(t, ctx, "a", endless), startAgent(t, ctx, "b", endless)}
+
+	runCtx, stop := context.WithTimeout(ctx, 300*time.Millisecond)
+	defer stop()
+
+	res, err := Coordinate(runCtx, agents, Workload{})
+	require.NoError(t, err)
+	assert.Greater(t, res.Summary.Ops, uint64(0))
+}
+
+func TestFailed(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	fail := func(context.Context, []string) error { return errors.New("no database") }
+
+	res, err := Coordinate(ctx, []string{startAgent(t, ctx, "a", fail)}, Workload{})
+	require.NoError(t, err)
+	assert.EqualError(t, res.Failed(), "agent a: no database")
+}
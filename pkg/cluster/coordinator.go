@@ -0,0 +1,137 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+
+	"github.com/d7561985/mongo-ab/pkg/worker"
+	"github.com/pkg/errors"
+)
+
+// Result of distributed run
+type Result struct {
+	Reports []Report
+	Summary worker.Summary
+}
+
+// Failed returns error of every agent whose workload failed
+func (r Result) Failed() error {
+	var out error
+	for _, rep := range r.Reports {
+		if rep.Err == "" {
+			continue
+		}
+
+		if out == nil {
+			out = fmt.Errorf("agent %s: %s", rep.Agent, rep.Err)
+			continue
+		}
+
+		out = fmt.Errorf("%v; agent %s: %s", out, rep.Agent, rep.Err)
+	}
+
+	return out
+}
+
+// Coordinate sends workload to every agent, starts them all together once everyone is ready
+// and merges their reports. Cancel of ctx stops agents, their partial reports are still collected.
+func Coordinate(ctx context.Context, agents []string, w Workload) (*Result, error) {
+	if len(agents) == 0 {
+		return nil, errors.New("no agents")
+	}
+
+	conns := make([]*conn, 0, len(agents))
+	defer func() {
+		for _, c := range conns {
+			_ = c.Close()
+		}
+	}()
+
+	d := net.Dialer{Timeout: DialTimeout}
+
+	for _, addr := range agents {
+		c, err := d.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return nil, errors.Wrapf(err, "agent %s", addr)
+		}
+
+		conns = append(conns, newConn(c))
+	}
+
+	for i, c := range conns {
+		if err := c.send(w); err != nil {
+			return nil, errors.Wrapf(err, "agent %s", agents[i])
+		}
+	}
+
+	for i, c := range conns {
+		var r Ready
+		if err := c.receive(&r); err != nil {
+			return nil, errors.Wrapf(err, "agent %s", agents[i])
+		}
+
+		if r.Err != "" {
+			return nil, errors.Errorf("agent %s: %s", agents[i], r.Err)
+		}
+
+		log.Printf("agent %s (%s) ready", r.Agent, agents[i])
+	}
+
+	for i, c := range conns {
+		if err := c.send(Command{Kind: Start}); err != nil {
+			return nil, errors.Wrapf(err, "agent %s", agents[i])
+		}
+	}
+
+	log.Printf("started %d agents", len(conns))
+
+	reports := make([]Report, len(conns))
+	errs := make([]error, len(conns))
+
+	done := make(chan struct{})
+	wg := sync.WaitGroup{}
+	wg.Add(len(conns))
+
+	for i, c := range conns {
+		go func(i int, c *conn) {
+			defer wg.Done()
+			errs[i] = c.receive(&reports[i])
+		}(i, c)
+	}
+
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		log.Printf("stop agents")
+
+		for _, c := range conns {
+			_ = c.send(Command{Kind: Stop})
+		}
+
+		<-done
+	}
+
+	res := &Result{}
+	summaries := make([]worker.Summary, 0, len(conns))
+
+	for i := range conns {
+		if errs[i] != nil {
+			return nil, errors.Wrapf(errs[i], "agent %s report", agents[i])
+		}
+
+		res.Reports = append(res.Reports, reports[i])
+		summaries = append(summaries, reports[i].Summary)
+	}
+
+	res.Summary = worker.Merge(summaries...)
+
+	return res, nil
+}
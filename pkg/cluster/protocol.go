@@ -0,0 +1,67 @@
+package cluster
+
+import (
+	"encoding/gob"
+	"net"
+	"time"
+
+	"github.com/d7561985/mongo-ab/pkg/worker"
+	"github.com/pkg/errors"
+)
+
+// Conversation over single TCP connection, every message is gob encoded:
+//
+//	coordinator -> agent: Workload
+//	agent -> coordinator: Ready
+//	coordinator -> agent: Command{Start}
+//	coordinator -> agent: Command{Stop}, optional when run is interrupted
+//	agent -> coordinator: Report
+
+// Workload is command line of benchmark which agent runs locally, e.g. "mongo --threads 50"
+type Workload struct {
+	Args []string
+}
+
+// Ready is agent's answer to Workload, Err is not empty when agent refused it
+type Ready struct {
+	Agent string
+	Err   string
+}
+
+type Command struct {
+	Kind string
+}
+
+const (
+	Start = "start"
+	Stop  = "stop"
+)
+
+// Report of finished workload
+type Report struct {
+	Agent   string
+	Summary worker.Summary
+	Err     string
+}
+
+// DialTimeout for connecting agents
+const DialTimeout = 10 * time.Second
+
+type conn struct {
+	net.Conn
+
+	enc *gob.Encoder
+	dec *gob.Decoder
+}
+
+func newConn(c net.Conn) *conn {
+	return &conn{Conn: c, enc: gob.NewEncoder(c), dec: gob.NewDecoder(c)}
+}
+
+func (c *conn) send(v interface{}) error {
+	return errors.WithStack(c.enc.Encode(v))
+}
+
+func (c *conn) receive(v interface{}) error {
+	return errors.WithStack(c.dec.Decode(v))
+}
@@ -0,0 +1,184 @@
+package errclass
+
+import (
+	"context"
+	"errors"
+	"net"
+
+	"github.com/d7561985/mongo-ab/pkg/fault"
+	"github.com/d7561985/mongo-ab/pkg/store"
+	"github.com/jackc/pgconn"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type Class string
+
+const (
+	WriteConflict        Class = "write_conflict"
+	TransientTransaction Class = "transient_transaction"
+	UnknownCommitResult  Class = "unknown_commit_result"
+	Timeout              Class = "timeout"
+	DuplicateKey         Class = "duplicate_key"
+	Serialization        Class = "serialization_failure"
+	Validation           Class = "validation"
+	Network              Class = "network"
+	Canceled             Class = "canceled"
+	Injected             Class = "injected"
+	Reverted             Class = "already_reverted"
+	InsufficientFunds    Class = "insufficient_funds"
+	Other                Class = "other"
+)
+
+// Classes in report order
+var Classes = []Class{
+	WriteConflict, TransientTransaction, UnknownCommitResult, Timeout, DuplicateKey,
+	Serialization, Validation, Network, Canceled, Injected, Reverted, InsufficientFunds, Other,
+}
+
+// Rejections are refusals of business rule, they are counted apart from failures and don't spend error budget.
+// Revert which lost race to revert the same record is one of them.
+var Rejections = []Class{Reverted, InsufficientFunds}
+
+// Rejection reports whether class is one of Rejections
+func (c Class) Rejection() bool {
+	for _, r := range Rejections {
+		if r == c {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ErrValidation should be wrapped by application side checks of request
+var ErrValidation = errors.New("validation")
+
+// mongo server codes
+const (
+	codeWriteConflict      = 112
+	codeDocumentValidation = 121
+)
+
+// postgres SQLSTATE codes
+const (
+	stateSerialization   = "40001"
+	stateDeadlock        = "40P01"
+	stateUniqueViolation = "23505"
+	stateCheckViolation  = "23514"
+	stateNotNull         = "23502"
+	stateQueryCanceled   = "57014"
+)
+
+const (
+	labelTransientTransaction = "TransientTransactionError"
+	labelUnknownCommitResult  = "UnknownTransactionCommitResult"
+)
+
+// Of returns class of err, nil error has empty class.
+// The most specific class wins: WriteConflict is also labeled as TransientTransactionError.
+func Of(err error) Class {
+	if err == nil {
+		return ""
+	}
+
+	// rejection of funds check wraps error of constraint which refused write
+	if errors.Is(err, store.ErrInsufficientFunds) {
+		return InsufficientFunds
+	}
+
+	if errors.Is(err, ErrValidation) {
+		return Validation
+	}
+
+	// concurrent revert of the same record won
+	if errors.Is(err, store.ErrReverted) {
+		return Reverted
+	}
+
+	// aborts of fault are classified as errors of store they imitate
+	if errors.Is(err, fault.ErrInjected) {
+		return Injected
+	}
+
+	if c, ok := ofMongo(err); ok {
+		return c
+	}
+
+	if c, ok := ofPostgres(err); ok {
+		return c
+	}
+
+	if errors.Is(err, context.Canceled) {
+		return Canceled
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) || mongo.IsTimeout(err) {
+		return Timeout
+	}
+
+	var ne net.Error
+	if errors.As(err, &ne) {
+		if ne.Timeout() {
+			return Timeout
+		}
+
+		return Network
+	}
+
+	if mongo.IsNetworkError(err) {
+		return Network
+	}
+
+	return Other
+}
+
+func ofMongo(err error) (Class, bool) {
+	var se mongo.ServerError
+	if !errors.As(err, &se) {
+		return "", false
+	}
+
+	switch {
+	case se.HasErrorCode(codeWriteConflict):
+		return WriteConflict, true
+	case mongo.IsDuplicateKeyError(err):
+		return DuplicateKey, true
+	case se.HasErrorCode(codeDocumentValidation):
+		return Validation, true
+	case se.HasErrorLabel(labelUnknownCommitResult):
+		return UnknownCommitResult, true
+	case se.HasErrorLabel(labelTransientTransaction):
+		return TransientTransaction, true
+	case mongo.IsTimeout(err):
+		return Timeout, true
+	case mongo.IsNetworkError(err):
+		return Network, true
+	}
+
+	return "", false
+}
+
+func ofPostgres(err error) (Class, bool) {
+	var pe *pgconn.PgError
+	if !errors.As(err, &pe) {
+		return "", false
+	}
+
+	switch pe.Code {
+	case stateSerialization, stateDeadlock:
+		return Serialization, true
+	case stateUniqueViolation:
+		return DuplicateKey, true
+	case stateCheckViolation, stateNotNull:
+		return Validation, true
+	case stateQueryCanceled:
+		return Timeout, true
+	}
+
+	// data exceptions
+	if len(pe.Code) == 5 && pe.Code[:2] == "22" {
+		return Validation, true
+	}
+
+	return Other, true
+}
@@ -0,0 +1,50 @@
+package errclass
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/d7561985/mongo-ab/pkg/fault"
+	"github.com/d7561985/mongo-ab/pkg/store"
+	"github.com/jackc/pgconn"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestOf(t *testing.T) {
+	tests := []struct {
+		err  error
+		want Class
+	}{
+		{nil, ""},
+		{mongo.CommandError{Code: 112, Labels: []string{"TransientTransactionError"}}, WriteConflict},
+		{mongo.CommandError{Code: 251, Labels: []string{"TransientTransactionError"}}, TransientTransaction},
+		{mongo.CommandError{Code: 50, Labels: []string{"UnknownTransactionCommitResult"}}, UnknownCommitResult},
+		{mongo.WriteException{WriteErrors: mongo.WriteErrors{{Code: 11000}}}, DuplicateKey},
+		{mongo.WriteException{WriteErrors: mongo.WriteErrors{{Code: 121}}}, Validation},
+		{&pgconn.PgError{Code: "40001"}, Serialization},
+		{&pgconn.PgError{Code: "23505"}, DuplicateKey},
+		{&pgconn.PgError{Code: "23514"}, Validation},
+		{&pgconn.PgError{Code: "22003"}, Validation},
+		{&pgconn.PgError{Code: "57014"}, Timeout},
+		{context.DeadlineExceeded, Timeout},
+		{context.Canceled, Canceled},
+		{fmt.Errorf("%w: negative amount", ErrValidation), Validation},
+		{fmt.Errorf("panic: %w", fault.ErrInjected), Injected},
+		{store.ErrReverted, Reverted},
+		{store.ErrInsufficientFunds, InsufficientFunds},
+		{errors.Wrap(store.ErrInsufficientFunds, (&pgconn.PgError{Code: "23514"}).Error()), InsufficientFunds},
+		{errors.New("boom"), Other},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.want, Of(test.err), "%v", test.err)
+		assert.Equal(t, test.want, Of(errors.WithStack(test.err)), "wrapped %v", test.err)
+	}
+
+	assert.True(t, InsufficientFunds.Rejection())
+	assert.True(t, Reverted.Rejection())
+	assert.False(t, Validation.Rejection())
+}
@@ -0,0 +1,243 @@
+package fault
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Point is placeholder inside UpdateTX of store where hooks are called
+type Point string
+
+// Placeholders of UpdateTX and Revert in order of calls, the same for every store
+const (
+	// UpdateBeforeLock is before transaction begins
+	UpdateBeforeLock Point = "update.before-lock"
+	// UpdateAfterUpsert is after balance increment inside transaction
+	UpdateAfterUpsert Point = "update.after-upsert"
+	// UpdateBeforeJournal is before journal insert inside transaction
+	UpdateBeforeJournal Point = "update.before-journal"
+	// UpdateBeforeCommit is after all writes of transaction, before commit
+	UpdateBeforeCommit Point = "update.before-commit"
+	// UpdateDefer is after commit or rollback, error of hook replaces result of committed transaction
+	UpdateDefer Point = "update.defer"
+)
+
+// Points in order of calls
+var Points = []Point{UpdateBeforeLock, UpdateAfterUpsert, UpdateBeforeJournal, UpdateBeforeCommit, UpdateDefer}
+
+// Kind of fault
+type Kind string
+
+const (
+	// Latency sleeps for duration of fault
+	Latency Kind = "latency"
+	// Error fails operation with ErrInjected
+	Error Kind = "error"
+	// Abort fails transaction with ErrAbort, store turns it into its retryable transaction error
+	Abort Kind = "abort"
+	// Panic panics with ErrInjected
+	Panic Kind = "panic"
+)
+
+var (
+	// ErrInjected is error and panic of fault
+	ErrInjected = errors.New("injected fault")
+	// ErrAbort is abort of fault
+	ErrAbort = errors.New("injected abort")
+)
+
+// Hook is called at placeholder, error of hook fails operation
+type Hook func(ctx context.Context) error
+
+// Injectable is store with placeholders
+type Injectable interface {
+	AddHook(p Point, fn Hook)
+}
+
+// Hooks of placeholders, it is safe for concurrent use
+type Hooks struct {
+	mu sync.RWMutex
+	m  map[Point][]Hook
+}
+
+// Add appends fn to hooks of p
+func (h *Hooks) Add(p Point, fn Hook) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.m == nil {
+		h.m = make(map[Point][]Hook)
+	}
+
+	h.m[p] = append(h.m[p], fn)
+}
+
+// Call runs hooks of p in order of adding and stops at the first error
+func (h *Hooks) Call(ctx context.Context, p Point) error {
+	h.mu.RLock()
+	hooks := h.m[p]
+	h.mu.RUnlock()
+
+	for _, fn := range hooks {
+		if err := fn(ctx); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Fault happens at point with probability
+type Fault struct {
+	Point       Point
+	Kind        Kind
+	Probability float64
+	// Latency of Latency kind
+	Latency time.Duration
+}
+
+func (f Fault) String() string {
+	s := fmt.Sprintf("%s:%s:%g", f.Point, f.Kind, f.Probability)
+	if f.Kind == Latency {
+		s += ":" + f.Latency.String()
+	}
+
+	return s
+}
+
+// Hook returns hook which applies fault, the same seed gives the same sequence of hits
+func (f Fault) Hook(seed int64) Hook {
+	var (
+		mu sync.Mutex
+		r  = rand.New(rand.NewSource(seed))
+	)
+
+	return func(ctx context.Context) error {
+		mu.Lock()
+		hit := r.Float64() < f.Probability
+		mu.Unlock()
+
+		if !hit {
+			return nil
+		}
+
+		switch f.Kind {
+		case Latency:
+			t := time.NewTimer(f.Latency)
+			defer t.Stop()
+
+			select {
+			case <-t.C:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		case Error:
+			return fmt.Errorf("%s: %w", f.Point, ErrInjected)
+		case Abort:
+			return fmt.Errorf("%s: %w", f.Point, ErrAbort)
+		case Panic:
+			panic(fmt.Errorf("%s: %w", f.Point, ErrInjected))
+		}
+
+		return nil
+	}
+}
+
+// Parse reads comma separated faults point:kind:probability[:latency],
+// e.g. update.after-upsert:latency:0.1:20ms,update.before-commit:abort:0.01
+func Parse(in string) ([]Fault, error) {
+	var out []Fault
+
+	for _, item := range strings.Split(in, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		f, err := parse(item)
+		if err != nil {
+			return nil, fmt.Errorf("fault %q: %w", item, err)
+		}
+
+		out = append(out, f)
+	}
+
+	return out, nil
+}
+
+func parse(in string) (Fault, error) {
+	parts := strings.Split(in, ":")
+	if len(parts) < 3 {
+		return Fault{}, errors.New("want point:kind:probability[:latency]")
+	}
+
+	f := Fault{Point: Point(parts[0]), Kind: Kind(parts[1])}
+	if !known(f.Point) {
+		return Fault{}, fmt.Errorf("unknown point, want one of %v", Points)
+	}
+
+	p, err := strconv.ParseFloat(parts[2], 64)
+	if err != nil || p < 0 || p > 1 {
+		return Fault{}, errors.New("probability should be in [0, 1]")
+	}
+
+	f.Probability = p
+
+	switch f.Kind {
+	case Latency:
+		if len(parts) != 4 {
+			return Fault{}, errors.New("latency needs duration")
+		}
+
+		if f.Latency, err = time.ParseDuration(parts[3]); err != nil || f.Latency <= 0 {
+			return Fault{}, errors.New("latency should be positive duration")
+		}
+	case Error, Abort, Panic:
+		if len(parts) != 3 {
+			return Fault{}, fmt.Errorf("%s has no duration", f.Kind)
+		}
+	default:
+		return Fault{}, errors.New("unknown kind, want latency, error, abort or panic")
+	}
+
+	return f, nil
+}
+
+func known(p Point) bool {
+	for _, v := range Points {
+		if v == p {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Inject adds hooks of faults to store, every fault has own source of seed
+func Inject(s Injectable, faults []Fault, seed int64) {
+	for i, f := range faults {
+		s.AddHook(f.Point, f.Hook(seed+int64(i)))
+	}
+}
+
+// Recover runs fn and returns panic of it as error, so injected panic fails single operation
+func Recover(fn func() error) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			if e, ok := p.(error); ok {
+				err = fmt.Errorf("panic: %w", e)
+			} else {
+				err = fmt.Errorf("panic: %v", p)
+			}
+		}
+	}()
+
+	return fn()
+}
@@ -0,0 +1,117 @@
+package fault
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	faults, err := Parse("update.after-upsert:latency:0.1:20ms, update.before-commit:abort:0.01,update.defer:panic:1")
+	require.NoError(t, err)
+	assert.Equal(t, []Fault{
+		{Point: UpdateAfterUpsert, Kind: Latency, Probability: 0.1, Latency: 20 * time.Millisecond},
+		{Point: UpdateBeforeCommit, Kind: Abort, Probability: 0.01},
+		{Point: UpdateDefer, Kind: Panic, Probability: 1},
+	}, faults)
+	assert.Equal(t, "update.after-upsert:latency:0.1:20ms", faults[0].String())
+
+	faults, err = Parse("")
+	require.NoError(t, err)
+	assert.Empty(t, faults)
+
+	for _, in := range []string{
+		"update.after-upsert",
+		"update.nowhere:error:0.1",
+		"update.after-upsert:crash:0.1",
+		"update.after-upsert:error:2",
+		"update.after-upsert:error:0.1:1s",
+		"update.after-upsert:latency:0.1",
+		"update.after-upsert:latency:0.1:-1s",
+	} {
+		_, err = Parse(in)
+		assert.Error(t, err, in)
+	}
+}
+
+func TestHook(t *testing.T) {
+	ctx := context.Background()
+
+	assert.NoError(t, Fault{Point: UpdateDefer, Kind: Error, Probability: 0}.Hook(1)(ctx))
+	assert.ErrorIs(t, Fault{Point: UpdateDefer, Kind: Error, Probability: 1}.Hook(1)(ctx), ErrInjected)
+	assert.ErrorIs(t, Fault{Point: UpdateDefer, Kind: Abort, Probability: 1}.Hook(1)(ctx), ErrAbort)
+
+	start := time.Now()
+	assert.NoError(t, Fault{Point: UpdateDefer, Kind: Latency, Probability: 1, Latency: 10 * time.Millisecond}.Hook(1)(ctx))
+	assert.GreaterOrEqual(t, time.Since(start), 10*time.Millisecond)
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	assert.ErrorIs(t, Fault{Point: UpdateDefer, Kind: Latency, Probability: 1, Latency: time.Hour}.Hook(1)(canceled), context.Canceled)
+
+	err := Recover(func() error { return Fault{Point: UpdateDefer, Kind: Panic, Probability: 1}.Hook(1)(ctx) })
+	assert.ErrorIs(t, err, ErrInjected)
+	assert.Contains(t, err.Error(), "panic: update.defer")
+}
+
+func TestHookSeed(t *testing.T) {
+	f := Fault{Point: UpdateDefer, Kind: Error, Probability: 0.5}
+	a, b := f.Hook(7), f.Hook(7)
+
+	hits := 0
+	for i := 0; i < 100; i++ {
+		errA, errB := a(context.Background()), b(context.Background())
+		require.Equal(t, errA, errB, "call %d", i)
+
+		if errA != nil {
+			hits++
+		}
+	}
+
+	assert.InDelta(t, 50, hits, 20)
+}
+
+func TestHooks(t *testing.T) {
+	var (
+		h     Hooks
+		calls int64
+		boom  = errors.New("boom")
+	)
+
+	assert.NoError(t, h.Call(context.Background(), UpdateBeforeLock))
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+
+		go func() {
+			defer wg.Done()
+			h.Add(UpdateBeforeLock, func(context.Context) error {
+				atomic.AddInt64(&calls, 1)
+				return nil
+			})
+		}()
+
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, h.Call(context.Background(), UpdateBeforeLock))
+		}()
+	}
+
+	wg.Wait()
+
+	atomic.StoreInt64(&calls, 0)
+	require.NoError(t, h.Call(context.Background(), UpdateBeforeLock))
+	assert.Equal(t, int64(8), atomic.LoadInt64(&calls))
+
+	// the first error stops the rest
+	h.Add(UpdateAfterUpsert, func(context.Context) error { return boom })
+	h.Add(UpdateAfterUpsert, func(context.Context) error { panic("unreachable") })
+	assert.ErrorIs(t, h.Call(context.Background(), UpdateAfterUpsert), boom)
+}
@@ -0,0 +1,76 @@
+package funds
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+)
+
+// Mode of insufficient funds rule: how store refuses transaction which takes balance below zero
+type Mode string
+
+const (
+	// Off applies every transaction, balance could go negative
+	Off Mode = "off"
+	// Constraint is rule of schema: CHECK constraint of postgres, $jsonSchema validator of mongo
+	Constraint Mode = "db-constraint"
+	// Conditional is filter of balance update: decrement is applied when balance covers it
+	Conditional Mode = "conditional-update"
+	// Application reads balance in transaction and checks decrement before update
+	Application Mode = "application"
+)
+
+// Modes in order of help
+var Modes = []Mode{Off, Constraint, Conditional, Application}
+
+const fCheck = "funds-check"
+
+const EnvCheck = "FUNDS_CHECK"
+
+// Flags of Mode shared by stores
+func Flags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{Name: fCheck, Value: string(Off), Usage: "Insufficient funds rule: " + names() + ", refused transaction fails with insufficient funds", EnvVars: []string{EnvCheck}},
+	}
+}
+
+// Get reads Mode of Flags, it is checked by Validate
+func Get(c *cli.Context) Mode {
+	return Mode(c.String(fCheck))
+}
+
+// Validate returns error of unknown mode, empty one is Off
+func (m Mode) Validate() error {
+	if m == "" {
+		return nil
+	}
+
+	for _, v := range Modes {
+		if v == m {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("unknown funds check %q, use %s", m, names())
+}
+
+// Enabled reports whether transactions are checked
+func (m Mode) Enabled() bool {
+	return m != "" && m != Off
+}
+
+// Refuses reports whether decrement inc of balance is refused: it takes balance below zero.
+// Increments are never refused, so that account which is already negative could be topped up.
+func (m Mode) Refuses(balance, inc float64) bool {
+	return m.Enabled() && inc < 0 && balance+inc < 0
+}
+
+func names() string {
+	out := make([]string, 0, len(Modes))
+	for _, m := range Modes {
+		out = append(out, string(m))
+	}
+
+	return strings.Join(out, ", ")
+}
@@ -0,0 +1,36 @@
+package funds
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidate(t *testing.T) {
+	for _, m := range Modes {
+		assert.NoError(t, m.Validate())
+	}
+
+	assert.NoError(t, Mode("").Validate())
+	assert.False(t, Mode("").Enabled())
+	assert.Error(t, Mode("strict").Validate())
+}
+
+func TestRefuses(t *testing.T) {
+	tests := []struct {
+		mode         Mode
+		balance, inc float64
+		want         bool
+	}{
+		{mode: Off, balance: 10, inc: -20},
+		{mode: Application, balance: 10, inc: -10},
+		{mode: Application, balance: 10, inc: -20, want: true},
+		{mode: Conditional, balance: 0, inc: -0.01, want: true},
+		// negative account is topped up
+		{mode: Constraint, balance: -10, inc: 5},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.want, test.mode.Refuses(test.balance, test.inc), "%+v", test)
+	}
+}
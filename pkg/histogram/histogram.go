@@ -0,0 +1,239 @@
+package histogram
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/bits"
+	"sync/atomic"
+	"time"
+)
+
+// log-linear layout (HDR-style): values below 1<<subBits are stored exactly,
+// every following power of two is split into 1<<(subBits-1) equal buckets,
+// which keeps relative error under 1% for any value.
+const (
+	subBits    = 8
+	subCount   = 1 << subBits
+	halfCount  = subCount / 2
+	bucketsNum = subCount + (64-subBits)*halfCount
+)
+
+// Histogram records latencies in nanoseconds.
+// Record is safe for concurrent use, all other methods are intended for snapshots.
+type Histogram struct {
+	counts [bucketsNum]uint64
+
+	total uint64
+	sum   uint64
+	max   int64
+}
+
+func New() *Histogram {
+	return &Histogram{}
+}
+
+func (h *Histogram) Record(d time.Duration) {
+	v := int64(d)
+	if v < 0 {
+		v = 0
+	}
+
+	atomic.AddUint64(&h.counts[index(uint64(v))], 1)
+	atomic.AddUint64(&h.total, 1)
+	atomic.AddUint64(&h.sum, uint64(v))
+
+	for {
+		m := atomic.LoadInt64(&h.max)
+		if v <= m || atomic.CompareAndSwapInt64(&h.max, m, v) {
+			return
+		}
+	}
+}
+
+// Snapshot returns consistent enough copy of histogram which could be read without atomics
+func (h *Histogram) Snapshot() *Histogram {
+	out := New()
+
+	for i := range h.counts {
+		out.counts[i] = atomic.LoadUint64(&h.counts[i])
+	}
+
+	out.total = atomic.LoadUint64(&h.total)
+	out.sum = atomic.LoadUint64(&h.sum)
+	out.max = atomic.LoadInt64(&h.max)
+
+	return out
+}
+
+// Merge adds o into h. Not safe for concurrent use.
+func (h *Histogram) Merge(o *Histogram) {
+	for i, v := range o.counts {
+		h.counts[i] += v
+	}
+
+	h.total += o.total
+	h.sum += o.sum
+
+	if o.max > h.max {
+		h.max = o.max
+	}
+}
+
+// Sub returns values recorded in h after prev snapshot was taken.
+// Max of result is approximated by the highest not empty bucket.
+func (h *Histogram) Sub(prev *Histogram) *Histogram {
+	out := New()
+
+	top := -1
+	for i := range h.counts {
+		out.counts[i] = h.counts[i] - prev.counts[i]
+		if out.counts[i] > 0 {
+			top = i
+		}
+	}
+
+	out.total = h.total - prev.total
+	out.sum = h.sum - prev.sum
+
+	if top >= 0 {
+		out.max = int64(upper(top))
+		if out.max > h.max {
+			out.max = h.max
+		}
+	}
+
+	return out
+}
+
+func (h *Histogram) Count() uint64 {
+	return h.total
+}
+
+func (h *Histogram) Max() time.Duration {
+	return time.Duration(h.max)
+}
+
+func (h *Histogram) Mean() time.Duration {
+	if h.total == 0 {
+		return 0
+	}
+
+	return time.Duration(h.sum / h.total)
+}
+
+// Percentile returns value for q in range [0, 100]
+func (h *Histogram) Percentile(q float64) time.Duration {
+	if h.total == 0 {
+		return 0
+	}
+
+	rank := uint64(math.Ceil(q / 100 * float64(h.total)))
+	if rank == 0 {
+		rank = 1
+	}
+
+	var seen uint64
+	for i, v := range h.counts {
+		seen += v
+		if seen >= rank {
+			val := time.Duration(upper(i))
+			if val > h.Max() {
+				return h.Max()
+			}
+
+			return val
+		}
+	}
+
+	return h.Max()
+}
+
+func index(v uint64) int {
+	if v < subCount {
+		return int(v)
+	}
+
+	shift := bits.Len64(v) - subBits
+	top := v >> uint(shift)
+
+	return subCount + (shift-1)*halfCount + int(top-halfCount)
+}
+
+// upper returns highest value which belongs to bucket i
+func upper(i int) uint64 {
+	if i < subCount {
+		return uint64(i)
+	}
+
+	shift := (i-subCount)/halfCount + 1
+	top := uint64((i-subCount)%halfCount + halfCount)
+
+	return (top+1)<<uint(shift) - 1
+}
+
+// MarshalBinary encodes not empty buckets only, so histogram could be sent over the wire and merged
+func (h *Histogram) MarshalBinary() ([]byte, error) {
+	s := h.Snapshot()
+
+	out := &bytes.Buffer{}
+	buf := make([]byte, binary.MaxVarintLen64)
+
+	put := func(v uint64) {
+		out.Write(buf[:binary.PutUvarint(buf, v)])
+	}
+
+	put(s.total)
+	put(s.sum)
+	put(uint64(s.max))
+
+	for i, v := range s.counts {
+		if v == 0 {
+			continue
+		}
+
+		put(uint64(i))
+		put(v)
+	}
+
+	return out.Bytes(), nil
+}
+
+func (h *Histogram) UnmarshalBinary(data []byte) error {
+	*h = Histogram{}
+
+	r := bytes.NewReader(data)
+
+	var head [3]uint64
+	for i := range head {
+		v, err := binary.ReadUvarint(r)
+		if err != nil {
+			return fmt.Errorf("histogram header: %w", err)
+		}
+
+		head[i] = v
+	}
+
+	h.total, h.sum, h.max = head[0], head[1], int64(head[2])
+
+	for r.Len() > 0 {
+		i, err := binary.ReadUvarint(r)
+		if err != nil {
+			return fmt.Errorf("histogram bucket: %w", err)
+		}
+
+		v, err := binary.ReadUvarint(r)
+		if err != nil {
+			return fmt.Errorf("histogram bucket: %w", err)
+		}
+
+		if i >= bucketsNum {
+			return fmt.Errorf("histogram bucket %d out of range", i)
+		}
+
+		h.counts[i] = v
+	}
+
+	return nil
+}
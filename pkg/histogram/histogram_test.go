@@ -0,0 +1,85 @@
+package histogram
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPercentile(t *testing.T) {
+	h := New()
+	for i := 1; i <= 10_000; i++ {
+		h.Record(time.Duration(i) * time.Microsecond)
+	}
+
+	require.EqualValues(t, 10_000, h.Count())
+	assert.Equal(t, 10*time.Millisecond, h.Max())
+
+	tests := []struct {
+		q    float64
+		want time.Duration
+	}{
+		{50, 5 * time.Millisecond},
+		{90, 9 * time.Millisecond},
+		{99, 9900 * time.Microsecond},
+		{99.9, 9990 * time.Microsecond},
+		{100, 10 * time.Millisecond},
+	}
+
+	for _, test := range tests {
+		got := h.Percentile(test.q)
+		assert.InEpsilon(t, float64(test.want), float64(got), 0.01, "p%v", test.q)
+	}
+}
+
+func TestMergeSub(t *testing.T) {
+	a, b := New(), New()
+	for i := 0; i < 100; i++ {
+		a.Record(time.Millisecond)
+		b.Record(time.Second)
+	}
+
+	prev := a.Snapshot()
+
+	a.Merge(b)
+	assert.EqualValues(t, 200, a.Count())
+	assert.Equal(t, time.Second, a.Max())
+
+	diff := a.Sub(prev)
+	assert.EqualValues(t, 100, diff.Count())
+	assert.InEpsilon(t, float64(time.Second), float64(diff.Percentile(50)), 0.01)
+	assert.Equal(t, time.Second, diff.Max())
+}
+
+func TestIndex(t *testing.T) {
+	for _, v := range []uint64{0, 1, 255, 256, 257, 1 << 20, 1<<20 + 12345, 1 << 40} {
+		i := index(v)
+		assert.LessOrEqual(t, v, upper(i), "value %d", v)
+
+		if i > 0 {
+			assert.Greater(t, v, upper(i-1), "value %d", v)
+		}
+	}
+}
+
+func TestMarshalBinary(t *testing.T) {
+	h := New()
+	for i := 1; i <= 1000; i++ {
+		h.Record(time.Duration(i) * time.Millisecond)
+	}
+
+	b, err := h.MarshalBinary()
+	require.NoError(t, err)
+
+	got := New()
+	require.NoError(t, got.UnmarshalBinary(b))
+
+	assert.Equal(t, h.Count(), got.Count())
+	assert.Equal(t, h.Max(), got.Max())
+	assert.Equal(t, h.Mean(), got.Mean())
+	assert.Equal(t, h.Percentile(99), got.Percentile(99))
+
+	assert.Error(t, got.UnmarshalBinary(b[:len(b)-1]))
+}
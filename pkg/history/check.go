@@ -0,0 +1,259 @@
+package history
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/d7561985/mongo-ab/pkg/changing"
+	"github.com/d7561985/mongo-ab/pkg/ledger"
+	"github.com/d7561985/mongo-ab/pkg/store"
+)
+
+// Kinds of anomalies
+const (
+	// LostUpdate is two writes which were applied to the same state
+	LostUpdate = "lost-update"
+	// BrokenChain is write whose state before it no other write produced
+	BrokenChain = "broken-chain"
+	// DuplicatePost is two writes which grow monotone totals but returned the same post-balance
+	DuplicatePost = "duplicate-post-balance"
+	// NonMonotonic is write which started after another one completed but precedes it in order of states
+	NonMonotonic = "non-monotonic"
+	// UncommittedRead is read of state no successful write produced, e.g. of aborted transaction
+	UncommittedRead = "uncommitted-read"
+	// FutureRead is read of state of write which started after the read completed
+	FutureRead = "future-read"
+	// StaleRead is read of state older than state of write which completed before the read started
+	StaleRead = "stale-read"
+)
+
+// Anomaly of single account
+type Anomaly struct {
+	Account uint64
+	Kind    string
+	Detail  string
+}
+
+func (a Anomaly) String() string {
+	return fmt.Sprintf("account %d: %s: %s", a.Account, a.Kind, a.Detail)
+}
+
+// Report of check
+type Report struct {
+	Accounts int
+	Writes   int
+	Reads    int
+	// Failed operations, outcome of failed write is unknown, it could break chain of account
+	Failed    int
+	Anomalies []Anomaly
+}
+
+func (r Report) String() string {
+	return fmt.Sprintf("checked %d accounts, %d writes, %d reads, %d failed: %d anomalies",
+		r.Accounts, r.Writes, r.Reads, r.Failed, len(r.Anomalies))
+}
+
+// Check looks for violations of per-account serializability in history.
+// Successful writes of account must form one chain of states, see ledger.Chain, which agrees with real time,
+// and every read must return state of this chain which is not older than writes completed before it.
+func Check(events []Event) Report {
+	var rep Report
+
+	byAccount := make(map[uint64][]Event)
+	for _, e := range events {
+		byAccount[e.Account] = append(byAccount[e.Account], e)
+
+		switch {
+		case e.Err != "":
+			rep.Failed++
+		case e.Kind == Write:
+			rep.Writes++
+		case e.Kind == Read:
+			rep.Reads++
+		}
+	}
+
+	accounts := make([]uint64, 0, len(byAccount))
+	for id := range byAccount {
+		accounts = append(accounts, id)
+	}
+
+	sort.Slice(accounts, func(i, j int) bool { return accounts[i] < accounts[j] })
+	rep.Accounts = len(accounts)
+
+	for _, id := range accounts {
+		rep.Anomalies = append(rep.Anomalies, account(id, byAccount[id])...)
+	}
+
+	return rep
+}
+
+// state is balance without account, it is key of post-balance
+type state struct {
+	Balance        float64
+	DepositAllSum  float64
+	DepositCount   uint64
+	PincoinBalance float64
+	PincoinsAllSum float64
+}
+
+func stateOf(b store.Balance) state {
+	return state{b.Balance, b.DepositAllSum, b.DepositCount, b.PincoinBalance, b.PincoinsAllSum}
+}
+
+func account(id uint64, events []Event) []Anomaly {
+	var (
+		out     []Anomaly
+		writes  []Event
+		entries []store.Entry
+		failed  int
+		reverts bool
+	)
+
+	add := func(kind, format string, args ...interface{}) {
+		out = append(out, Anomaly{Account: id, Kind: kind, Detail: fmt.Sprintf(format, args...)})
+	}
+
+	// redelivery to idempotent store returns recorded post-balance of transaction
+	delivered := make(map[uint64]state)
+
+	for _, e := range events {
+		switch {
+		case e.Err != "":
+			if e.Kind == Write {
+				failed++
+			}
+		// write which changes nothing could take any place in chain
+		case e.Kind == Write && e.Balance != nil && e.Inc != (changing.Inc{}):
+			// revert has transaction id of reverted write
+			if !e.Revert {
+				if s, ok := delivered[e.TransactionID]; ok && s == stateOf(*e.Balance) {
+					continue
+				}
+
+				delivered[e.TransactionID] = stateOf(*e.Balance)
+			}
+
+			reverts = reverts || e.Revert
+			writes = append(writes, e)
+			entries = append(entries, store.Entry{AccountID: id, TransactionID: e.TransactionID, Inc: e.Inc, Total: *e.Balance, Revert: e.Revert})
+		}
+	}
+
+	// monotone totals never repeat, unless revert brings them back
+	if !reverts {
+		posts := make(map[state]Event)
+		for _, w := range writes {
+			if w.Inc.DepositCount == 0 && w.Inc.DepositAllSum <= 0 && w.Inc.PincoinsAllSum <= 0 {
+				continue
+			}
+
+			if prev, ok := posts[stateOf(*w.Balance)]; ok {
+				add(DuplicatePost, "transactions %d and %d both returned %+v", prev.TransactionID, w.TransactionID, stateOf(*w.Balance))
+				continue
+			}
+
+			posts[stateOf(*w.Balance)] = w
+		}
+	}
+
+	order, stranded := ledger.Chain(entries)
+	if len(stranded) > 0 {
+		if d := ledger.Duplicates(entries, stranded); d != "" {
+			add(LostUpdate, "%d of %d writes don't continue states%s", len(stranded), len(entries), d)
+		} else {
+			add(BrokenChain, "%d of %d writes don't continue states, %d writes failed with unknown outcome", len(stranded), len(entries), failed)
+		}
+	}
+
+	// positions of every state in chain, zero state is before the first write, revert repeats states
+	pos := map[state][]int{{}: {-1}}
+	for p, i := range order {
+		s := stateOf(entries[i].Total)
+		pos[s] = append(pos[s], p)
+	}
+
+	// write which completed before the next one in chain started can't follow it
+	minComplete := time.Duration(1<<63 - 1)
+	witness := -1
+	for p := len(order) - 1; p >= 0; p-- {
+		w := writes[order[p]]
+		if witness >= 0 && minComplete < w.Invoke {
+			v := writes[witness]
+			add(NonMonotonic, "transaction %d started at %v after transaction %d completed at %v, but precedes it in states",
+				w.TransactionID, w.Invoke, v.TransactionID, v.Complete)
+		}
+
+		if w.Complete < minComplete {
+			minComplete, witness = w.Complete, order[p]
+		}
+	}
+
+	out = append(out, reads(id, events, writes, order, pos)...)
+
+	return out
+}
+
+func reads(id uint64, events, writes []Event, order []int, pos map[state][]int) []Anomaly {
+	var out []Anomaly
+
+	// chain writes by completion with the latest position completed so far
+	type done struct {
+		at  time.Duration
+		pos int
+	}
+
+	completed := make([]done, len(order))
+	for p, i := range order {
+		completed[p] = done{at: writes[i].Complete, pos: p}
+	}
+
+	sort.Slice(completed, func(i, j int) bool { return completed[i].at < completed[j].at })
+
+	for i := 1; i < len(completed); i++ {
+		if completed[i].pos < completed[i-1].pos {
+			completed[i].pos = completed[i-1].pos
+		}
+	}
+
+	for _, e := range events {
+		if e.Kind != Read || e.Err != "" {
+			continue
+		}
+
+		var s state
+		if e.Balance != nil {
+			s = stateOf(*e.Balance)
+		}
+
+		ps, ok := pos[s]
+		if !ok {
+			out = append(out, Anomaly{Account: id, Kind: UncommittedRead, Detail: fmt.Sprintf("read at %v returned %+v which no successful write produced", e.Invoke, s)})
+			continue
+		}
+
+		// the latest position of state whose write started before read completed
+		p := ps[0]
+		for _, q := range ps[1:] {
+			if writes[order[q]].Invoke <= e.Complete {
+				p = q
+			}
+		}
+
+		if p >= 0 && writes[order[p]].Invoke > e.Complete {
+			w := writes[order[p]]
+			out = append(out, Anomaly{Account: id, Kind: FutureRead, Detail: fmt.Sprintf("read completed at %v returned state of transaction %d started at %v", e.Complete, w.TransactionID, w.Invoke)})
+			continue
+		}
+
+		// the latest state completed before read started
+		k := sort.Search(len(completed), func(k int) bool { return completed[k].at >= e.Invoke })
+		if k > 0 && completed[k-1].pos > p {
+			w := writes[order[completed[k-1].pos]]
+			out = append(out, Anomaly{Account: id, Kind: StaleRead, Detail: fmt.Sprintf("read at %v returned %+v after transaction %d completed at %v", e.Invoke, s, w.TransactionID, w.Complete)})
+		}
+	}
+
+	return out
+}
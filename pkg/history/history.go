@@ -0,0 +1,261 @@
+package history
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/d7561985/mongo-ab/pkg/changing"
+	"github.com/d7561985/mongo-ab/pkg/store"
+	"github.com/d7561985/mongo-ab/pkg/worker"
+)
+
+// Kinds of events
+const (
+	Write = "write"
+	Read  = "read"
+)
+
+// Event is single operation of history, one JSON line
+type Event struct {
+	Thread int    `json:"thread"`
+	Kind   string `json:"kind"`
+	// Invoke and Complete are times since the beginning of recording
+	Invoke        time.Duration `json:"invoke"`
+	Complete      time.Duration `json:"complete"`
+	Account       uint64        `json:"account"`
+	TransactionID uint64        `json:"transactionId,omitempty"`
+	Inc           changing.Inc  `json:"inc,omitempty"`
+	// Revert is write of store.Reverter, Inc is increments of reverted transaction which it subtracts
+	Revert bool `json:"revert,omitempty"`
+	// Balance is post-balance returned by write or balance returned by read, nil on error and for unknown account
+	Balance *store.Balance `json:"balance,omitempty"`
+	Err     string         `json:"err,omitempty"`
+}
+
+// Writer records events of all threads, it is worker.Sink which closes file when run finishes.
+// Methods of nil Writer do nothing, so recording could be disabled without checks.
+type Writer struct {
+	mu    sync.Mutex
+	start time.Time
+	f     *os.File
+	buf   *bufio.Writer
+	gz    *gzip.Writer
+	enc   *json.Encoder
+	err   error
+	once  sync.Once
+}
+
+var _ worker.Sink = (*Writer)(nil)
+
+// Create starts history at path, ".gz" suffix compresses it
+func Create(path string) (*Writer, error) {
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, fmt.Errorf("create history: %w", err)
+		}
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("create history: %w", err)
+	}
+
+	w := &Writer{start: time.Now(), f: f, buf: bufio.NewWriter(f)}
+
+	var out io.Writer = w.buf
+	if strings.HasSuffix(path, ".gz") {
+		w.gz = gzip.NewWriter(w.buf)
+		out = w.gz
+	}
+
+	w.enc = json.NewEncoder(out)
+
+	return w, nil
+}
+
+// since is time of recording, invoke is taken before operation and complete after it
+func (w *Writer) since() time.Duration {
+	return time.Since(w.start)
+}
+
+// Add records event. The first write error is returned by Close.
+func (w *Writer) Add(e Event) {
+	if w == nil {
+		return
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.err != nil {
+		return
+	}
+
+	w.err = w.enc.Encode(e)
+}
+
+// Close flushes history, it is safe to call it more than once
+func (w *Writer) Close() error {
+	if w == nil {
+		return nil
+	}
+
+	w.once.Do(func() {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+
+		err := w.err
+		if w.gz != nil {
+			err = first(err, w.gz.Close())
+		}
+
+		err = first(err, w.buf.Flush())
+		err = first(err, w.f.Close())
+
+		if err != nil {
+			w.err = fmt.Errorf("write history: %w", err)
+		}
+	})
+
+	return w.err
+}
+
+func (w *Writer) Sample(worker.Sample) {}
+
+func (w *Writer) Finish(worker.Summary) error {
+	return w.Close()
+}
+
+// Store records UpdateTX, Revert and GetBalance of thread, other methods are passed through
+type Store struct {
+	store.Store
+	w      *Writer
+	thread int
+}
+
+// Wrap returns s which records operations of thread to w, nil w returns s as is
+func Wrap(s store.Store, w *Writer, thread int) store.Store {
+	if w == nil {
+		return s
+	}
+
+	return &Store{Store: s, w: w, thread: thread}
+}
+
+func (s *Store) UpdateTX(ctx context.Context, tx changing.Transaction) (store.Balance, error) {
+	e := Event{Thread: s.thread, Kind: Write, Account: tx.AccountID, TransactionID: tx.TransactionID, Inc: tx.Inc, Invoke: s.w.since()}
+
+	b, err := s.Store.UpdateTX(ctx, tx)
+	s.add(e, b, err)
+
+	return b, err
+}
+
+func (s *Store) GetBalance(ctx context.Context, account uint64) (store.Balance, error) {
+	e := Event{Thread: s.thread, Kind: Read, Account: account, Invoke: s.w.since()}
+
+	b, err := s.Store.GetBalance(ctx, account)
+	if errors.Is(err, store.ErrNotFound) {
+		// unknown account is zero balance
+		e.Complete = s.w.since()
+		s.w.Add(e)
+
+		return b, err
+	}
+
+	s.add(e, b, err)
+
+	return b, err
+}
+
+// ListJournal of wrapped store, it is not recorded
+func (s *Store) ListJournal(ctx context.Context, account uint64, from, to time.Time, cursor string, limit int) (store.Page, error) {
+	l, ok := s.Store.(store.JournalLister)
+	if !ok {
+		return store.Page{}, fmt.Errorf("%T doesn't list journal", s.Store)
+	}
+
+	return l.ListJournal(ctx, account, from, to, cursor, limit)
+}
+
+// Revert of wrapped store is recorded as write, account of failed revert is unknown
+func (s *Store) Revert(ctx context.Context, journalID string) (store.Record, error) {
+	r, ok := s.Store.(store.Reverter)
+	if !ok {
+		return store.Record{}, fmt.Errorf("%T doesn't revert", s.Store)
+	}
+
+	e := Event{Thread: s.thread, Kind: Write, Revert: true, Invoke: s.w.since()}
+
+	rec, err := r.Revert(ctx, journalID)
+	e.Account, e.TransactionID, e.Inc = rec.AccountID, rec.TransactionID, rec.Inc
+	s.add(e, rec.Total, err)
+
+	return rec, err
+}
+
+func (s *Store) add(e Event, b store.Balance, err error) {
+	e.Complete = s.w.since()
+
+	if err != nil {
+		e.Err = err.Error()
+	} else {
+		e.Balance = &b
+	}
+
+	s.w.Add(e)
+}
+
+// Load calls fn for every event of history at path, ".gz" suffix is decompressed
+func Load(path string, fn func(Event) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("open history: %w", err)
+	}
+
+	defer f.Close()
+
+	var in io.Reader = bufio.NewReader(f)
+	if strings.HasSuffix(path, ".gz") {
+		gz, err := gzip.NewReader(in)
+		if err != nil {
+			return fmt.Errorf("open history: %w", err)
+		}
+
+		defer gz.Close()
+
+		in = gz
+	}
+
+	dec := json.NewDecoder(in)
+	for n := 1; ; n++ {
+		var e Event
+		if err = dec.Decode(&e); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("read history event %d: %w", n, err)
+		}
+
+		if err = fn(e); err != nil {
+			return err
+		}
+	}
+}
+
+func first(err, next error) error {
+	if err != nil {
+		return err
+	}
+
+	return next
+}
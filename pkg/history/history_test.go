@@ -0,0 +1,228 @@
+package history
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/d7561985/mongo-ab/pkg/changing"
+	"github.com/d7561985/mongo-ab/pkg/store"
+	"github.com/d7561985/mongo-ab/pkg/store/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordMemory(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "run.jsonl.gz")
+
+	w, err := Create(path)
+	require.NoError(t, err)
+
+	db := memory.New()
+
+	wg := sync.WaitGroup{}
+	for thread := 0; thread < 4; thread++ {
+		wg.Add(1)
+		go func(thread int) {
+			defer wg.Done()
+
+			s := Wrap(db, w, thread)
+			for n := 0; n < 200; n++ {
+				req := changing.ChangeRequest{AccountID: uint64(n % 3), Type: changing.Deposit, Change: 10, PincoinChange: 1}
+				_, err := s.UpdateTX(ctx, req.Make())
+				assert.NoError(t, err)
+
+				_, err = s.GetBalance(ctx, uint64(n%5))
+				if !errors.Is(err, store.ErrNotFound) {
+					assert.NoError(t, err)
+				}
+			}
+		}(thread)
+	}
+
+	wg.Wait()
+	require.NoError(t, w.Close())
+	require.NoError(t, w.Close())
+
+	var events []Event
+	require.NoError(t, Load(path, func(e Event) error {
+		events = append(events, e)
+		return nil
+	}))
+
+	require.Len(t, events, 1600)
+
+	rep := Check(events)
+	assert.Empty(t, rep.Anomalies)
+	assert.Equal(t, 5, rep.Accounts)
+	assert.Equal(t, 800, rep.Writes)
+	assert.Equal(t, 800, rep.Reads)
+}
+
+func TestRecordRevert(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "run.jsonl")
+
+	w, err := Create(path)
+	require.NoError(t, err)
+
+	db := memory.New()
+	s := Wrap(db, w, 0).(*Store)
+
+	_, err = s.UpdateTX(ctx, changing.ChangeRequest{AccountID: 1, Type: changing.Deposit, Change: 10}.Make())
+	require.NoError(t, err)
+
+	_, err = s.Revert(ctx, "0")
+	require.NoError(t, err)
+
+	_, err = s.Revert(ctx, "0")
+	assert.ErrorIs(t, err, store.ErrReverted)
+
+	_, err = s.GetBalance(ctx, 1)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	var events []Event
+	require.NoError(t, Load(path, func(e Event) error {
+		events = append(events, e)
+		return nil
+	}))
+
+	require.Len(t, events, 4)
+	assert.True(t, events[1].Revert)
+	assert.Equal(t, uint64(1), events[1].Account)
+	assert.Equal(t, 10.0, events[1].Inc.Balance)
+
+	rep := Check(events)
+	assert.Empty(t, rep.Anomalies)
+	assert.Equal(t, 1, rep.Failed)
+}
+
+func write(tx uint64, invoke, complete time.Duration, inc, total float64) Event {
+	return Event{
+		Kind:          Write,
+		Invoke:        invoke,
+		Complete:      complete,
+		Account:       1,
+		TransactionID: tx,
+		Inc:           changing.Inc{Balance: inc, DepositCount: 1},
+		Balance:       &store.Balance{AccountID: 1, Balance: total, DepositCount: uint64(total / 10)},
+	}
+}
+
+func revert(tx uint64, invoke, complete time.Duration, inc, total float64) Event {
+	e := write(tx, invoke, complete, inc, total)
+	e.Revert = true
+
+	return e
+}
+
+func read(invoke, complete time.Duration, total float64) Event {
+	return Event{Kind: Read, Invoke: invoke, Complete: complete, Account: 1,
+		Balance: &store.Balance{AccountID: 1, Balance: total, DepositCount: uint64(total / 10)}}
+}
+
+func kinds(rep Report) []string {
+	var out []string
+	for _, a := range rep.Anomalies {
+		out = append(out, a.Kind)
+	}
+
+	return out
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name   string
+		events []Event
+		want   []string
+	}{
+		{
+			name: "serializable",
+			events: []Event{
+				read(0, 1, 0),
+				write(2, 5, 10, 10, 20),
+				write(1, 0, 6, 10, 10),
+				read(7, 8, 10),
+				read(11, 12, 20),
+			},
+		},
+		{
+			name: "lost update",
+			events: []Event{
+				write(1, 0, 5, 10, 10),
+				{Kind: Write, Invoke: 0, Complete: 5, Account: 1, TransactionID: 2, Inc: changing.Inc{Balance: 10, DepositCount: 1},
+					Balance: &store.Balance{AccountID: 1, Balance: 10, DepositCount: 1}},
+			},
+			want: []string{DuplicatePost, LostUpdate},
+		},
+		{
+			name: "redelivery",
+			events: []Event{
+				write(1, 0, 1, 10, 10),
+				write(2, 2, 3, 10, 20),
+				// idempotent store returns recorded result
+				write(1, 4, 5, 10, 10),
+			},
+		},
+		{
+			name: "non-monotonic",
+			events: []Event{
+				write(1, 5, 6, 10, 10),
+				write(2, 0, 1, 10, 20),
+			},
+			want: []string{NonMonotonic},
+		},
+		{
+			name: "uncommitted read",
+			events: []Event{
+				write(1, 0, 1, 10, 10),
+				{Kind: Write, Invoke: 2, Complete: 3, Account: 1, TransactionID: 2, Inc: changing.Inc{Balance: 10}, Err: "aborted"},
+				read(2, 3, 20),
+			},
+			want: []string{UncommittedRead},
+		},
+		{
+			name: "future and stale reads",
+			events: []Event{
+				read(0, 1, 10),
+				write(1, 2, 3, 10, 10),
+				write(2, 4, 5, 10, 20),
+				read(6, 7, 10),
+			},
+			want: []string{FutureRead, StaleRead},
+		},
+		{
+			name: "revert",
+			events: []Event{
+				write(1, 0, 1, 10, 10),
+				revert(1, 2, 3, 10, 0),
+				read(4, 5, 0),
+				write(2, 6, 7, 10, 10),
+				read(8, 9, 10),
+				// redelivery after revert
+				write(2, 10, 11, 10, 10),
+			},
+		},
+		{
+			name: "stale read of reverted state",
+			events: []Event{
+				write(1, 0, 1, 10, 10),
+				revert(1, 2, 3, 10, 0),
+				write(2, 4, 5, 10, 10),
+				read(6, 7, 0),
+			},
+			want: []string{StaleRead},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.want, kinds(Check(test.events)))
+		})
+	}
+}
@@ -0,0 +1,209 @@
+package keys
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+)
+
+const (
+	Uniform    = "uniform"
+	Zipfian    = "zipfian"
+	Hotspot    = "hotspot"
+	Latest     = "latest"
+	Sequential = "sequential"
+)
+
+const (
+	defTheta   = 0.99
+	defHotOps  = 80
+	defHotKeys = 20
+)
+
+// Generator returns keys in range [0, n), every thread owns its own generator
+type Generator interface {
+	Next() uint64
+}
+
+// Distribution of key access shared by all threads of run
+type Distribution struct {
+	kind string
+	n    uint64
+
+	// zipfian and latest
+	theta, zetan, alpha, eta float64
+
+	// hotspot: share of operations which hit share of keys
+	hotOps, hotKeys float64
+}
+
+// Parse reads distribution of n keys in form kind[:params]
+//
+//	uniform              every key with the same probability
+//	zipfian[:theta]      key 0 is the most popular, theta in (0, 1), default 0.99
+//	hotspot[:ops:keys]   ops% of operations hit the first keys% of keys, default 80:20
+//	latest[:theta]       zipfian skew towards the most recently issued keys, which advance all the time
+//	sequential           0, 1, 2 ... n-1 and over again, threads take keys in turn
+func Parse(spec string, n uint64) (*Distribution, error) {
+	if n == 0 {
+		return nil, fmt.Errorf("distribution %q: no keys", spec)
+	}
+
+	parts := strings.Split(spec, ":")
+	d := &Distribution{kind: parts[0], n: n}
+
+	params := make([]float64, 0, len(parts)-1)
+	for _, p := range parts[1:] {
+		v, err := strconv.ParseFloat(p, 64)
+		if err != nil {
+			return nil, fmt.Errorf("distribution %q: bad parameter %q", spec, p)
+		}
+
+		params = append(params, v)
+	}
+
+	switch d.kind {
+	case Uniform, Sequential:
+		if len(params) != 0 {
+			return nil, fmt.Errorf("distribution %q has no parameters", spec)
+		}
+	case Zipfian, Latest:
+		theta := defTheta
+		switch len(params) {
+		case 0:
+		case 1:
+			theta = params[0]
+		default:
+			return nil, fmt.Errorf("distribution %q wants kind:theta", spec)
+		}
+
+		if theta <= 0 || theta >= 1 {
+			return nil, fmt.Errorf("distribution %q: theta must be in range (0, 1)", spec)
+		}
+
+		d.zipfian(theta)
+	case Hotspot:
+		ops, keys := float64(defHotOps), float64(defHotKeys)
+		switch len(params) {
+		case 0:
+		case 2:
+			ops, keys = params[0], params[1]
+		default:
+			return nil, fmt.Errorf("distribution %q wants hotspot:ops:keys", spec)
+		}
+
+		if ops < 0 || ops > 100 || keys <= 0 || keys >= 100 {
+			return nil, fmt.Errorf("distribution %q: ops in [0, 100] and keys in (0, 100) percents expected", spec)
+		}
+
+		d.hotOps, d.hotKeys = ops/100, keys/100
+	default:
+		return nil, fmt.Errorf("unknown distribution %q, use uniform, zipfian, hotspot, latest or sequential", spec)
+	}
+
+	return d, nil
+}
+
+// zipfian precomputes constants of Gray et al. "Quickly generating billion-record synthetic databases"
+func (d *Distribution) zipfian(theta float64) {
+	var zetan float64
+	for i := uint64(1); i <= d.n; i++ {
+		zetan += 1 / math.Pow(float64(i), theta)
+	}
+
+	zeta2 := 1 + 1/math.Pow(2, theta)
+
+	d.theta = theta
+	d.zetan = zetan
+	d.alpha = 1 / (1 - theta)
+	d.eta = (1 - math.Pow(2/float64(d.n), 1-theta)) / (1 - zeta2/zetan)
+}
+
+func (d *Distribution) String() string {
+	switch d.kind {
+	case Zipfian, Latest:
+		return fmt.Sprintf("%s:%g over %d keys", d.kind, d.theta, d.n)
+	case Hotspot:
+		return fmt.Sprintf("%s: %g%% ops on %g%% of %d keys", d.kind, d.hotOps*100, d.hotKeys*100, d.n)
+	default:
+		return fmt.Sprintf("%s over %d keys", d.kind, d.n)
+	}
+}
+
+// Generator for thread of threads, r must not be shared between threads.
+// Sequence of generator depends only on r and thread, never on timing of other threads.
+func (d *Distribution) Generator(r *rand.Rand, thread, threads int) Generator {
+	if threads < 1 {
+		threads = 1
+	}
+
+	return &generator{d: d, r: r, pos: uint64(thread), stride: uint64(threads)}
+}
+
+type generator struct {
+	d *Distribution
+	r *rand.Rand
+
+	// sequential and latest position: thread, thread+threads, thread+2*threads ...
+	pos, stride uint64
+}
+
+func (g *generator) next() uint64 {
+	v := g.pos % g.d.n
+	g.pos += g.stride
+
+	return v
+}
+
+func (g *generator) Next() uint64 {
+	d := g.d
+	if d.n == 1 {
+		return 0
+	}
+
+	switch d.kind {
+	case Zipfian:
+		return g.zipf()
+	case Latest:
+		return (g.next() + d.n - g.zipf()%d.n) % d.n
+	case Sequential:
+		return g.next()
+	case Hotspot:
+		hot := uint64(math.Ceil(float64(d.n) * d.hotKeys))
+		if hot >= d.n {
+			hot = d.n - 1
+		}
+
+		if g.r.Float64() < d.hotOps {
+			return uint64(g.r.Int63n(int64(hot)))
+		}
+
+		return hot + uint64(g.r.Int63n(int64(d.n-hot)))
+	default:
+		return uint64(g.r.Int63n(int64(d.n)))
+	}
+}
+
+func (g *generator) zipf() uint64 {
+	d := g.d
+
+	u := g.r.Float64()
+	uz := u * d.zetan
+
+	if uz < 1 {
+		return 0
+	}
+
+	if uz < 1+math.Pow(0.5, d.theta) {
+		return 1 % d.n
+	}
+
+	v := uint64(float64(d.n) * math.Pow(d.eta*u-d.eta+1, d.alpha))
+	if v >= d.n {
+		v = d.n - 1
+	}
+
+	return v
+}
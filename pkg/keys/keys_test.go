@@ -0,0 +1,94 @@
+package keys
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const n = 1000
+
+func counts(t *testing.T, spec string, ops int) []int {
+	d, err := Parse(spec, n)
+	require.NoError(t, err)
+
+	g := d.Generator(rand.New(rand.NewSource(1)), 0, 1)
+
+	out := make([]int, n)
+	for i := 0; i < ops; i++ {
+		k := g.Next()
+		require.Less(t, k, uint64(n), spec)
+		out[k]++
+	}
+
+	return out
+}
+
+func TestUniform(t *testing.T) {
+	c := counts(t, Uniform, 100_000)
+	for k, v := range c {
+		assert.InDelta(t, 100, v, 50, "key %d", k)
+	}
+}
+
+func TestZipfian(t *testing.T) {
+	c := counts(t, "zipfian:0.99", 100_000)
+
+	assert.Greater(t, c[0], c[1])
+	assert.Greater(t, c[1], c[10])
+	// with theta 0.99 the top key takes about 1/zeta(n) = 13% of 1000 keys
+	assert.InDelta(t, 0.13, float64(c[0])/100_000, 0.02)
+}
+
+func TestHotspot(t *testing.T) {
+	c := counts(t, "hotspot:90:10", 100_000)
+
+	hot := 0
+	for _, v := range c[:100] {
+		hot += v
+	}
+
+	assert.InDelta(t, 0.9, float64(hot)/100_000, 0.01)
+}
+
+func TestSequential(t *testing.T) {
+	d, err := Parse(Sequential, 3)
+	require.NoError(t, err)
+
+	a, b := d.Generator(rand.New(rand.NewSource(1)), 0, 2), d.Generator(rand.New(rand.NewSource(2)), 1, 2)
+	assert.Equal(t, []uint64{0, 2, 1}, []uint64{a.Next(), a.Next(), a.Next()})
+	assert.Equal(t, []uint64{1, 0, 2}, []uint64{b.Next(), b.Next(), b.Next()})
+}
+
+func TestLatest(t *testing.T) {
+	d, err := Parse(Latest, n)
+	require.NoError(t, err)
+
+	g := d.Generator(rand.New(rand.NewSource(1)), 0, 1)
+
+	near := 0
+	for i := uint64(0); i < 10_000; i++ {
+		// the most recent key is the one issued by this call
+		if k := g.Next(); (i%n+n-k)%n < 10 {
+			near++
+		}
+	}
+
+	assert.Greater(t, near, 3_000)
+}
+
+func TestParse(t *testing.T) {
+	for _, spec := range []string{"", "normal", "zipfian:1", "zipfian:0", "hotspot:90", "hotspot:90:100", "uniform:1", "zipfian:x"} {
+		_, err := Parse(spec, n)
+		assert.Error(t, err, spec)
+	}
+
+	_, err := Parse(Uniform, 0)
+	assert.Error(t, err)
+
+	d, err := Parse(Hotspot, 1)
+	require.NoError(t, err)
+	assert.EqualValues(t, 0, d.Generator(rand.New(rand.NewSource(1)), 0, 1).Next())
+}
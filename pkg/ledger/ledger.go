@@ -0,0 +1,358 @@
+package ledger
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/d7561985/mongo-ab/pkg/store"
+	"github.com/pkg/errors"
+)
+
+const (
+	// Epsilon is relative tolerance of step of running totals, postgres rounds every total to float4
+	Epsilon = 1e-6
+	// SumEpsilon is relative tolerance of balance and sum of all increments, float4 rounding piles up
+	SumEpsilon = 1e-3
+)
+
+// Mismatch is problem of single account
+type Mismatch struct {
+	AccountID uint64
+	Problem   string
+}
+
+func (m Mismatch) String() string {
+	return fmt.Sprintf("account %d: %s", m.AccountID, m.Problem)
+}
+
+// Report of verification
+type Report struct {
+	Accounts   int
+	Entries    int
+	Mismatches []Mismatch
+}
+
+func (r Report) String() string {
+	return fmt.Sprintf("verified %d accounts, %d journal entries: %d mismatches", r.Accounts, r.Entries, len(r.Mismatches))
+}
+
+// Verify recomputes every account from journal and compares it with balance.
+// Journal of account must be chain of running totals: every entry is totals of previous one plus its increments,
+// starting from zero, and balance is sum of all increments and the last totals of the chain.
+func Verify(ctx context.Context, l store.Ledger) (Report, error) {
+	balances := make(map[uint64]store.Balance)
+	journal := make(map[uint64][]store.Entry)
+
+	err := l.ScanBalances(ctx, func(b store.Balance) error {
+		balances[b.AccountID] = b
+		return nil
+	})
+	if err != nil {
+		return Report{}, errors.WithStack(err)
+	}
+
+	var rep Report
+
+	err = l.ScanJournal(ctx, func(e store.Entry) error {
+		journal[e.AccountID] = append(journal[e.AccountID], e)
+		rep.Entries++
+
+		return nil
+	})
+	if err != nil {
+		return Report{}, errors.WithStack(err)
+	}
+
+	accounts := make([]uint64, 0, len(balances))
+	for id := range balances {
+		accounts = append(accounts, id)
+	}
+
+	for id := range journal {
+		if _, ok := balances[id]; !ok {
+			accounts = append(accounts, id)
+		}
+	}
+
+	sort.Slice(accounts, func(i, j int) bool { return accounts[i] < accounts[j] })
+	rep.Accounts = len(accounts)
+
+	for _, id := range accounts {
+		b, ok := balances[id]
+		for _, p := range Account(b, ok, journal[id]) {
+			rep.Mismatches = append(rep.Mismatches, Mismatch{AccountID: id, Problem: p})
+		}
+	}
+
+	return rep, nil
+}
+
+// Account returns problems of single account, found is false when it has no balance
+func Account(b store.Balance, found bool, entries []store.Entry) []string {
+	var out []string
+
+	switch {
+	case !found && len(entries) == 0:
+		return nil
+	case !found:
+		return []string{fmt.Sprintf("no balance for %d journal entries", len(entries))}
+	case len(entries) == 0:
+		return []string{fmt.Sprintf("balance %s has no journal entries", format(b))}
+	}
+
+	var sum store.Balance
+	for _, e := range entries {
+		sum = add(sum, e, 1)
+	}
+
+	if d := diff(b, sum, SumEpsilon); d != "" {
+		out = append(out, "balance differs from sum of journal increments: "+d)
+	}
+
+	var last store.Balance
+
+	order, stranded := Chain(entries)
+	if len(order) > 0 {
+		last = entries[order[len(order)-1]].Total
+	}
+
+	if len(stranded) > 0 {
+		out = append(out, fmt.Sprintf("%d of %d journal entries don't continue running totals after %s%s",
+			len(stranded), len(entries), format(last), Duplicates(entries, stranded)))
+
+		return out
+	}
+
+	if d := diff(b, last, Epsilon); d != "" {
+		out = append(out, "balance differs from last running totals of journal: "+d)
+	}
+
+	return out
+}
+
+// Chain walks running totals from zero and returns indexes of entries in order of chain and entries which don't fit.
+// Revert brings account back to totals it had before, so that walk of journal with reverts could miss loops
+// of chain: they are spliced in where walk returns to the same totals. Of entries which continue the same totals
+// the earlier one in entries is taken first.
+func Chain(entries []store.Entry) (order, stranded []int) {
+	// entries by previous totals: deposit count exactly, then balance
+	type bucket struct {
+		prev []step
+		tol  float64
+	}
+
+	buckets := make(map[uint64]*bucket)
+	reverts := false
+
+	for i, e := range entries {
+		st := newStep(i, e)
+
+		b, ok := buckets[st.prev.DepositCount]
+		if !ok {
+			b = &bucket{}
+			buckets[st.prev.DepositCount] = b
+		}
+
+		b.prev = append(b.prev, st)
+		b.tol = math.Max(b.tol, st.tol)
+		reverts = reverts || e.Revert
+	}
+
+	for _, b := range buckets {
+		p := b.prev
+		sort.SliceStable(p, func(i, j int) bool { return p[i].prev.Balance < p[j].prev.Balance })
+	}
+
+	used := make([]bool, len(entries))
+
+	// walk takes unused entries which continue state one by one
+	walk := func(state store.Balance) (path []int) {
+		for {
+			b, ok := buckets[state.DepositCount]
+			if !ok {
+				return path
+			}
+
+			p, next := b.prev, -1
+			for k := sort.Search(len(p), func(k int) bool { return p[k].prev.Balance >= state.Balance-b.tol }); k < len(p) && p[k].prev.Balance <= state.Balance+b.tol; k++ {
+				if !used[p[k].i] && p[k].follows(state) {
+					next = p[k].i
+					break
+				}
+			}
+
+			if next < 0 {
+				return path
+			}
+
+			used[next] = true
+			state = entries[next].Total
+			path = append(path, next)
+		}
+	}
+
+	order = walk(store.Balance{})
+
+	for progress := reverts; progress; {
+		progress = false
+
+		for pos := 0; pos <= len(order); pos++ {
+			var start store.Balance
+			if pos > 0 {
+				start = entries[order[pos-1]].Total
+			}
+
+			path := walk(start)
+			if len(path) == 0 {
+				continue
+			}
+
+			last := newStep(path[len(path)-1], entries[path[len(path)-1]])
+
+			// path which doesn't return to start is left for another position, unless it is the end of chain
+			if pos < len(order) && !near(start, entries[last.i].Total, last.tol) {
+				for _, i := range path {
+					used[i] = false
+				}
+
+				continue
+			}
+
+			order = append(order[:pos], append(path, order[pos:]...)...)
+			pos += len(path)
+			progress = true
+		}
+	}
+
+	for i, u := range used {
+		if !u {
+			stranded = append(stranded, i)
+		}
+	}
+
+	return order, stranded
+}
+
+// step is entry with totals before it, tol is rounding of its totals and increments
+type step struct {
+	i    int
+	prev store.Balance
+	tol  float64
+}
+
+func newStep(i int, e store.Entry) step {
+	st := step{i: i, prev: add(e.Total, e, -1), tol: 1}
+	if !e.Revert && e.Total.DepositCount < e.Inc.DepositCount {
+		st.prev.DepositCount = math.MaxUint64
+	}
+
+	for _, v := range []float64{
+		e.Total.Balance, e.Total.DepositAllSum, e.Total.PincoinBalance, e.Total.PincoinsAllSum,
+		e.Inc.Balance, e.Inc.DepositAllSum, e.Inc.PincoinBalance, e.Inc.PincoinsAllSum,
+	} {
+		st.tol = math.Max(st.tol, math.Abs(v))
+	}
+
+	st.tol *= Epsilon
+
+	return st
+}
+
+// follows is true when entry was applied to state
+func (s step) follows(state store.Balance) bool {
+	return near(s.prev, state, s.tol)
+}
+
+func near(a, b store.Balance, tol float64) bool {
+	return a.DepositCount == b.DepositCount &&
+		math.Abs(a.Balance-b.Balance) <= tol &&
+		math.Abs(a.DepositAllSum-b.DepositAllSum) <= tol &&
+		math.Abs(a.PincoinBalance-b.PincoinBalance) <= tol &&
+		math.Abs(a.PincoinsAllSum-b.PincoinsAllSum) <= tol
+}
+
+const maxDuplicateChecks = 100
+
+// Duplicates describes stranded entries which start from the same totals as another entry, i.e. lost updates
+func Duplicates(entries []store.Entry, stranded []int) string {
+	var out []string
+
+	// bounded, every check scans all entries
+	if len(stranded) > maxDuplicateChecks {
+		stranded = stranded[:maxDuplicateChecks]
+	}
+
+	for _, s := range stranded {
+		st := newStep(s, entries[s])
+
+		for i, e := range entries {
+			if i != s && st.follows(newStep(i, e).prev) {
+				out = append(out, fmt.Sprintf("transactions %d and %d both start from %s", entries[s].TransactionID, e.TransactionID, format(st.prev)))
+				break
+			}
+		}
+
+		if len(out) == 3 {
+			break
+		}
+	}
+
+	if len(out) == 0 {
+		return ""
+	}
+
+	return ", lost update: " + strings.Join(out, "; ")
+}
+
+// add applies increments of entry with sign, compensating entry of revert subtracts them
+func add(b store.Balance, e store.Entry, sign float64) store.Balance {
+	if e.Revert {
+		sign = -sign
+	}
+
+	b.Balance += sign * e.Inc.Balance
+	b.DepositAllSum += sign * e.Inc.DepositAllSum
+	b.PincoinBalance += sign * e.Inc.PincoinBalance
+	b.PincoinsAllSum += sign * e.Inc.PincoinsAllSum
+
+	if sign > 0 {
+		b.DepositCount += e.Inc.DepositCount
+	} else {
+		b.DepositCount -= e.Inc.DepositCount
+	}
+
+	return b
+}
+
+// diff lists fields of want and got which differ more than eps relatively
+func diff(want, got store.Balance, eps float64) string {
+	var out []string
+
+	if want.DepositCount != got.DepositCount {
+		out = append(out, fmt.Sprintf("depositCount %d != %d", want.DepositCount, got.DepositCount))
+	}
+
+	for _, f := range []struct {
+		name      string
+		want, got float64
+	}{
+		{"balance", want.Balance, got.Balance},
+		{"depositAllSum", want.DepositAllSum, got.DepositAllSum},
+		{"pincoinBalance", want.PincoinBalance, got.PincoinBalance},
+		{"pincoinsAllSum", want.PincoinsAllSum, got.PincoinsAllSum},
+	} {
+		if math.Abs(f.want-f.got) > eps*math.Max(1, math.Max(math.Abs(f.want), math.Abs(f.got))) {
+			out = append(out, fmt.Sprintf("%s %g != %g", f.name, f.want, f.got))
+		}
+	}
+
+	return strings.Join(out, ", ")
+}
+
+func format(b store.Balance) string {
+	return fmt.Sprintf("{balance: %g depositAllSum: %g depositCount: %d pincoinBalance: %g pincoinsAllSum: %g}",
+		b.Balance, b.DepositAllSum, b.DepositCount, b.PincoinBalance, b.PincoinsAllSum)
+}
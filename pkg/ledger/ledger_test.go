@@ -0,0 +1,204 @@
+package ledger
+
+import (
+	"context"
+	"math/rand"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/d7561985/mongo-ab/pkg/changing"
+	"github.com/d7561985/mongo-ab/pkg/store"
+	"github.com/d7561985/mongo-ab/pkg/store/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fake struct {
+	balances []store.Balance
+	journal  []store.Entry
+}
+
+func (f fake) ScanBalances(_ context.Context, fn func(store.Balance) error) error {
+	for _, b := range f.balances {
+		if err := fn(b); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (f fake) ScanJournal(_ context.Context, fn func(store.Entry) error) error {
+	for _, e := range f.journal {
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func entry(account, tx uint64, inc, total float64) store.Entry {
+	return store.Entry{
+		AccountID:     account,
+		TransactionID: tx,
+		Inc:           changing.Inc{Balance: inc},
+		Total:         store.Balance{AccountID: account, Balance: total},
+	}
+}
+
+func TestVerifyMemory(t *testing.T) {
+	ctx := context.Background()
+	r := memory.New()
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+
+			rnd := rand.New(rand.NewSource(seed))
+			for n := 0; n < 500; n++ {
+				req := changing.ChangeRequest{AccountID: uint64(rnd.Intn(5)), Type: changing.Deposit, Change: float64(rnd.Intn(10000)) / 100, PincoinChange: 1}
+				if n%3 == 0 {
+					req.Type, req.Change = changing.Bet, -req.Change
+				}
+
+				_, err := r.UpdateTX(ctx, req.Make())
+				assert.NoError(t, err)
+			}
+		}(int64(i))
+	}
+
+	wg.Wait()
+
+	// journal-only records are not part of ledger
+	require.NoError(t, r.InsertJournal(ctx, changing.Transaction{AccountID: 1, Inc: changing.Inc{Balance: 5}}))
+
+	rep, err := Verify(ctx, r)
+	require.NoError(t, err)
+	assert.Equal(t, 5, rep.Accounts)
+	assert.Equal(t, 2000, rep.Entries)
+	assert.Empty(t, rep.Mismatches)
+}
+
+func TestVerify(t *testing.T) {
+	f := fake{
+		balances: []store.Balance{
+			// consistent, journal order doesn't matter
+			{AccountID: 1, Balance: 30},
+			// lost update: both transactions were applied to zero, balance has only the last one
+			{AccountID: 2, Balance: 20},
+			// balance changed behind journal
+			{AccountID: 3, Balance: 11},
+			// no journal
+			{AccountID: 4, Balance: 1},
+		},
+		journal: []store.Entry{
+			entry(1, 12, 20, 30),
+			entry(1, 11, 10, 10),
+			entry(2, 21, 10, 10),
+			entry(2, 22, 20, 20),
+			entry(3, 31, 10, 10),
+			// no balance
+			entry(5, 51, 10, 10),
+		},
+	}
+
+	rep, err := Verify(context.Background(), f)
+	require.NoError(t, err)
+	assert.Equal(t, 5, rep.Accounts)
+	assert.Equal(t, 6, rep.Entries)
+
+	problems := map[uint64][]string{}
+	for _, m := range rep.Mismatches {
+		problems[m.AccountID] = append(problems[m.AccountID], m.Problem)
+	}
+
+	assert.NotContains(t, problems, uint64(1))
+
+	require.Len(t, problems[2], 2)
+	assert.Contains(t, problems[2][0], "sum of journal increments: balance 20 != 30")
+	assert.Contains(t, problems[2][1], "1 of 2 journal entries don't continue running totals")
+	assert.Contains(t, problems[2][1], "lost update: transactions 22 and 21 both start from {balance: 0")
+
+	require.Len(t, problems[3], 2)
+	assert.Contains(t, problems[3][1], "last running totals of journal: balance 11 != 10")
+
+	assert.Equal(t, []string{"balance {balance: 1 depositAllSum: 0 depositCount: 0 pincoinBalance: 0 pincoinsAllSum: 0} has no journal entries"}, problems[4])
+	assert.Equal(t, []string{"no balance for 1 journal entries"}, problems[5])
+}
+
+func TestChainFloat4(t *testing.T) {
+	// totals of postgres are rounded to float4 after every increment
+	var (
+		entries []store.Entry
+		total   float32
+	)
+
+	for i := 0; i < 1000; i++ {
+		inc := 1234.567 + float64(i)/7
+		total += float32(inc)
+		entries = append(entries, entry(1, uint64(i), inc, float64(total)))
+	}
+
+	rand.New(rand.NewSource(1)).Shuffle(len(entries), func(i, j int) { entries[i], entries[j] = entries[j], entries[i] })
+
+	order, stranded := Chain(entries)
+	assert.Empty(t, stranded)
+	require.Len(t, order, len(entries))
+	assert.Equal(t, float64(total), entries[order[len(order)-1]].Total.Balance)
+}
+
+func TestChainRevert(t *testing.T) {
+	revert := func(account, tx uint64, inc, total float64) store.Entry {
+		e := entry(account, tx, inc, total)
+		e.Revert = true
+
+		return e
+	}
+
+	// reverts return account to zero and to 15, walk may take any entry which starts from the same totals
+	entries := []store.Entry{
+		entry(1, 3, 5, 5),
+		revert(1, 2, 10, 0),
+		entry(1, 4, 10, 15),
+		entry(1, 1, 10, 10),
+		revert(1, 5, 7, 15),
+		entry(1, 5, 7, 22),
+	}
+
+	for seed := int64(0); seed < 20; seed++ {
+		rand.New(rand.NewSource(seed)).Shuffle(len(entries), func(i, j int) { entries[i], entries[j] = entries[j], entries[i] })
+
+		order, stranded := Chain(entries)
+		assert.Empty(t, stranded)
+		require.Len(t, order, len(entries))
+		assert.Equal(t, 15.0, entries[order[len(order)-1]].Total.Balance)
+	}
+
+	assert.Empty(t, Account(store.Balance{AccountID: 1, Balance: 15}, true, entries))
+}
+
+func TestVerifyMemoryRevert(t *testing.T) {
+	ctx := context.Background()
+	r := memory.New()
+
+	for n := 0; n < 100; n++ {
+		req := changing.ChangeRequest{AccountID: uint64(n % 3), Type: changing.Deposit, Change: float64(n%4 + 1), PincoinChange: 1}
+
+		_, err := r.UpdateTX(ctx, req.Make())
+		require.NoError(t, err)
+
+		if n%2 == 0 {
+			_, err = r.Revert(ctx, strconv.Itoa(n/2*3))
+			require.NoError(t, err)
+		}
+	}
+
+	rep, err := Verify(ctx, r)
+	require.NoError(t, err)
+	assert.Equal(t, 150, rep.Entries)
+	assert.Empty(t, rep.Mismatches)
+}
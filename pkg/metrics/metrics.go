@@ -0,0 +1,279 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	Success  = "success"
+	Error    = "error"
+	Rejected = "rejected"
+)
+
+const namespace = "mongoab"
+
+// Buckets are upper bounds of latency histogram in seconds
+var Buckets = []float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Metrics of running benchmark in Prometheus text format.
+// All methods are safe for nil receiver, so callers don't check whether metrics are enabled.
+type Metrics struct {
+	mu      sync.RWMutex
+	ops     map[opKey]*uint64
+	errs    map[errKey]*uint64
+	latency map[string]*histogram
+
+	threads int64
+	rate    uint64 // float64 bits
+	warmup  int32
+}
+
+type opKey struct{ op, outcome string }
+
+type errKey struct{ op, class string }
+
+type histogram struct {
+	counts []uint64
+	count  uint64
+	sum    uint64 // nanoseconds
+}
+
+func New() *Metrics {
+	return &Metrics{
+		ops:     make(map[opKey]*uint64),
+		errs:    make(map[errKey]*uint64),
+		latency: make(map[string]*histogram),
+	}
+}
+
+// Observe successful operation of type op
+func (m *Metrics) Observe(op string, d time.Duration) {
+	if m == nil {
+		return
+	}
+
+	atomic.AddUint64(m.opCounter(opKey{op, Success}), 1)
+
+	h := m.histogram(op)
+	s := d.Seconds()
+	for i, b := range Buckets {
+		if s <= b {
+			atomic.AddUint64(&h.counts[i], 1)
+			break
+		}
+	}
+
+	atomic.AddUint64(&h.count, 1)
+	atomic.AddUint64(&h.sum, uint64(d))
+}
+
+// Fail counts failed operation of type op with error class
+func (m *Metrics) Fail(op, class string) {
+	if m == nil {
+		return
+	}
+
+	atomic.AddUint64(m.opCounter(opKey{op, Error}), 1)
+	atomic.AddUint64(m.errCounter(errKey{op, class}), 1)
+}
+
+// Reject counts operation of type op which business rule refused
+func (m *Metrics) Reject(op string) {
+	if m == nil {
+		return
+	}
+
+	atomic.AddUint64(m.opCounter(opKey{op, Rejected}), 1)
+}
+
+func (m *Metrics) SetThreads(n int64) {
+	if m == nil {
+		return
+	}
+
+	atomic.StoreInt64(&m.threads, n)
+}
+
+func (m *Metrics) SetRate(r float64) {
+	if m == nil {
+		return
+	}
+
+	atomic.StoreUint64(&m.rate, math.Float64bits(r))
+}
+
+func (m *Metrics) SetWarmup(on bool) {
+	if m == nil {
+		return
+	}
+
+	var v int32
+	if on {
+		v = 1
+	}
+
+	atomic.StoreInt32(&m.warmup, v)
+}
+
+func (m *Metrics) opCounter(k opKey) *uint64 {
+	m.mu.RLock()
+	c, ok := m.ops[k]
+	m.mu.RUnlock()
+
+	if ok {
+		return c
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if c, ok = m.ops[k]; !ok {
+		c = new(uint64)
+		m.ops[k] = c
+	}
+
+	return c
+}
+
+func (m *Metrics) errCounter(k errKey) *uint64 {
+	m.mu.RLock()
+	c, ok := m.errs[k]
+	m.mu.RUnlock()
+
+	if ok {
+		return c
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if c, ok = m.errs[k]; !ok {
+		c = new(uint64)
+		m.errs[k] = c
+	}
+
+	return c
+}
+
+func (m *Metrics) histogram(op string) *histogram {
+	m.mu.RLock()
+	h, ok := m.latency[op]
+	m.mu.RUnlock()
+
+	if ok {
+		return h
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if h, ok = m.latency[op]; !ok {
+		h = &histogram{counts: make([]uint64, len(Buckets))}
+		m.latency[op] = h
+	}
+
+	return h
+}
+
+// WriteTo writes all metrics in Prometheus text exposition format
+func (m *Metrics) WriteTo(out io.Writer) (int64, error) {
+	w := &countWriter{w: bufio.NewWriter(out)}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	w.printf("# HELP %s_operations_total Operations by type and outcome.\n", namespace)
+	w.printf("# TYPE %s_operations_total counter\n", namespace)
+	ops := make([]opKey, 0, len(m.ops))
+	for k := range m.ops {
+		ops = append(ops, k)
+	}
+
+	sort.Slice(ops, func(i, j int) bool {
+		return ops[i].op < ops[j].op || ops[i].op == ops[j].op && ops[i].outcome < ops[j].outcome
+	})
+
+	for _, k := range ops {
+		w.printf("%s_operations_total{type=%q,outcome=%q} %d\n", namespace, k.op, k.outcome, atomic.LoadUint64(m.ops[k]))
+	}
+
+	w.printf("# HELP %s_errors_total Failed operations by type and error class.\n", namespace)
+	w.printf("# TYPE %s_errors_total counter\n", namespace)
+	errs := make([]errKey, 0, len(m.errs))
+	for k := range m.errs {
+		errs = append(errs, k)
+	}
+
+	sort.Slice(errs, func(i, j int) bool {
+		return errs[i].op < errs[j].op || errs[i].op == errs[j].op && errs[i].class < errs[j].class
+	})
+
+	for _, k := range errs {
+		w.printf("%s_errors_total{type=%q,class=%q} %d\n", namespace, k.op, k.class, atomic.LoadUint64(m.errs[k]))
+	}
+
+	w.printf("# HELP %s_operation_duration_seconds Latency of successful operations.\n", namespace)
+	w.printf("# TYPE %s_operation_duration_seconds histogram\n", namespace)
+	types := make([]string, 0, len(m.latency))
+	for op := range m.latency {
+		types = append(types, op)
+	}
+
+	sort.Strings(types)
+
+	for _, op := range types {
+		h := m.latency[op]
+
+		var cum uint64
+		for i, b := range Buckets {
+			cum += atomic.LoadUint64(&h.counts[i])
+			w.printf("%s_operation_duration_seconds_bucket{type=%q,le=%q} %d\n", namespace, op, fmt.Sprint(b), cum)
+		}
+
+		count := atomic.LoadUint64(&h.count)
+		w.printf("%s_operation_duration_seconds_bucket{type=%q,le=\"+Inf\"} %d\n", namespace, op, count)
+		w.printf("%s_operation_duration_seconds_sum{type=%q} %g\n", namespace, op, time.Duration(atomic.LoadUint64(&h.sum)).Seconds())
+		w.printf("%s_operation_duration_seconds_count{type=%q} %d\n", namespace, op, count)
+	}
+
+	w.printf("# HELP %s_active_threads Threads currently applying load.\n", namespace)
+	w.printf("# TYPE %s_active_threads gauge\n", namespace)
+	w.printf("%s_active_threads %d\n", namespace, atomic.LoadInt64(&m.threads))
+
+	w.printf("# HELP %s_target_rate Open-loop target rate op/sec, 0 for closed-loop.\n", namespace)
+	w.printf("# TYPE %s_target_rate gauge\n", namespace)
+	w.printf("%s_target_rate %g\n", namespace, math.Float64frombits(atomic.LoadUint64(&m.rate)))
+
+	w.printf("# HELP %s_warmup 1 while warm-up is in progress.\n", namespace)
+	w.printf("# TYPE %s_warmup gauge\n", namespace)
+	w.printf("%s_warmup %d\n", namespace, atomic.LoadInt32(&m.warmup))
+
+	if w.err != nil {
+		return w.n, w.err
+	}
+
+	return w.n, w.w.Flush()
+}
+
+type countWriter struct {
+	w   *bufio.Writer
+	n   int64
+	err error
+}
+
+func (c *countWriter) printf(format string, args ...interface{}) {
+	if c.err != nil {
+		return
+	}
+
+	n, err := fmt.Fprintf(c.w, format, args...)
+	c.n += int64(n)
+	c.err = err
+}
@@ -0,0 +1,66 @@
+package metrics
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteTo(t *testing.T) {
+	m := New()
+	m.Observe("debit", 3*time.Millisecond)
+	m.Observe("debit", 30*time.Millisecond)
+	m.Fail("credit", "timeout")
+	m.Reject("credit")
+	m.SetThreads(10)
+
+	out := new(strings.Builder)
+	_, err := m.WriteTo(out)
+	require.NoError(t, err)
+
+	s := out.String()
+	assert.Contains(t, s, `mongoab_operations_total{type="debit",outcome="success"} 2`)
+	assert.Contains(t, s, `mongoab_operations_total{type="credit",outcome="error"} 1`)
+	assert.Contains(t, s, `mongoab_operations_total{type="credit",outcome="rejected"} 1`)
+	assert.Contains(t, s, `mongoab_errors_total{type="credit",class="timeout"} 1`)
+	assert.Contains(t, s, `mongoab_operation_duration_seconds_bucket{type="debit",le="0.0025"} 0`)
+	assert.Contains(t, s, `mongoab_operation_duration_seconds_bucket{type="debit",le="0.005"} 1`)
+	assert.Contains(t, s, `mongoab_operation_duration_seconds_bucket{type="debit",le="+Inf"} 2`)
+	assert.Contains(t, s, `mongoab_operation_duration_seconds_count{type="debit"} 2`)
+	assert.Contains(t, s, "mongoab_active_threads 10")
+}
+
+func TestNil(t *testing.T) {
+	var m *Metrics
+
+	assert.NotPanics(t, func() {
+		m.Observe("op", time.Millisecond)
+		m.Fail("op", "other")
+		m.SetThreads(1)
+		m.SetRate(1)
+		m.SetWarmup(true)
+	})
+}
+
+func TestListen(t *testing.T) {
+	srv, err := Listen("127.0.0.1:0")
+	require.NoError(t, err)
+
+	defer srv.Close()
+
+	srv.Observe("op", time.Millisecond)
+
+	res, err := http.Get("http://" + srv.Addr() + "/metrics")
+	require.NoError(t, err)
+
+	defer res.Body.Close()
+
+	b, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	assert.Contains(t, string(b), `mongoab_operations_total{type="op",outcome="success"} 1`)
+}
@@ -0,0 +1,66 @@
+package metrics
+
+import (
+	"context"
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Server exposes Metrics on /metrics
+type Server struct {
+	*Metrics
+
+	srv  *http.Server
+	addr string
+}
+
+// Listen starts HTTP listener on addr in background, nothing is pushed anywhere:
+// it is up to Prometheus to scrape it or not.
+func Listen(addr string) (*Server, error) {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	s := &Server{Metrics: New(), addr: l.Addr().String()}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", s.Metrics)
+
+	s.srv = &http.Server{Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+
+	go func() {
+		if err := s.srv.Serve(l); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("metrics server: %v", err)
+		}
+	}()
+
+	log.Printf("metrics: http://%s/metrics", s.addr)
+
+	return s, nil
+}
+
+// Addr of listener, useful when started on port 0
+func (s *Server) Addr() string {
+	return s.addr
+}
+
+func (s *Server) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	return errors.WithStack(s.srv.Shutdown(ctx))
+}
+
+// ServeHTTP writes metrics in Prometheus text format
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+
+	if _, err := m.WriteTo(w); err != nil {
+		log.Printf("metrics: %v", err)
+	}
+}
@@ -0,0 +1,59 @@
+package results
+
+import (
+	"net/url"
+	"time"
+
+	"github.com/urfave/cli/v2"
+)
+
+// Config collects effective value of every flag of command and its parent commands,
+// passwords in connection strings are masked
+func Config(c *cli.Context) map[string]interface{} {
+	out := make(map[string]interface{})
+
+	for _, ctx := range c.Lineage() {
+		var flags []cli.Flag
+		if ctx.Command != nil {
+			flags = ctx.Command.Flags
+		}
+
+		// parent of subcommands is run as application of its own
+		if len(flags) == 0 && ctx.App != nil {
+			flags = ctx.App.Flags
+		}
+
+		for _, f := range flags {
+			name := f.Names()[0]
+			if _, ok := out[name]; ok || name == "help" {
+				continue
+			}
+
+			v := ctx.Value(name)
+			switch t := v.(type) {
+			case string:
+				v = Mask(t)
+			case time.Duration:
+				v = t.String()
+			}
+
+			out[name] = v
+		}
+	}
+
+	return out
+}
+
+// Mask hides password of connection string
+func Mask(s string) string {
+	u, err := url.Parse(s)
+	if err != nil || u.User == nil {
+		return s
+	}
+
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), "xxxxx")
+	}
+
+	return u.String()
+}
@@ -0,0 +1,110 @@
+package results
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/d7561985/mongo-ab/pkg/worker"
+	"github.com/pkg/errors"
+)
+
+var csvHeader = []string{
+	"kind", "time", "elapsed_sec", "stage", "warmup", "threads", "ops", "failed", "rejected", "retries", "retries_per_op", "throughput",
+	"mean_ms", "p50_ms", "p90_ms", "p99_ms", "p999_ms", "max_ms",
+}
+
+// csvSink streams interval rows, stage and summary rows are appended when run finishes.
+// Configuration goes first as "# key=value" comment lines.
+type csvSink struct {
+	mu  sync.Mutex
+	f   *os.File
+	buf *bufio.Writer
+	w   *csv.Writer
+}
+
+func newCSV(f *os.File, config map[string]interface{}) (*csvSink, error) {
+	buf := bufio.NewWriter(f)
+
+	keys := make([]string, 0, len(config))
+	for k := range config {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		if _, err := fmt.Fprintf(buf, "# %s=%v\n", k, config[k]); err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+
+	w := csv.NewWriter(buf)
+	if err := w.Write(append(csvHeader, errorColumns()...)); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return &csvSink{f: f, buf: buf, w: w}, nil
+}
+
+func (c *csvSink) Sample(s worker.Sample) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	_ = c.w.Write(row(fromSample(s)))
+	c.w.Flush()
+}
+
+func (c *csvSink) Finish(s worker.Summary) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	defer c.f.Close()
+
+	for _, st := range s.Stages {
+		_ = c.w.Write(row(fromStage(st)))
+	}
+
+	_ = c.w.Write(row(fromSummary(kindSummary, s)))
+
+	c.w.Flush()
+	if err := c.w.Error(); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return errors.WithStack(c.buf.Flush())
+}
+
+func row(p Point) []string {
+	out := []string{
+		p.Kind,
+		p.Time.Format(time.RFC3339Nano),
+		formatFloat(p.Elapsed),
+		p.Stage,
+		strconv.FormatBool(p.Warmup),
+		strconv.FormatInt(p.Threads, 10),
+		strconv.FormatUint(p.Ops, 10),
+		strconv.FormatUint(p.Failed, 10),
+		strconv.FormatUint(p.Rejected, 10),
+		strconv.FormatUint(p.Retries, 10),
+		formatFloat(p.RetriesPerOp),
+		formatFloat(p.Throughput),
+		formatFloat(p.Latency.Mean),
+		formatFloat(p.Latency.P50),
+		formatFloat(p.Latency.P90),
+		formatFloat(p.Latency.P99),
+		formatFloat(p.Latency.P999),
+		formatFloat(p.Latency.Max),
+	}
+
+	for _, class := range errorColumns() {
+		out = append(out, strconv.FormatUint(p.Errors[class], 10))
+	}
+
+	return out
+}
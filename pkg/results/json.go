@@ -0,0 +1,65 @@
+package results
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+
+	"github.com/d7561985/mongo-ab/pkg/worker"
+	"github.com/pkg/errors"
+)
+
+// Document is the whole content of json results file
+type Document struct {
+	Config    map[string]interface{} `json:"config"`
+	Warmup    *Warmup                `json:"warmup,omitempty"`
+	Intervals []Point                `json:"intervals"`
+	Stages    []Point                `json:"stages,omitempty"`
+	Summary   Point                  `json:"summary"`
+}
+
+type Warmup struct {
+	Duration float64 `json:"durationSec"`
+	Ops      uint64  `json:"ops"`
+	Failed   uint64  `json:"failed"`
+}
+
+// jsonSink keeps time series in memory and writes single document when run finishes
+type jsonSink struct {
+	mu  sync.Mutex
+	f   *os.File
+	doc Document
+}
+
+func newJSON(f *os.File, config map[string]interface{}) *jsonSink {
+	return &jsonSink{f: f, doc: Document{Config: config, Intervals: []Point{}}}
+}
+
+func (j *jsonSink) Sample(s worker.Sample) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.doc.Intervals = append(j.doc.Intervals, fromSample(s))
+}
+
+func (j *jsonSink) Finish(s worker.Summary) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	defer j.f.Close()
+
+	if s.Warmup.Ops > 0 || s.Warmup.Failed > 0 {
+		j.doc.Warmup = &Warmup{Duration: s.Warmup.Duration.Seconds(), Ops: s.Warmup.Ops, Failed: s.Warmup.Failed}
+	}
+
+	for _, st := range s.Stages {
+		j.doc.Stages = append(j.doc.Stages, fromStage(st))
+	}
+
+	j.doc.Summary = fromSummary(kindSummary, s)
+
+	enc := json.NewEncoder(j.f)
+	enc.SetIndent("", "  ")
+
+	return errors.WithStack(enc.Encode(j.doc))
+}
@@ -0,0 +1,178 @@
+package results
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/d7561985/mongo-ab/pkg/errclass"
+	"github.com/d7561985/mongo-ab/pkg/worker"
+	"github.com/pkg/errors"
+)
+
+const (
+	JSON = "json"
+	CSV  = "csv"
+)
+
+// Open creates results file at path. Empty format is taken from file extension, json by default.
+// Config is the effective configuration of run which is stored next to results.
+func Open(path, format string, config map[string]interface{}) (worker.Sink, error) {
+	switch format {
+	case JSON, CSV:
+	case "":
+		if format = strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), "."); format != CSV {
+			format = JSON
+		}
+	default:
+		return nil, errors.Errorf("unsupported results format %q, use json or csv", format)
+	}
+
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	if format == CSV {
+		return newCSV(f, config)
+	}
+
+	return newJSON(f, config), nil
+}
+
+// Point is serialized form of worker.Sample, latencies are in milliseconds
+type Point struct {
+	Kind    string    `json:"kind"`
+	Time    time.Time `json:"time"`
+	Elapsed float64   `json:"elapsedSec"`
+	Stage   string    `json:"stage,omitempty"`
+	Target  string    `json:"target,omitempty"`
+	Warmup  bool      `json:"warmup,omitempty"`
+	Threads int64     `json:"threads,omitempty"`
+	Ops     uint64    `json:"ops"`
+	Failed  uint64    `json:"failed"`
+	// Rejected operations which business rule refused, they are not failures
+	Rejected uint64 `json:"rejected"`
+	Retries  uint64 `json:"retries"`
+	// RetriesPerOp is retries per successful operation
+	RetriesPerOp float64 `json:"retriesPerOp"`
+	// Dropped arrivals of open-loop run, summaries only
+	Dropped    uint64            `json:"dropped,omitempty"`
+	Throughput float64           `json:"throughput"`
+	Latency    Latency           `json:"latencyMs"`
+	Errors     map[string]uint64 `json:"errors,omitempty"`
+}
+
+type Latency struct {
+	Mean float64 `json:"mean"`
+	P50  float64 `json:"p50"`
+	P90  float64 `json:"p90"`
+	P99  float64 `json:"p99"`
+	P999 float64 `json:"p99.9"`
+	Max  float64 `json:"max"`
+}
+
+const (
+	kindInterval = "interval"
+	kindStage    = "stage"
+	kindSummary  = "summary"
+)
+
+func newLatency(l worker.Latency) Latency {
+	return Latency{
+		Mean: ms(l.Mean),
+		P50:  ms(l.P50),
+		P90:  ms(l.P90),
+		P99:  ms(l.P99),
+		P999: ms(l.P999),
+		Max:  ms(l.Max),
+	}
+}
+
+func fromSample(s worker.Sample) Point {
+	p := Point{
+		Kind:       kindInterval,
+		Time:       s.Time,
+		Elapsed:    s.Elapsed.Seconds(),
+		Stage:      s.Stage,
+		Warmup:     s.Warmup,
+		Threads:    s.Threads,
+		Ops:        s.Ops,
+		Failed:     s.Failed,
+		Rejected:   s.Rejected,
+		Retries:    s.Retries,
+		Throughput: s.Throughput,
+		Latency:    newLatency(s.Latency),
+		Errors:     errorsOf(s.Errors),
+	}
+
+	if s.Ops > 0 {
+		p.RetriesPerOp = float64(s.Retries) / float64(s.Ops)
+	}
+
+	return p
+}
+
+func fromSummary(kind string, s worker.Summary) Point {
+	return Point{
+		Kind:         kind,
+		Time:         time.Now(),
+		Elapsed:      s.Duration.Seconds(),
+		Ops:          s.Ops,
+		Failed:       s.Failed,
+		Rejected:     s.Rejected,
+		Retries:      s.Retries,
+		RetriesPerOp: s.RetriesPerOp(),
+		Dropped:      s.Dropped,
+		Throughput:   s.Throughput,
+		Latency:      newLatency(s.Latency),
+		Errors:       errorsOf(s.Errors),
+	}
+}
+
+func fromStage(s worker.StageSummary) Point {
+	p := fromSummary(kindStage, s.Summary)
+	p.Stage = s.Stage.Name
+	p.Target = s.Stage.String()
+
+	return p
+}
+
+func errorsOf(e worker.Errors) map[string]uint64 {
+	if len(e) == 0 {
+		return nil
+	}
+
+	out := make(map[string]uint64, len(e))
+	for k, v := range e {
+		out[string(k)] = v
+	}
+
+	return out
+}
+
+// columns of error classes in stable order
+func errorColumns() []string {
+	out := make([]string, 0, len(errclass.Classes))
+	for _, c := range errclass.Classes {
+		out = append(out, string(c))
+	}
+
+	return out
+}
+
+func ms(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+func formatFloat(v float64) string {
+	return fmt.Sprintf("%.3f", v)
+}
@@ -0,0 +1,155 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/urfave/cli/v2"
+)
+
+const (
+	defAttempts   = 10
+	defBackoff    = 5 * time.Millisecond
+	defMaxBackoff = 500 * time.Millisecond
+)
+
+// On are retried by default: transient transaction of mongo, serialization failure and deadlock of postgres
+var On = []string{"TransientTransactionError", "40001", "40P01"}
+
+const (
+	fAttempts   = "retry-attempts"
+	fBackoff    = "retry-backoff"
+	fMaxBackoff = "retry-max-backoff"
+	fOn         = "retry-on"
+)
+
+const (
+	EnvAttempts   = "RETRY_ATTEMPTS"
+	EnvBackoff    = "RETRY_BACKOFF"
+	EnvMaxBackoff = "RETRY_MAX_BACKOFF"
+	EnvOn         = "RETRY_ON"
+)
+
+// Policy of transaction retries, zero Policy makes single attempt.
+// Stores take Default for Policy without MaxAttempts, see OrDefault.
+type Policy struct {
+	// MaxAttempts including the first one
+	MaxAttempts int
+	// Backoff before the second attempt, it doubles with every next one up to MaxBackoff
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// On are mongo error labels or postgres SQLSTATE codes which are retried
+	On []string
+}
+
+// Default is Policy of Flags defaults
+func Default() Policy {
+	return Policy{MaxAttempts: defAttempts, Backoff: defBackoff, MaxBackoff: defMaxBackoff, On: append([]string(nil), On...)}
+}
+
+// OrDefault returns Default when MaxAttempts is not set, e.g. of config built without Flags
+func (p Policy) OrDefault() Policy {
+	if p.MaxAttempts <= 0 {
+		return Default()
+	}
+
+	return p
+}
+
+// Flags of Policy shared by stores
+func Flags() []cli.Flag {
+	return []cli.Flag{
+		&cli.IntFlag{Name: fAttempts, Value: defAttempts, Usage: "Attempts of transaction including the first one, 1 - no retries", EnvVars: []string{EnvAttempts}},
+		&cli.DurationFlag{Name: fBackoff, Value: defBackoff, Usage: "Backoff before the first retry, doubles with every next one, full jitter", EnvVars: []string{EnvBackoff}},
+		&cli.DurationFlag{Name: fMaxBackoff, Value: defMaxBackoff, Usage: "Max backoff between retries", EnvVars: []string{EnvMaxBackoff}},
+		&cli.StringFlag{Name: fOn, Value: strings.Join(On, ","), Usage: "Retried mongo error labels and postgres SQLSTATE codes", EnvVars: []string{EnvOn}},
+	}
+}
+
+// Get reads Policy of Flags
+func Get(c *cli.Context) Policy {
+	p := Policy{
+		MaxAttempts: c.Int(fAttempts),
+		Backoff:     c.Duration(fBackoff),
+		MaxBackoff:  c.Duration(fMaxBackoff),
+	}
+
+	for _, v := range strings.Split(c.String(fOn), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			p.On = append(p.On, v)
+		}
+	}
+
+	return p
+}
+
+func (p Policy) String() string {
+	return fmt.Sprintf("attempts: %d backoff: %v-%v on: %s", p.MaxAttempts, p.Backoff, p.MaxBackoff, strings.Join(p.On, ","))
+}
+
+// Retryable reports whether err has label or SQLSTATE of On
+func (p Policy) Retryable(err error) bool {
+	var (
+		le interface{ HasErrorLabel(string) bool }
+		pe *pgconn.PgError
+	)
+
+	hasLabel := errors.As(err, &le)
+	hasCode := errors.As(err, &pe)
+
+	for _, v := range p.On {
+		if hasLabel && le.HasErrorLabel(v) || hasCode && pe.Code == v {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Do calls fn until it succeeds, fails with error which is not Retryable or attempts are over.
+// It returns number of attempts made.
+func (p Policy) Do(ctx context.Context, fn func() error) (int, error) {
+	return p.DoWhen(ctx, p.Retryable, fn)
+}
+
+// DoWhen is Do which retries errors of retryable
+func (p Policy) DoWhen(ctx context.Context, retryable func(error) bool, fn func() error) (int, error) {
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= p.MaxAttempts || !retryable(err) {
+			return attempt, err
+		}
+
+		t := time.NewTimer(p.backoff(attempt))
+
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return attempt, err
+		case <-t.C:
+		}
+	}
+}
+
+// backoff after attempt: random in [0, Backoff*2^(attempt-1)] capped by MaxBackoff
+func (p Policy) backoff(attempt int) time.Duration {
+	d := p.Backoff
+	for i := 1; i < attempt && (p.MaxBackoff <= 0 || d < p.MaxBackoff); i++ {
+		d *= 2
+	}
+
+	if p.MaxBackoff > 0 && d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+
+	if d <= 0 {
+		return 0
+	}
+
+	return time.Duration(rand.Int63n(int64(d) + 1))
+}
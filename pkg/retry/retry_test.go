@@ -0,0 +1,99 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestRetryable(t *testing.T) {
+	p := Policy{On: On}
+
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{err: errors.New("plain")},
+		{err: mongo.CommandError{Code: 112, Labels: []string{"TransientTransactionError"}}, want: true},
+		{err: fmt.Errorf("wrapped: %w", mongo.CommandError{Labels: []string{"TransientTransactionError"}}), want: true},
+		{err: mongo.CommandError{Labels: []string{"UnknownTransactionCommitResult"}}},
+		{err: &pgconn.PgError{Code: "40001"}, want: true},
+		{err: fmt.Errorf("wrapped: %w", &pgconn.PgError{Code: "40P01"}), want: true},
+		{err: &pgconn.PgError{Code: "23505"}},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.want, p.Retryable(test.err), test.err.Error())
+	}
+
+	assert.False(t, Policy{}.Retryable(&pgconn.PgError{Code: "40001"}))
+}
+
+func TestDo(t *testing.T) {
+	conflict := &pgconn.PgError{Code: "40001"}
+	p := Policy{MaxAttempts: 5, Backoff: time.Microsecond, MaxBackoff: time.Millisecond, On: On}
+
+	calls := 0
+	attempts, err := p.Do(context.Background(), func() error {
+		if calls++; calls < 3 {
+			return conflict
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, attempts)
+
+	// attempts are over
+	attempts, err = p.Do(context.Background(), func() error { return conflict })
+	assert.ErrorIs(t, err, conflict)
+	assert.Equal(t, 5, attempts)
+
+	// not retryable
+	attempts, err = p.Do(context.Background(), func() error { return errors.New("fatal") })
+	assert.Error(t, err)
+	assert.Equal(t, 1, attempts)
+
+	// zero policy makes single attempt
+	attempts, _ = Policy{}.Do(context.Background(), func() error { return conflict })
+	assert.Equal(t, 1, attempts)
+
+	// canceled context stops backoff
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	attempts, err = Policy{MaxAttempts: 5, Backoff: time.Hour, On: On}.Do(ctx, func() error { return conflict })
+	assert.ErrorIs(t, err, conflict)
+	assert.Equal(t, 1, attempts)
+}
+
+func TestBackoff(t *testing.T) {
+	p := Policy{Backoff: time.Millisecond, MaxBackoff: 10 * time.Millisecond}
+
+	for attempt := 1; attempt < 100; attempt++ {
+		d := p.backoff(attempt)
+		assert.GreaterOrEqual(t, d, time.Duration(0))
+		assert.LessOrEqual(t, d, 10*time.Millisecond)
+
+		if attempt <= 3 {
+			assert.LessOrEqual(t, d, time.Millisecond<<(attempt-1))
+		}
+	}
+
+	assert.Zero(t, Policy{}.backoff(3))
+}
+
+func TestOrDefault(t *testing.T) {
+	// config built without Flags keeps retries of transient errors
+	p := Policy{}.OrDefault()
+	assert.Equal(t, Default(), p)
+	assert.True(t, p.Retryable(&pgconn.PgError{Code: "40001"}))
+
+	single := Policy{MaxAttempts: 1}
+	assert.Equal(t, single, single.OrDefault())
+}
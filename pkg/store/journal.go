@@ -0,0 +1,110 @@
+package store
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/d7561985/mongo-ab/pkg/changing"
+)
+
+var (
+	// ErrBadCursor is returned for cursor which is not Next of ListJournal
+	ErrBadCursor = errors.New("bad journal cursor")
+	// ErrBadLimit is returned for limit of ListJournal which is not positive
+	ErrBadLimit = errors.New("journal limit must be positive")
+)
+
+// Record is journal record returned by ListJournal, Inc is zero for record of InsertJournal
+type Record struct {
+	Entry
+	// ID is key of record in store
+	ID              string
+	Date            time.Time
+	TransactionType string
+	Project         string
+	Change          float64
+
+	// RevertOf is ID of record which compensating record reverts, RevertedBy is ID of compensating record of reverted one
+	RevertOf   string
+	RevertedBy string
+}
+
+// Revertible reports whether record is of UpdateTX which is not reverted yet
+func (r Record) Revertible() bool {
+	return !r.Revert && r.RevertedBy == "" && r.Inc != (changing.Inc{})
+}
+
+// Page of ListJournal, Next is cursor of the following page, empty on the last one
+type Page struct {
+	Records []Record
+	Next    string
+}
+
+// JournalLister is store which serves journal of account page by page
+type JournalLister interface {
+	// ListJournal returns up to limit records of account with date in [from, to), the latest first.
+	// Zero from or to is unbounded, cursor is Next of the previous page, empty for the first one.
+	ListJournal(ctx context.Context, account uint64, from, to time.Time, cursor string, limit int) (Page, error)
+}
+
+// Cursor is position of the last record of page: records before it in order of ListJournal are skipped
+type Cursor struct {
+	Date time.Time
+	ID   string
+}
+
+// CursorOf is position of record
+func CursorOf(r Record) Cursor {
+	return Cursor{Date: r.Date, ID: r.ID}
+}
+
+// String is opaque form of cursor which ParseCursor reads
+func (c Cursor) String() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%d:%s", c.Date.UnixNano(), c.ID)))
+}
+
+// ParseCursor reads Cursor.String, empty string is zero cursor of the first page.
+// Date is UTC: postgres writes wall clock of time to TIMESTAMP without zone.
+func ParseCursor(in string) (Cursor, error) {
+	if in == "" {
+		return Cursor{}, nil
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(in)
+	if err != nil {
+		return Cursor{}, fmt.Errorf("%w: %v", ErrBadCursor, err)
+	}
+
+	parts := strings.SplitN(string(b), ":", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return Cursor{}, fmt.Errorf("%w: %q", ErrBadCursor, in)
+	}
+
+	ns, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return Cursor{}, fmt.Errorf("%w: %v", ErrBadCursor, err)
+	}
+
+	return Cursor{Date: time.Unix(0, ns).UTC(), ID: parts[1]}, nil
+}
+
+// IsZero reports whether cursor is of the first page
+func (c Cursor) IsZero() bool {
+	return c.ID == ""
+}
+
+// NewPage cuts records read with limit+1 to page of limit, Next is set when there is more
+func NewPage(records []Record, limit int) Page {
+	if limit <= 0 || len(records) <= limit {
+		return Page{Records: records}
+	}
+
+	records = records[:limit]
+
+	return Page{Records: records, Next: CursorOf(records[limit-1]).String()}
+}
@@ -0,0 +1,386 @@
+package memory
+
+import (
+	"context"
+	"math"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/d7561985/mongo-ab/pkg/changing"
+	"github.com/d7561985/mongo-ab/pkg/funds"
+	"github.com/d7561985/mongo-ab/pkg/store"
+	"github.com/pkg/errors"
+	"github.com/urfave/cli/v2"
+)
+
+// Epsilon is tolerance of Compare, postgres keeps balance in float4
+const Epsilon = 1e-3
+
+const fIdempotent = "idempotent"
+
+const EnvIdempotent = "MEMORY_IDEMPOTENT"
+
+func init() {
+	store.Register(store.Backend{
+		Name:      "memory",
+		Ephemeral: true,
+		Flags: append([]cli.Flag{
+			&cli.BoolFlag{Name: fIdempotent, Usage: "Apply transaction once: redelivery of transactionId returns recorded result", EnvVars: []string{EnvIdempotent}},
+		}, funds.Flags()...),
+		Open: func(c *cli.Context) (store.Store, error) {
+			mode := funds.Get(c)
+			if err := mode.Validate(); err != nil {
+				return nil, errors.WithStack(err)
+			}
+
+			if c.Bool(fIdempotent) {
+				return NewIdempotent().WithFunds(mode), nil
+			}
+
+			return New().WithFunds(mode), nil
+		},
+	})
+}
+
+// Record is journal entry: fields of transaction and totals of account after it
+type Record struct {
+	store.Balance
+	changing.Set
+	// Inc is increments of UpdateTX, nil for InsertJournal. Compensating record of Revert keeps Inc of reverted one.
+	Inc *changing.Inc
+
+	// RevertOf and RevertedBy link compensating and reverted records by ID, position in journal
+	RevertOf   string
+	RevertedBy string
+}
+
+func (r Record) entry() store.Entry {
+	e := store.Entry{AccountID: r.AccountID, TransactionID: r.TransactionID, Total: r.Balance, Revert: r.Revert}
+	if r.Inc != nil {
+		e.Inc = *r.Inc
+	}
+
+	return e
+}
+
+func (r Record) record(i int) store.Record {
+	return store.Record{Entry: r.entry(), ID: strconv.Itoa(i), Date: r.Date, TransactionType: r.TransactionType,
+		Project: r.Project, Change: r.Change, RevertOf: r.RevertOf, RevertedBy: r.RevertedBy}
+}
+
+// Repo keeps billing semantics of mongo.Repo.HandleBillingOperation in memory:
+// balance is incremented, then journal gets record with totals after increment.
+// It is safe for concurrent use.
+type Repo struct {
+	mu       sync.RWMutex
+	balances map[uint64]store.Balance
+	journal  []Record
+	// positions of journal records of account in order of journal
+	positions map[uint64][]int
+
+	// recorded post-balances of transactions, nil unless idempotent
+	recorded map[uint64]store.Balance
+
+	// funds check of decrements, every mode is the same check under lock
+	funds funds.Mode
+}
+
+var (
+	_ store.Store         = (*Repo)(nil)
+	_ store.Ledger        = (*Repo)(nil)
+	_ store.Deduplicator  = (*Repo)(nil)
+	_ store.JournalLister = (*Repo)(nil)
+	_ store.Reverter      = (*Repo)(nil)
+)
+
+func New() *Repo {
+	return &Repo{balances: make(map[uint64]store.Balance), positions: make(map[uint64][]int)}
+}
+
+// NewIdempotent returns Repo which applies UpdateTX of the same transaction id once
+func NewIdempotent() *Repo {
+	r := New()
+	r.recorded = make(map[uint64]store.Balance)
+
+	return r
+}
+
+// WithFunds sets insufficient funds rule of UpdateTX and Revert
+func (r *Repo) WithFunds(m funds.Mode) *Repo {
+	r.funds = m
+
+	return r
+}
+
+func (r *Repo) Idempotent() bool {
+	return r.recorded != nil
+}
+
+func (r *Repo) Setup(context.Context) error { return nil }
+
+func (r *Repo) UpdateTX(_ context.Context, in changing.Transaction) (store.Balance, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if b, ok := r.recorded[in.TransactionID]; ok {
+		return b, nil
+	}
+
+	// refused transaction is not recorded, redelivery is checked again
+	if r.funds.Refuses(r.balances[in.AccountID].Balance, in.Balance) {
+		return store.Balance{}, errors.WithStack(store.ErrInsufficientFunds)
+	}
+
+	b := inc(r.balances[in.AccountID], in)
+	r.balances[in.AccountID] = b
+	r.append(Record{Balance: b, Set: in.Set, Inc: &in.Inc})
+
+	if r.recorded != nil {
+		r.recorded[in.TransactionID] = b
+	}
+
+	return b, nil
+}
+
+// InsertJournal writes increments of transaction as its totals, like mongo.Repo.Insert does
+func (r *Repo) InsertJournal(_ context.Context, in changing.Transaction) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.append(Record{Balance: inc(store.Balance{}, in), Set: in.Set})
+
+	return nil
+}
+
+func (r *Repo) GetBalance(_ context.Context, account uint64) (store.Balance, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	b, ok := r.balances[account]
+	if !ok {
+		return store.Balance{}, errors.WithStack(store.ErrNotFound)
+	}
+
+	return b, nil
+}
+
+func (r *Repo) Teardown(context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.balances = make(map[uint64]store.Balance)
+	r.journal = nil
+	r.positions = make(map[uint64][]int)
+
+	if r.recorded != nil {
+		r.recorded = make(map[uint64]store.Balance)
+	}
+
+	return nil
+}
+
+func (r *Repo) Close(context.Context) error { return nil }
+
+// Balances returns every account sorted by id
+func (r *Repo) Balances() []store.Balance {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	out := make([]store.Balance, 0, len(r.balances))
+	for _, b := range r.balances {
+		out = append(out, b)
+	}
+
+	sort.Slice(out, func(i, j int) bool { return out[i].AccountID < out[j].AccountID })
+
+	return out
+}
+
+// Journal returns copy of records in order of writing
+func (r *Repo) Journal() []Record {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return append([]Record(nil), r.journal...)
+}
+
+func (r *Repo) ScanBalances(_ context.Context, fn func(store.Balance) error) error {
+	for _, b := range r.Balances() {
+		if err := fn(b); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *Repo) ScanJournal(_ context.Context, fn func(store.Entry) error) error {
+	for _, rec := range r.Journal() {
+		if rec.Inc == nil {
+			continue
+		}
+
+		if err := fn(rec.entry()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ListJournal pages records of account, ID of record is its position in journal
+func (r *Repo) ListJournal(_ context.Context, account uint64, from, to time.Time, cursor string, limit int) (store.Page, error) {
+	if limit <= 0 {
+		return store.Page{}, errors.WithStack(store.ErrBadLimit)
+	}
+
+	c, err := store.ParseCursor(cursor)
+	if err != nil {
+		return store.Page{}, errors.WithStack(err)
+	}
+
+	after := -1
+	if !c.IsZero() {
+		if after, err = strconv.Atoi(c.ID); err != nil {
+			return store.Page{}, errors.WithStack(store.ErrBadCursor)
+		}
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var out []store.Record
+	for _, i := range r.positions[account] {
+		rec := r.journal[i]
+		if !from.IsZero() && rec.Date.Before(from) || !to.IsZero() && !rec.Date.Before(to) {
+			continue
+		}
+
+		if !c.IsZero() && !(rec.Date.Before(c.Date) || rec.Date.Equal(c.Date) && i < after) {
+			continue
+		}
+
+		out = append(out, rec.record(i))
+	}
+
+	// the latest first, the later position first among records of the same date
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Date.After(out[j].Date) })
+
+	if len(out) > limit+1 {
+		out = out[:limit+1]
+	}
+
+	return store.NewPage(out, limit), nil
+}
+
+// append record to journal, lock is held by caller
+func (r *Repo) append(rec Record) {
+	r.positions[rec.AccountID] = append(r.positions[rec.AccountID], len(r.journal))
+	r.journal = append(r.journal, rec)
+}
+
+// Revert subtracts increments of UpdateTX record from balance and appends compensating record
+func (r *Repo) Revert(_ context.Context, journalID string) (store.Record, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i, err := strconv.Atoi(journalID)
+	if err != nil || i < 0 || i >= len(r.journal) {
+		return store.Record{}, errors.WithStack(store.ErrNoRecord)
+	}
+
+	orig := &r.journal[i]
+
+	switch {
+	case orig.Inc == nil || orig.Revert:
+		return store.Record{}, errors.WithStack(store.ErrNotRevertible)
+	case orig.RevertedBy != "":
+		return store.Record{}, errors.WithStack(store.ErrReverted)
+	}
+
+	if r.funds.Refuses(r.balances[orig.AccountID].Balance, -orig.Inc.Balance) {
+		return store.Record{}, errors.WithStack(store.ErrInsufficientFunds)
+	}
+
+	b := sub(r.balances[orig.AccountID], *orig.Inc)
+	r.balances[orig.AccountID] = b
+
+	rec := Record{Balance: b, Set: orig.Set, Inc: orig.Inc, RevertOf: journalID}
+	rec.Date, rec.Revert = time.Now(), true
+
+	orig.RevertedBy = strconv.Itoa(len(r.journal))
+	r.append(rec)
+
+	return rec.record(len(r.journal) - 1), nil
+}
+
+// Mismatch is account whose balance in store differs from oracle
+type Mismatch struct {
+	Want store.Balance
+	Got  store.Balance
+	// Missing means store has no such account
+	Missing bool
+}
+
+// Compare reads every account of r from s, r is oracle which received the same successful transactions
+func (r *Repo) Compare(ctx context.Context, s store.Store) ([]Mismatch, error) {
+	var out []Mismatch
+
+	for _, want := range r.Balances() {
+		got, err := s.GetBalance(ctx, want.AccountID)
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			out = append(out, Mismatch{Want: want, Missing: true})
+			continue
+		case err != nil:
+			return out, errors.WithStack(err)
+		}
+
+		if !Equal(want, got) {
+			out = append(out, Mismatch{Want: want, Got: got})
+		}
+	}
+
+	return out, nil
+}
+
+// Equal compares balances with Epsilon tolerance
+func Equal(a, b store.Balance) bool {
+	return a.AccountID == b.AccountID &&
+		a.DepositCount == b.DepositCount &&
+		near(a.Balance, b.Balance) &&
+		near(a.DepositAllSum, b.DepositAllSum) &&
+		near(a.PincoinBalance, b.PincoinBalance) &&
+		near(a.PincoinsAllSum, b.PincoinsAllSum)
+}
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) <= Epsilon*math.Max(1, math.Abs(a))
+}
+
+func sub(b store.Balance, in changing.Inc) store.Balance {
+	b.Balance -= in.Balance
+	b.DepositAllSum -= in.DepositAllSum
+	b.DepositCount -= in.DepositCount
+	b.PincoinBalance -= in.PincoinBalance
+	b.PincoinsAllSum -= in.PincoinsAllSum
+
+	return b
+}
+
+func inc(b store.Balance, in changing.Transaction) store.Balance {
+	b.AccountID = in.AccountID
+	b.Balance += in.Balance
+	b.DepositAllSum += in.DepositAllSum
+	b.DepositCount += in.DepositCount
+	b.PincoinBalance += in.PincoinBalance
+	b.PincoinsAllSum += in.PincoinsAllSum
+
+	return b
+}
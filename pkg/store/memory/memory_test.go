@@ -0,0 +1,295 @@
+package memory
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/d7561985/mongo-ab/pkg/changing"
+	"github.com/d7561985/mongo-ab/pkg/funds"
+	"github.com/d7561985/mongo-ab/pkg/store"
+	"github.com/d7561985/mongo-ab/pkg/store/storetest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func deposit(account uint64, v float64) changing.Transaction {
+	return changing.Transaction{
+		AccountID: account,
+		Inc:       changing.Inc{Balance: v, DepositAllSum: v, DepositCount: 1, PincoinBalance: v / 100, PincoinsAllSum: v / 100},
+		Set:       changing.Set{Change: v, TransactionType: "deposit"},
+	}
+}
+
+func TestUpdateTX(t *testing.T) {
+	ctx := context.Background()
+	r := New()
+
+	_, err := r.GetBalance(ctx, 1)
+	assert.ErrorIs(t, err, store.ErrNotFound)
+
+	b, err := r.UpdateTX(ctx, deposit(1, 100))
+	require.NoError(t, err)
+	assert.Equal(t, store.Balance{AccountID: 1, Balance: 100, DepositAllSum: 100, DepositCount: 1, PincoinBalance: 1, PincoinsAllSum: 1}, b)
+
+	bet := changing.Transaction{AccountID: 1, Inc: changing.Inc{Balance: -30}, Set: changing.Set{Change: -30, TransactionType: "bet"}}
+	b, err = r.UpdateTX(ctx, bet)
+	require.NoError(t, err)
+	assert.Equal(t, 70.0, b.Balance)
+	assert.Equal(t, uint64(1), b.DepositCount)
+
+	got, err := r.GetBalance(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, b, got)
+
+	// journal keeps totals after every transaction
+	j := r.Journal()
+	require.Len(t, j, 2)
+	assert.Equal(t, 100.0, j[0].Balance.Balance)
+	assert.Equal(t, 70.0, j[1].Balance.Balance)
+	assert.Equal(t, "bet", j[1].TransactionType)
+
+	require.NoError(t, r.InsertJournal(ctx, deposit(2, 5)))
+	assert.Len(t, r.Journal(), 3)
+
+	_, err = r.GetBalance(ctx, 2)
+	assert.ErrorIs(t, err, store.ErrNotFound, "insert doesn't change balance")
+
+	require.NoError(t, r.Teardown(ctx))
+	assert.Empty(t, r.Balances())
+	assert.Empty(t, r.Journal())
+}
+
+func TestConcurrent(t *testing.T) {
+	ctx := context.Background()
+	r := New()
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for n := 0; n < 1000; n++ {
+				_, err := r.UpdateTX(ctx, deposit(uint64(n%10), 1))
+				assert.NoError(t, err)
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	balances := r.Balances()
+	require.Len(t, balances, 10)
+
+	for i, b := range balances {
+		assert.Equal(t, uint64(i), b.AccountID)
+		assert.Equal(t, 800.0, b.Balance)
+		assert.Equal(t, uint64(800), b.DepositCount)
+	}
+
+	assert.Len(t, r.Journal(), 8000)
+}
+
+func TestIdempotent(t *testing.T) {
+	ctx := context.Background()
+	r := NewIdempotent()
+	assert.True(t, r.Idempotent())
+	assert.False(t, New().Idempotent())
+
+	first := deposit(1, 10)
+	first.TransactionID = 7
+
+	want, err := r.UpdateTX(ctx, first)
+	require.NoError(t, err)
+
+	_, err = r.UpdateTX(ctx, deposit(1, 5))
+	require.NoError(t, err)
+
+	// redelivery returns recorded result and leaves balance alone
+	got, err := r.UpdateTX(ctx, first)
+	require.NoError(t, err)
+	assert.Equal(t, want, got)
+
+	// the same id to another account is redelivery too
+	other := deposit(2, 10)
+	other.TransactionID = 7
+	got, err = r.UpdateTX(ctx, other)
+	require.NoError(t, err)
+	assert.Equal(t, want, got)
+
+	b, err := r.GetBalance(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, 15.0, b.Balance)
+	_, err = r.GetBalance(ctx, 2)
+	assert.ErrorIs(t, err, store.ErrNotFound)
+	assert.Len(t, r.Journal(), 2)
+
+	require.NoError(t, r.Teardown(ctx))
+	got, err = r.UpdateTX(ctx, first)
+	require.NoError(t, err)
+	assert.Equal(t, 10.0, got.Balance)
+}
+
+func TestCompare(t *testing.T) {
+	ctx := context.Background()
+	oracle, target := New(), New()
+
+	for _, tx := range []changing.Transaction{deposit(1, 10), deposit(2, 20), deposit(3, 30)} {
+		_, err := oracle.UpdateTX(ctx, tx)
+		require.NoError(t, err)
+	}
+
+	_, _ = target.UpdateTX(ctx, deposit(1, 10.000001))
+	_, _ = target.UpdateTX(ctx, deposit(2, 25))
+
+	res, err := oracle.Compare(ctx, target)
+	require.NoError(t, err)
+	require.Len(t, res, 2)
+
+	assert.Equal(t, uint64(2), res[0].Want.AccountID)
+	assert.Equal(t, 25.0, res[0].Got.Balance)
+	assert.False(t, res[0].Missing)
+
+	assert.Equal(t, uint64(3), res[1].Want.AccountID)
+	assert.True(t, res[1].Missing)
+}
+
+func TestListJournal(t *testing.T) {
+	ctx := context.Background()
+	r := New()
+
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		tx := deposit(1, 10)
+		// two records of every date
+		tx.Date = start.Add(time.Duration(i/2) * time.Second)
+		tx.TransactionID = uint64(i)
+
+		_, err := r.UpdateTX(ctx, tx)
+		require.NoError(t, err)
+	}
+
+	require.NoError(t, r.InsertJournal(ctx, deposit(2, 5)))
+
+	var (
+		ids    []uint64
+		cursor string
+	)
+
+	for {
+		p, err := r.ListJournal(ctx, 1, time.Time{}, time.Time{}, cursor, 2)
+		require.NoError(t, err)
+
+		for _, rec := range p.Records {
+			ids = append(ids, rec.TransactionID)
+		}
+
+		if cursor = p.Next; cursor == "" {
+			break
+		}
+	}
+
+	assert.Equal(t, []uint64{4, 3, 2, 1, 0}, ids)
+
+	p, err := r.ListJournal(ctx, 1, start.Add(time.Second), start.Add(2*time.Second), "", 10)
+	require.NoError(t, err)
+	require.Len(t, p.Records, 2)
+	assert.Equal(t, 40.0, p.Records[0].Total.Balance)
+	assert.Equal(t, 10.0, p.Records[0].Inc.Balance)
+
+	p, err = r.ListJournal(ctx, 2, time.Time{}, time.Time{}, "", 10)
+	require.NoError(t, err)
+	require.Len(t, p.Records, 1)
+	assert.Zero(t, p.Records[0].Inc, "journal-only record has no increments")
+
+	_, err = r.ListJournal(ctx, 1, time.Time{}, time.Time{}, "", 0)
+	assert.ErrorIs(t, err, store.ErrBadLimit)
+}
+
+func TestRevert(t *testing.T) {
+	ctx := context.Background()
+	r := New()
+
+	_, err := r.UpdateTX(ctx, deposit(1, 10))
+	require.NoError(t, err)
+
+	_, err = r.UpdateTX(ctx, deposit(1, 5))
+	require.NoError(t, err)
+
+	require.NoError(t, r.InsertJournal(ctx, deposit(1, 7)))
+
+	rec, err := r.Revert(ctx, "0")
+	require.NoError(t, err)
+	assert.True(t, rec.Revert)
+	assert.Equal(t, "3", rec.ID)
+	assert.Equal(t, "0", rec.RevertOf)
+	assert.Equal(t, 10.0, rec.Inc.Balance)
+	assert.Equal(t, 5.0, rec.Total.Balance)
+	assert.Equal(t, uint64(1), rec.Total.DepositCount)
+	assert.False(t, rec.Revertible())
+
+	b, err := r.GetBalance(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, 5.0, b.Balance)
+
+	_, err = r.Revert(ctx, "0")
+	assert.ErrorIs(t, err, store.ErrReverted)
+
+	// compensating and journal-only records
+	_, err = r.Revert(ctx, "3")
+	assert.ErrorIs(t, err, store.ErrNotRevertible)
+
+	_, err = r.Revert(ctx, "2")
+	assert.ErrorIs(t, err, store.ErrNotRevertible)
+
+	_, err = r.Revert(ctx, "9")
+	assert.ErrorIs(t, err, store.ErrNoRecord)
+
+	p, err := r.ListJournal(ctx, 1, time.Time{}, time.Time{}, "", 10)
+	require.NoError(t, err)
+	require.Len(t, p.Records, 4)
+
+	orig := p.Records[len(p.Records)-1]
+	assert.Equal(t, "0", orig.ID)
+	assert.Equal(t, "3", orig.RevertedBy)
+	assert.False(t, orig.Revertible())
+}
+
+func TestFunds(t *testing.T) {
+	ctx := context.Background()
+	r := NewIdempotent().WithFunds(funds.Application)
+
+	bet := changing.Transaction{AccountID: 1, Inc: changing.Inc{Balance: -30}, Set: changing.Set{TransactionID: 1, Change: -30, TransactionType: "bet"}}
+	_, err := r.UpdateTX(ctx, bet)
+	assert.ErrorIs(t, err, store.ErrInsufficientFunds)
+	assert.Empty(t, r.Journal())
+
+	in := deposit(1, 20)
+	in.TransactionID = 2
+	_, err = r.UpdateTX(ctx, in)
+	require.NoError(t, err)
+
+	// the same transaction is applied once balance covers it
+	in = deposit(1, 10)
+	in.TransactionID = 3
+	_, err = r.UpdateTX(ctx, in)
+	require.NoError(t, err)
+
+	b, err := r.UpdateTX(ctx, bet)
+	require.NoError(t, err)
+	assert.Equal(t, 0.0, b.Balance)
+
+	// revert of deposit takes balance below zero
+	_, err = r.Revert(ctx, "0")
+	assert.ErrorIs(t, err, store.ErrInsufficientFunds)
+
+	rec, err := r.Revert(ctx, "2")
+	require.NoError(t, err)
+	assert.Equal(t, 30.0, rec.Total.Balance)
+}
+
+func TestContract(t *testing.T) {
+	storetest.JournalLister(t, New(), 1)
+}
@@ -0,0 +1,110 @@
+package mongo
+
+import (
+	"strings"
+
+	"github.com/d7561985/mongo-ab/internal/config"
+	"github.com/d7561985/mongo-ab/pkg/funds"
+	"github.com/d7561985/mongo-ab/pkg/retry"
+	"github.com/d7561985/mongo-ab/pkg/store"
+	"github.com/pkg/errors"
+	"github.com/urfave/cli/v2"
+)
+
+var dbConnect = "mongodb://3.67.76.232:50000"
+
+const (
+	fAddr             = "addr"
+	fDB               = "db"
+	fColBalance       = "balance"
+	fColJournal       = "journal"
+	fCompression      = "compression"
+	fCompressionLevel = "compressionLevel"
+	fWriteConcern     = "wc"
+	fWriteConcernW    = "W"
+	fWriteConcernJ    = "J"
+	fShardNum         = "shards"
+	fIndexes          = "index"
+	fValidation       = "validation"
+	fIdempotent       = "idempotent"
+)
+
+const (
+	EnvMongoAddr              = "MONGO_ADDR"
+	EnvMongoDB                = "MONGO_DB"
+	EnvMongoCollectionBalance = "MONGO_COLLECTION_BALANCE"
+	ENVMongoCollectionJournal = "MONGO_COLLECTION_JOURNAL"
+	EnvCompression            = "MONGO_COMPRESSION"
+	EnvCompressionLevel       = "MONGO_COMPRESSION_LEVEL"
+	EnvWriteConcernJ          = "MONGO_WRITE_CONCERN_J"
+	EnvShards                 = "MONGO_SHARDS"
+	EnvIdempotent             = "MONGO_IDEMPOTENT"
+)
+
+func init() {
+	store.Register(store.Backend{
+		Name:  "mongo",
+		Flags: Flags(),
+		Open: func(c *cli.Context) (store.Store, error) {
+			r, err := Connect(GetCfg(c))
+			if err != nil {
+				return nil, errors.WithStack(err)
+			}
+
+			return r, nil
+		},
+		Target: func(c *cli.Context) string {
+			return strings.Join([]string{c.String(fAddr), c.String(fDB), c.String(fColBalance), c.String(fColJournal)}, "/")
+		},
+	})
+}
+
+// Flags are flags of mongo connection and schema
+func Flags() []cli.Flag {
+	return append([]cli.Flag{
+		&cli.StringFlag{Name: fAddr, Value: dbConnect, EnvVars: []string{EnvMongoAddr}},
+		&cli.StringFlag{Name: fDB, Value: "db", EnvVars: []string{EnvMongoDB}},
+		&cli.StringFlag{Name: fColBalance, Value: "bench_balance", EnvVars: []string{EnvMongoCollectionBalance}},
+		&cli.StringFlag{Name: fColJournal, Value: "bench_journal", EnvVars: []string{ENVMongoCollectionJournal}},
+
+		&cli.StringFlag{Name: fCompression, Value: "snappy", Usage: "zlib, zstd, snappy", EnvVars: []string{EnvCompression}},
+		&cli.IntFlag{Name: fCompressionLevel, Value: 0, Usage: "zlib: max 9, zstd: max 20, snappy: not used", EnvVars: []string{EnvCompressionLevel}},
+		&cli.BoolFlag{Name: fWriteConcernJ, Value: false, EnvVars: []string{EnvWriteConcernJ}, Usage: "Write Concern Journal confirmation"},
+		&cli.IntFlag{Name: fWriteConcernW, Value: 0, Usage: "Write concert W confirmation"},
+		&cli.BoolFlag{Name: fWriteConcern, Value: true, Usage: "Enable Write concern feature"},
+
+		&cli.IntFlag{Name: fShardNum, Value: 0, EnvVars: []string{EnvShards}},
+		&cli.StringFlag{Name: fIndexes, Value: "hashed"},
+		&cli.BoolFlag{Name: fValidation, Value: true, Aliases: []string{"v"}, Usage: "Schema validation"},
+		&cli.BoolFlag{Name: fIdempotent, Usage: "Apply transaction once: redelivery of transactionId returns recorded result", EnvVars: []string{EnvIdempotent}},
+	}, append(retry.Flags(), funds.Flags()...)...)
+}
+
+// GetCfg reads config of Flags
+func GetCfg(c *cli.Context) config.Mongo {
+	return config.Mongo{
+		Addr:       c.String(fAddr),
+		DB:         c.String(fDB),
+		Indexes:    c.String(fIndexes),
+		Validation: c.Bool(fValidation),
+		Idempotent: c.Bool(fIdempotent),
+		Retry:      retry.Get(c),
+		Funds:      funds.Get(c),
+		Collections: struct {
+			Balance string
+			Journal string
+		}{
+			Balance: c.String(fColBalance),
+			Journal: c.String(fColJournal),
+		},
+		Compression: struct {
+			Type  string
+			Level int
+		}{Type: c.String(fCompression), Level: c.Int(fCompressionLevel)},
+		WriteConcert: struct {
+			Enabled bool
+			Journal bool
+			W       int
+		}{Enabled: c.Bool(fWriteConcern), Journal: c.Bool(fWriteConcernJ), W: c.Int(fWriteConcernW)},
+	}
+}
@@ -0,0 +1,19 @@
+//go:build integration
+// +build integration
+
+package mongo
+
+import (
+	"testing"
+	"time"
+
+	"github.com/d7561985/mongo-ab/pkg/store/storetest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestContract(t *testing.T) {
+	q, err := New(cfg)
+	require.NoError(t, err)
+
+	storetest.JournalLister(t, q, uint64(time.Now().UnixNano()))
+}
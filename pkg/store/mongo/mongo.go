@@ -3,31 +3,51 @@ package mongo
 import (
 	"context"
 	"fmt"
-	"log"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/d7561985/mongo-ab/internal/config"
 	"github.com/d7561985/mongo-ab/pkg/changing"
+	"github.com/d7561985/mongo-ab/pkg/fault"
+	"github.com/d7561985/mongo-ab/pkg/funds"
+	"github.com/d7561985/mongo-ab/pkg/store"
 
 	_ "embed"
 
 	"github.com/pkg/errors"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.mongodb.org/mongo-driver/mongo/writeconcern"
 	"go.mongodb.org/mongo-driver/x/bsonx"
+	"go.mongodb.org/mongo-driver/x/mongo/driver"
 )
 
 // timeout of transaction
 var timeout = time.Second * 10
 
-type PlaceHolders string
+// codeNoSuchTransaction is error of aborted transaction
+const codeNoSuchTransaction = 251
+
+// codeDocumentValidation is code of write which $jsonSchema validator refused
+const codeDocumentValidation = 121
+
+// idempotencyIndex is unique index of transactionId of UpdateTX journal records
+const idempotencyIndex = "idempotency_tx"
+
+// accountDateIndex is index of journal queries of account
+const accountDateIndex = "account_date"
+
+type PlaceHolders = fault.Point
 
 const (
-	UpdateBeforeLock PlaceHolders = "update.a"
-	UpdateDefer      PlaceHolders = "update.defer"
+	UpdateBeforeLock    = fault.UpdateBeforeLock
+	UpdateAfterUpsert   = fault.UpdateAfterUpsert
+	UpdateBeforeJournal = fault.UpdateBeforeJournal
+	UpdateBeforeCommit  = fault.UpdateBeforeCommit
+	UpdateDefer         = fault.UpdateDefer
 )
 
 type Repo struct {
@@ -36,7 +56,9 @@ type Repo struct {
 	client *mongo.Client
 	db     *mongo.Database
 
-	hooks map[PlaceHolders]func()
+	hooks fault.Hooks
+
+	retries uint64
 }
 
 // schema documentation - https://docs.mongodb.com/manual/reference/operator/query/jsonSchema/#mongodb-query-op.-jsonSchema
@@ -44,7 +66,36 @@ type Repo struct {
 //go:embed schema-validation-latest-transaction.json
 var schema []byte
 
+var (
+	_ store.Store         = (*Repo)(nil)
+	_ store.Sizer         = (*Repo)(nil)
+	_ store.Ledger        = (*Repo)(nil)
+	_ store.Deduplicator  = (*Repo)(nil)
+	_ store.Retrier       = (*Repo)(nil)
+	_ store.JournalLister = (*Repo)(nil)
+	_ store.Reverter      = (*Repo)(nil)
+
+	_ fault.Injectable = (*Repo)(nil)
+)
+
+// New connects and sets schema up
 func New(cfg config.Mongo) (*Repo, error) {
+	r, err := Connect(cfg)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return r.setup(context.TODO())
+}
+
+// Connect to mongo without schema changes
+func Connect(cfg config.Mongo) (*Repo, error) {
+	if err := cfg.Funds.Validate(); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	cfg.Retry = cfg.Retry.OrDefault()
+
 	clientOpts := options.Client().ApplyURI(cfg.Addr).
 		SetRetryWrites(true).
 		SetCompressors([]string{cfg.Compression.Type})
@@ -67,16 +118,19 @@ func New(cfg config.Mongo) (*Repo, error) {
 
 	client, err := mongo.Connect(context.TODO(), clientOpts)
 	if err != nil {
-		log.Fatal(err)
+		return nil, errors.WithStack(err)
 	}
 
-	v := &Repo{client: client,
-		cfg:   cfg,
-		db:    client.Database(cfg.DB),
-		hooks: make(map[PlaceHolders]func()),
-	}
+	return &Repo{client: client,
+		cfg: cfg,
+		db:  client.Database(cfg.DB),
+	}, nil
+}
 
-	return v.setup(context.TODO())
+// Setup creates indexes, validation and shards of collections
+func (r *Repo) Setup(ctx context.Context) error {
+	_, err := r.setup(ctx)
+	return err
 }
 
 func (r *Repo) setup(ctx context.Context) (*Repo, error) {
@@ -103,7 +157,28 @@ func (r *Repo) setup(ctx context.Context) (*Repo, error) {
 		return nil, fmt.Errorf("index %s not supported", r.cfg.Indexes)
 	}
 
-	if r.cfg.Validation {
+	// the latest records of account, _id is order of records of the same date
+	if _, err := r.db.Collection(r.cfg.Collections.Journal).Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "accountId", Value: 1}, {Key: "date", Value: -1}, {Key: "_id", Value: -1}},
+		Options: options.Index().SetName(accountDateIndex),
+	}); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	if r.cfg.Idempotent {
+		// unique index of sharded collection is prefixed by shard key: journal sharded by accountId refuses it
+		if _, err := r.db.Collection(r.cfg.Collections.Journal).Indexes().CreateOne(ctx, mongo.IndexModel{
+			Keys: bson.D{{Key: "transactionId", Value: 1}},
+			Options: options.Index().SetName(idempotencyIndex).SetUnique(true).
+				// compensating record of Revert has transactionId of reverted one
+				SetPartialFilterExpression(bson.D{{Key: "inc", Value: bson.D{{Key: "$exists", Value: true}}}, {Key: "revert", Value: false}}),
+		}); err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+
+	// schema keeps balance non-negative, existing collection gets it for db-constraint funds check only
+	if r.cfg.Validation || r.cfg.Funds == funds.Constraint {
 		var doc bson.Raw
 		if err := bson.UnmarshalExtJSON(schema, true, &doc); err != nil {
 			return nil, errors.WithStack(err)
@@ -129,11 +204,14 @@ func (r *Repo) setup(ctx context.Context) (*Repo, error) {
 				return nil, errors.WithStack(err)
 			}
 
-		} else {
+		} else if r.cfg.Funds == funds.Constraint {
+			// validator of existing collection is never turned off, Teardown drops it with the collection.
+			// Moderate level leaves documents which are invalid already, e.g. negative balances of previous runs
+			//
 			// spec: https://docs.mongodb.com/manual/reference/command/collMod/#mongodb-dbcommand-dbcmd.collMod
 			res := r.db.RunCommand(ctx, bson.D{
 				{Key: "collMod", Value: bsonx.String(r.cfg.Collections.Balance)},
-				{Key: "validationLevel", Value: bsonx.String("off")},
+				{Key: "validationLevel", Value: bsonx.String("moderate")},
 				{Key: "validationAction", Value: bsonx.String("error")},
 				{Key: "validator", Value: bson.M{"$jsonSchema": doc}},
 			})
@@ -193,6 +271,14 @@ func (r *Repo) Upsert(ctx context.Context, tx Transaction) (*TransactionInc, err
 		SetReturnDocument(options.After)
 
 	filter := bson.D{{Key: "_id", Value: tx.AccountID}}
+
+	conditional := r.cfg.Funds == funds.Conditional && tx.Balance < 0
+	if conditional {
+		// balance covers decrement, account without document has nothing to cover it
+		filter = append(filter, bson.E{Key: "balance", Value: bson.D{{Key: "$gte", Value: -tx.Balance}}})
+		op.SetUpsert(false)
+	}
+
 	res := r.db.Collection(r.cfg.Collections.Balance).FindOneAndUpdate(ctx, filter,
 		bson.D{
 			{
@@ -208,10 +294,14 @@ func (r *Repo) Upsert(ctx context.Context, tx Transaction) (*TransactionInc, err
 			},
 		}, op)
 
-	switch err := res.Err(); err {
-	case mongo.ErrNoDocuments:
+	switch err := res.Err(); {
+	case err == mongo.ErrNoDocuments && conditional:
+		return nil, errors.WithStack(store.ErrInsufficientFunds)
+	case err == mongo.ErrNoDocuments:
 		return &tx.TransactionInc, nil
-	case nil:
+	case err == nil:
+	case r.cfg.Funds == funds.Constraint && isValidationError(err):
+		return nil, errors.Wrap(store.ErrInsufficientFunds, err.Error())
 	default:
 		return nil, errors.WithStack(err)
 	}
@@ -224,19 +314,62 @@ func (r *Repo) Upsert(ctx context.Context, tx Transaction) (*TransactionInc, err
 	return &lTx, nil
 }
 
+// checkFunds is application funds check: balance is read in transaction, concurrent update of it conflicts
+func (r *Repo) checkFunds(ctx context.Context, tx Transaction) error {
+	if r.cfg.Funds != funds.Application || tx.Balance >= 0 {
+		return nil
+	}
+
+	var cur TransactionInc
+	switch err := r.db.Collection(r.cfg.Collections.Balance).FindOne(ctx, bson.D{{Key: "_id", Value: tx.AccountID}},
+		options.FindOne().SetProjection(bson.D{{Key: "balance", Value: 1}})).Decode(&cur); err {
+	case nil, mongo.ErrNoDocuments:
+	default:
+		return errors.WithStack(err)
+	}
+
+	if r.cfg.Funds.Refuses(cur.Balance, tx.Balance) {
+		return errors.WithStack(store.ErrInsufficientFunds)
+	}
+
+	return nil
+}
+
+// isValidationError reports whether err is of $jsonSchema validator
+func isValidationError(err error) bool {
+	var se mongo.ServerError
+
+	return errors.As(err, &se) && se.HasErrorCode(codeDocumentValidation)
+}
+
 // HandleBillingOperation  our of TX operation which update latestTransaction collection's document
 // and perform further log save
 // Important:  if insert to journal fails - operation will stay
 func (r *Repo) HandleBillingOperation(ctx context.Context, tx Transaction) (out *Transaction, err error) {
+	if err = r.checkFunds(ctx, tx); err != nil {
+		return nil, err
+	}
+
 	lTx, err := r.Upsert(ctx, tx)
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
 
+	if err = r.call(ctx, UpdateAfterUpsert); err != nil {
+		return nil, err
+	}
+
 	jrnl := Transaction{
 		AccountID:      tx.AccountID,
 		TransactionInc: *lTx,
 		TransactionSet: tx.TransactionSet,
+		Inc:            &tx.TransactionInc,
+		JournalID:      tx.JournalID,
+		RevertOf:       tx.RevertOf,
+	}
+
+	if err = r.call(ctx, UpdateBeforeJournal); err != nil {
+		return nil, err
 	}
 
 	if err = r.Insert(ctx, jrnl); err != nil {
@@ -254,15 +387,310 @@ func (r *Repo) Insert(ctx context.Context, jrnl Transaction) error {
 	return nil
 }
 
+// InsertJournal writes journal record of transaction without balance change
+func (r *Repo) InsertJournal(ctx context.Context, in changing.Transaction) error {
+	tx := NewTransaction(in)
+
+	return r.Insert(ctx, Transaction{
+		AccountID:      tx.AccountID,
+		TransactionInc: tx.TransactionInc,
+		TransactionSet: tx.TransactionSet,
+	})
+}
+
+func (r *Repo) GetBalance(ctx context.Context, account uint64) (store.Balance, error) {
+	res := r.db.Collection(r.cfg.Collections.Balance).FindOne(ctx, bson.D{{Key: "_id", Value: int64(account)}})
+
+	switch err := res.Err(); err {
+	case nil:
+	case mongo.ErrNoDocuments:
+		return store.Balance{}, errors.WithStack(store.ErrNotFound)
+	default:
+		return store.Balance{}, errors.WithStack(err)
+	}
+
+	var inc TransactionInc
+	if err := res.Decode(&inc); err != nil {
+		return store.Balance{}, errors.WithStack(err)
+	}
+
+	return inc.balance(account), nil
+}
+
+func (r *Repo) ScanBalances(ctx context.Context, fn func(store.Balance) error) error {
+	cur, err := r.db.Collection(r.cfg.Collections.Balance).Find(ctx, bson.D{})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	defer cur.Close(ctx)
+
+	for cur.Next(ctx) {
+		var doc struct {
+			ID             int64 `bson:"_id"`
+			TransactionInc `bson:",inline"`
+		}
+
+		if err = cur.Decode(&doc); err != nil {
+			return errors.WithStack(err)
+		}
+
+		if err = fn(doc.balance(uint64(doc.ID))); err != nil {
+			return err
+		}
+	}
+
+	return errors.WithStack(cur.Err())
+}
+
+func (r *Repo) ScanJournal(ctx context.Context, fn func(store.Entry) error) error {
+	filter := bson.D{{Key: "inc", Value: bson.D{{Key: "$exists", Value: true}}}}
+
+	cur, err := r.db.Collection(r.cfg.Collections.Journal).Find(ctx, filter)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	defer cur.Close(ctx)
+
+	for cur.Next(ctx) {
+		var tx Transaction
+		if err = cur.Decode(&tx); err != nil {
+			return errors.WithStack(err)
+		}
+
+		if err = fn(tx.entry()); err != nil {
+			return err
+		}
+	}
+
+	return errors.WithStack(cur.Err())
+}
+
+// ListJournal pages journal records of account by account_date index, ID of record is its _id
+func (r *Repo) ListJournal(ctx context.Context, account uint64, from, to time.Time, cursor string, limit int) (store.Page, error) {
+	if limit <= 0 {
+		return store.Page{}, errors.WithStack(store.ErrBadLimit)
+	}
+
+	c, err := store.ParseCursor(cursor)
+	if err != nil {
+		return store.Page{}, errors.WithStack(err)
+	}
+
+	filter := bson.D{{Key: "accountId", Value: int64(account)}}
+
+	date := bson.D{}
+	if !from.IsZero() {
+		date = append(date, bson.E{Key: "$gte", Value: from})
+	}
+
+	if !to.IsZero() {
+		date = append(date, bson.E{Key: "$lt", Value: to})
+	}
+
+	if len(date) > 0 {
+		filter = append(filter, bson.E{Key: "date", Value: date})
+	}
+
+	if !c.IsZero() {
+		id, err := primitive.ObjectIDFromHex(c.ID)
+		if err != nil {
+			return store.Page{}, errors.WithStack(store.ErrBadCursor)
+		}
+
+		filter = append(filter, bson.E{Key: "$or", Value: bson.A{
+			bson.D{{Key: "date", Value: bson.D{{Key: "$lt", Value: c.Date}}}},
+			bson.D{{Key: "date", Value: c.Date}, {Key: "_id", Value: bson.D{{Key: "$lt", Value: id}}}},
+		}})
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "date", Value: -1}, {Key: "_id", Value: -1}}).
+		SetLimit(int64(limit + 1))
+
+	cur, err := r.db.Collection(r.cfg.Collections.Journal).Find(ctx, filter, opts)
+	if err != nil {
+		return store.Page{}, errors.WithStack(err)
+	}
+
+	defer cur.Close(ctx)
+
+	var out []store.Record
+	for cur.Next(ctx) {
+		var tx Transaction
+		if err = cur.Decode(&tx); err != nil {
+			return store.Page{}, errors.WithStack(err)
+		}
+
+		out = append(out, tx.record())
+	}
+
+	if err = cur.Err(); err != nil {
+		return store.Page{}, errors.WithStack(err)
+	}
+
+	return store.NewPage(out, limit), nil
+}
+
+// Teardown drops balance and journal collections
+func (r *Repo) Teardown(ctx context.Context) error {
+	for _, name := range []string{r.cfg.Collections.Balance, r.cfg.Collections.Journal} {
+		if err := r.db.Collection(name).Drop(ctx); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	return nil
+}
+
+// Size is storage and index size of balance and journal collections
+func (r *Repo) Size(ctx context.Context) (int64, error) {
+	var total int64
+
+	for _, name := range []string{r.cfg.Collections.Balance, r.cfg.Collections.Journal} {
+		var stats struct {
+			StorageSize    float64 `bson:"storageSize"`
+			TotalIndexSize float64 `bson:"totalIndexSize"`
+		}
+
+		if err := r.db.RunCommand(ctx, bson.D{{Key: "collStats", Value: name}}).Decode(&stats); err != nil {
+			return 0, errors.WithStack(err)
+		}
+
+		total += int64(stats.StorageSize + stats.TotalIndexSize)
+	}
+
+	return total, nil
+}
+
 // UpdateTX ...
 // NATS core offers an at most once quality of service
-// thats why we don'y need to check that TX already happended
-func (r *Repo) UpdateTX(ctx context.Context, in changing.Transaction) (interface{}, error) {
+// thats why we don'y need to check that TX already happended.
+// With at least once delivery Idempotent config returns recorded result of redelivered transaction.
+func (r *Repo) UpdateTX(ctx context.Context, in changing.Transaction) (_ store.Balance, err error) {
 	tx := NewTransaction(in)
 
-	r.call(UpdateBeforeLock)
-	defer r.call(UpdateDefer)
+	if err = r.call(ctx, UpdateBeforeLock); err != nil {
+		return store.Balance{}, err
+	}
+
+	defer func() {
+		if hErr := r.call(ctx, UpdateDefer); err == nil {
+			err = hErr
+		}
+	}()
+
+	res, err := r.inTransaction(ctx, func(sessCtx mongo.SessionContext) (out *Transaction, err error) {
+		if r.cfg.Idempotent {
+			if out, err = r.recorded(sessCtx, tx); err != nil || out != nil {
+				return out, err
+			}
+		}
+
+		if out, err = r.HandleBillingOperation(sessCtx, tx); err != nil {
+			return nil, err
+		}
+
+		return out, r.call(sessCtx, UpdateBeforeCommit)
+	})
+	if err != nil && r.cfg.Idempotent && mongo.IsDuplicateKeyError(err) {
+		// concurrent redelivery was recorded first
+		res, err = r.recorded(ctx, tx)
+		if err == nil && res == nil {
+			err = errors.New("duplicate transaction is not recorded")
+		}
+	}
+
+	if err != nil {
+		return store.Balance{}, errors.WithStack(err)
+	}
+
+	// redelivery to another account returns balance of recorded one
+	return res.balance(uint64(res.AccountID)), nil
+}
+
+// Revert applies inverse increments of UpdateTX journal record and writes compensating record linked to it.
+// Reverted record gets revertedBy in the same transaction, so concurrent reverts of it conflict and one of them wins.
+func (r *Repo) Revert(ctx context.Context, journalID string) (_ store.Record, err error) {
+	id, err := primitive.ObjectIDFromHex(journalID)
+	if err != nil {
+		return store.Record{}, errors.WithStack(store.ErrNoRecord)
+	}
+
+	if err = r.call(ctx, UpdateBeforeLock); err != nil {
+		return store.Record{}, err
+	}
 
+	defer func() {
+		if hErr := r.call(ctx, UpdateDefer); err == nil {
+			err = hErr
+		}
+	}()
+
+	res, err := r.inTransaction(ctx, func(sessCtx mongo.SessionContext) (*Transaction, error) {
+		return r.revert(sessCtx, id)
+	})
+	if err != nil {
+		return store.Record{}, errors.WithStack(err)
+	}
+
+	return res.record(), nil
+}
+
+func (r *Repo) revert(ctx context.Context, id primitive.ObjectID) (*Transaction, error) {
+	journal := r.db.Collection(r.cfg.Collections.Journal)
+
+	var orig Transaction
+	switch err := journal.FindOne(ctx, bson.D{{Key: "_id", Value: id}}).Decode(&orig); err {
+	case nil:
+	case mongo.ErrNoDocuments:
+		return nil, errors.WithStack(store.ErrNoRecord)
+	default:
+		return nil, errors.WithStack(err)
+	}
+
+	switch {
+	case orig.Inc == nil || orig.Revert:
+		return nil, errors.WithStack(store.ErrNotRevertible)
+	case orig.RevertedBy != nil:
+		return nil, errors.WithStack(store.ErrReverted)
+	}
+
+	comp := primitive.NewObjectID()
+
+	res, err := journal.UpdateOne(ctx,
+		bson.D{{Key: "_id", Value: id}, {Key: "revertedBy", Value: bson.D{{Key: "$exists", Value: false}}}},
+		bson.D{{Key: "$set", Value: bson.D{{Key: "revertedBy", Value: comp}}}})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	if res.MatchedCount == 0 {
+		return nil, errors.WithStack(store.ErrReverted)
+	}
+
+	tx := Transaction{
+		AccountID:      orig.AccountID,
+		TransactionInc: orig.Inc.neg(),
+		TransactionSet: orig.TransactionSet,
+		JournalID:      comp,
+		RevertOf:       &id,
+	}
+
+	tx.Date, tx.Revert = time.Now(), true
+
+	out, err := r.HandleBillingOperation(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	return out, r.call(ctx, UpdateBeforeCommit)
+}
+
+// inTransaction runs fn in transaction of new session, retry policy replaces retries of WithTransaction,
+// which are unbounded for 120s and invisible
+func (r *Repo) inTransaction(ctx context.Context, fn func(mongo.SessionContext) (*Transaction, error)) (*Transaction, error) {
 	opts := options.Session().
 		// ToDo: consider that, decrease speed but possible we should use it
 		SetCausalConsistency(false)
@@ -274,27 +702,111 @@ func (r *Repo) UpdateTX(ctx context.Context, in changing.Transaction) (interface
 
 	defer ses.EndSession(ctx)
 
-	// Specify the ReadPreference option to set the read preference to primary
-	// preferred for this transaction.
-	txnOpts := options.Transaction()
+	var res *Transaction
+	attempts, err := r.cfg.Retry.DoWhen(ctx, r.retryable, func() (err error) {
+		res, err = r.transaction(ctx, ses, fn)
+		return err
+	})
 
-	res, err := ses.WithTransaction(ctx, func(sessCtx mongo.SessionContext) (interface{}, error) {
-		return r.HandleBillingOperation(sessCtx, tx)
-	}, txnOpts)
+	atomic.AddUint64(&r.retries, uint64(attempts-1))
 
-	return res, errors.WithStack(err)
+	return res, err
 }
 
-func (r *Repo) AddHook(name PlaceHolders, fn func()) {
-	r.hooks[name] = fn
+// transaction is single attempt of fn in transaction
+func (r *Repo) transaction(ctx context.Context, ses mongo.Session, fn func(mongo.SessionContext) (*Transaction, error)) (*Transaction, error) {
+	if err := ses.StartTransaction(options.Transaction()); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	var out *Transaction
+	err := mongo.WithSession(ctx, ses, func(sessCtx mongo.SessionContext) (err error) {
+		out, err = fn(sessCtx)
+		return err
+	})
+	if err != nil {
+		_ = ses.AbortTransaction(context.Background())
+		return nil, err
+	}
+
+	// transaction can't run again while its commit result is unknown, only commit is retried
+	attempts, err := r.cfg.Retry.DoWhen(ctx, unknownCommit, func() error {
+		return ses.CommitTransaction(ctx)
+	})
+
+	atomic.AddUint64(&r.retries, uint64(attempts-1))
+
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return out, nil
+}
+
+// retryable is error of transaction which could run again, commit with unknown result could be already applied
+func (r *Repo) retryable(err error) bool {
+	return !unknownCommit(err) && r.cfg.Retry.Retryable(err)
 }
 
-func (r *Repo) call(name PlaceHolders) {
-	if fn, ok := r.hooks[name]; ok {
-		fn()
+func unknownCommit(err error) bool {
+	var se mongo.ServerError
+	return errors.As(err, &se) && se.HasErrorLabel(driver.UnknownTransactionCommitResult)
+}
+
+// Retries of transactions and commits made since start
+func (r *Repo) Retries() uint64 {
+	return atomic.LoadUint64(&r.retries)
+}
+
+// recorded returns journal record of UpdateTX with transactionId of tx, nil when there is no such
+func (r *Repo) recorded(ctx context.Context, tx Transaction) (*Transaction, error) {
+	filter := bson.D{
+		{Key: "transactionId", Value: tx.TransactionID},
+		{Key: "inc", Value: bson.D{{Key: "$exists", Value: true}}},
+		{Key: "revert", Value: false},
 	}
+
+	var out Transaction
+	switch err := r.db.Collection(r.cfg.Collections.Journal).FindOne(ctx, filter).Decode(&out); err {
+	case nil:
+		return &out, nil
+	case mongo.ErrNoDocuments:
+		return nil, nil
+	default:
+		return nil, errors.WithStack(err)
+	}
+}
+
+// Idempotent reports whether UpdateTX applies redelivered transaction once
+func (r *Repo) Idempotent() bool {
+	return r.cfg.Idempotent
+}
+
+// AddHook appends fn to placeholder of UpdateTX and Revert, it is safe to add hooks while transactions run
+func (r *Repo) AddHook(name PlaceHolders, fn fault.Hook) {
+	r.hooks.Add(name, fn)
+}
+
+// call runs hooks of placeholder, abort of fault becomes transient transaction error which Retry policy retries
+func (r *Repo) call(ctx context.Context, name PlaceHolders) error {
+	err := r.hooks.Call(ctx, name)
+	if errors.Is(err, fault.ErrAbort) {
+		return mongo.CommandError{
+			Code:    codeNoSuchTransaction,
+			Name:    "NoSuchTransaction",
+			Message: err.Error(),
+			Labels:  []string{driver.TransientTransactionError},
+			Wrapped: err,
+		}
+	}
+
+	return errors.WithStack(err)
 }
 
 func (r *Repo) Stop(ctx context.Context) {
-	_ = r.client.Disconnect(ctx)
+	_ = r.Close(ctx)
+}
+
+func (r *Repo) Close(ctx context.Context) error {
+	return errors.WithStack(r.client.Disconnect(ctx))
 }
@@ -31,7 +31,6 @@ var cfg = config.Mongo{
 		Balance: "bench_balance",
 		Journal: "bench_journal",
 	},
-	WriteConcernJournal: false,
 }
 
 // /opt/homebrew/Cellar/mongodb-community/5.0.3/bin/mongod --port 27021 --replSet rs1 --dbpath data/data1 --bind_ip localhost -f  /opt/homebrew/etc/mongod.conf
@@ -162,8 +161,9 @@ func insert(t *testing.T) {
 	// wait after first lookup
 	go func() {
 		q, _ := New(cfg)
-		q.AddHook(UpdateBeforeLock, func() {
+		q.AddHook(UpdateBeforeLock, func(context.Context) error {
 			<-ch
+			return nil
 		})
 
 		res, err := q.UpdateTX(context.TODO(), genRequest(ID, 50))
@@ -175,8 +175,9 @@ func insert(t *testing.T) {
 	// unlock
 	go func() {
 		q, _ := New(cfg)
-		q.AddHook(UpdateBeforeLock, func() {
+		q.AddHook(UpdateBeforeLock, func(context.Context) error {
 			ch <- struct{}{}
+			return nil
 		})
 
 		res, err := q.UpdateTX(context.TODO(), genRequest(ID, 100))
@@ -4,6 +4,7 @@ import (
 	"time"
 
 	"github.com/d7561985/mongo-ab/pkg/changing"
+	"github.com/d7561985/mongo-ab/pkg/store"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
@@ -12,6 +13,15 @@ type Transaction struct {
 	AccountID      int64 `json:"accountId" bson:"accountId"`
 	TransactionInc `bson:",inline"`
 	TransactionSet `bson:",inline"`
+
+	// Inc is increments which journal record of UpdateTX was made of, totals are inline
+	Inc *TransactionInc `bson:"inc,omitempty"`
+
+	// JournalID is _id of journal record, it is generated on insert when empty
+	JournalID primitive.ObjectID `bson:"_id,omitempty"`
+	// RevertOf links compensating record of Revert to reverted one, RevertedBy links it back
+	RevertOf   *primitive.ObjectID `bson:"revertOf,omitempty"`
+	RevertedBy *primitive.ObjectID `bson:"revertedBy,omitempty"`
 }
 
 type TransactionInc struct {
@@ -64,3 +74,76 @@ func NewTransaction(in changing.Transaction) Transaction {
 		},
 	}
 }
+
+// entry of journal record, increments of compensating record are of reverted one
+func (t Transaction) entry() store.Entry {
+	e := store.Entry{
+		AccountID:     uint64(t.AccountID),
+		TransactionID: uint64(t.TransactionID),
+		Total:         t.balance(uint64(t.AccountID)),
+		Revert:        t.Revert,
+	}
+
+	switch {
+	case t.Inc == nil:
+	case t.Revert:
+		e.Inc = t.Inc.neg().inc()
+	default:
+		e.Inc = t.Inc.inc()
+	}
+
+	return e
+}
+
+func (t Transaction) record() store.Record {
+	r := store.Record{
+		Entry:           t.entry(),
+		ID:              t.JournalID.Hex(),
+		Date:            t.Date,
+		TransactionType: t.TransactionType,
+		Project:         t.Project,
+		Change:          t.Change,
+	}
+
+	if t.RevertOf != nil {
+		r.RevertOf = t.RevertOf.Hex()
+	}
+
+	if t.RevertedBy != nil {
+		r.RevertedBy = t.RevertedBy.Hex()
+	}
+
+	return r
+}
+
+// neg is inverse increments
+func (t TransactionInc) neg() TransactionInc {
+	return TransactionInc{
+		Balance:        -t.Balance,
+		DepositAllSum:  -t.DepositAllSum,
+		DepositCount:   -t.DepositCount,
+		PincoinBalance: -t.PincoinBalance,
+		PincoinsAllSum: -t.PincoinsAllSum,
+	}
+}
+
+func (t TransactionInc) balance(account uint64) store.Balance {
+	return store.Balance{
+		AccountID:      account,
+		Balance:        t.Balance,
+		DepositAllSum:  t.DepositAllSum,
+		DepositCount:   uint64(t.DepositCount),
+		PincoinBalance: t.PincoinBalance,
+		PincoinsAllSum: t.PincoinsAllSum,
+	}
+}
+
+func (t TransactionInc) inc() changing.Inc {
+	return changing.Inc{
+		Balance:        t.Balance,
+		DepositAllSum:  t.DepositAllSum,
+		DepositCount:   uint64(t.DepositCount),
+		PincoinBalance: t.PincoinBalance,
+		PincoinsAllSum: t.PincoinsAllSum,
+	}
+}
@@ -0,0 +1,57 @@
+package postgres
+
+import (
+	"github.com/d7561985/mongo-ab/internal/config"
+	"github.com/d7561985/mongo-ab/pkg/funds"
+	"github.com/d7561985/mongo-ab/pkg/retry"
+	"github.com/d7561985/mongo-ab/pkg/store"
+	"github.com/pkg/errors"
+	"github.com/urfave/cli/v2"
+)
+
+var dbConnect = "postgresql://postgres@localhost/db"
+
+const (
+	fAddr       = "addr"
+	fIdempotent = "idempotent"
+)
+
+const (
+	EnvPostgresAddr = "POSTGRES_ADDR"
+	EnvIdempotent   = "POSTGRES_IDEMPOTENT"
+)
+
+func init() {
+	store.Register(store.Backend{
+		Name:  "postgres",
+		Flags: Flags(),
+		Open: func(c *cli.Context) (store.Store, error) {
+			r, err := New(c.Context, GetCfg(c))
+			if err != nil {
+				return nil, errors.WithStack(err)
+			}
+
+			return r, nil
+		},
+		// tables have fixed names, so only database or search_path of address separates stores
+		Target: func(c *cli.Context) string { return c.String(fAddr) },
+	})
+}
+
+// Flags are flags of postgres connection
+func Flags() []cli.Flag {
+	return append([]cli.Flag{
+		&cli.StringFlag{Name: fAddr, Value: dbConnect, EnvVars: []string{EnvPostgresAddr}},
+		&cli.BoolFlag{Name: fIdempotent, Usage: "Apply transaction once: redelivery of transactionId returns recorded result", EnvVars: []string{EnvIdempotent}},
+	}, append(retry.Flags(), funds.Flags()...)...)
+}
+
+// GetCfg reads config of Flags
+func GetCfg(c *cli.Context) config.Postgres {
+	return config.Postgres{
+		Addr:       c.String(fAddr),
+		Idempotent: c.Bool(fIdempotent),
+		Retry:      retry.Get(c),
+		Funds:      funds.Get(c),
+	}
+}
@@ -3,20 +3,69 @@ package postgres
 import (
 	"context"
 	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/d7561985/mongo-ab/internal/config"
 	"github.com/d7561985/mongo-ab/pkg/changing"
+	"github.com/d7561985/mongo-ab/pkg/fault"
+	"github.com/d7561985/mongo-ab/pkg/funds"
+	"github.com/d7561985/mongo-ab/pkg/store"
+	"github.com/google/uuid"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
 	"github.com/pkg/errors"
 )
 
+var (
+	_ store.Store         = (*Repo)(nil)
+	_ store.Sizer         = (*Repo)(nil)
+	_ store.Ledger        = (*Repo)(nil)
+	_ store.Deduplicator  = (*Repo)(nil)
+	_ store.Retrier       = (*Repo)(nil)
+	_ store.JournalLister = (*Repo)(nil)
+	_ store.Reverter      = (*Repo)(nil)
+
+	_ fault.Injectable = (*Repo)(nil)
+)
+
+// stateSerialization is SQLSTATE of transaction which should be retried
+const stateSerialization = "40001"
+
+// stateUniqueViolation is SQLSTATE of duplicate key
+const stateUniqueViolation = "23505"
+
+// stateCheckViolation is SQLSTATE of CHECK constraint
+const stateCheckViolation = "23514"
+
+// fundsConstraint is CHECK constraint of db-constraint funds check
+const fundsConstraint = "balance_non_negative"
+
+// idempotencyIndex is unique index of transactionId of UpdateTX journal records
+const idempotencyIndex = "journal_idempotency_tx"
+
+// accountDateIndex is index of journal queries of account
+const accountDateIndex = "journal_account_date"
+
 type Repo struct {
 	cfg config.Postgres
 
 	pool *pgxpool.Pool
+
+	hooks fault.Hooks
+
+	retries uint64
 }
 
 func New(ctx context.Context, cfg config.Postgres) (*Repo, error) {
+	if err := cfg.Funds.Validate(); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	cfg.Retry = cfg.Retry.OrDefault()
+
 	c, err := pgxpool.ParseConfig(cfg.Addr)
 	if err != nil {
 		return nil, errors.WithStack(err)
@@ -72,8 +121,42 @@ CREATE TABLE IF NOT EXISTS "journal"
     "transactionBson"        bytea NOT NULL,
     "transactionType"        VARCHAR(36) NOT NULL
 );
+
+-- increments of UpdateTX record, NULL for journal-only insert
+ALTER TABLE "journal"
+    ADD COLUMN IF NOT EXISTS "incBalance"        FLOAT8  DEFAULT NULL,
+    ADD COLUMN IF NOT EXISTS "incDepositAllSum"  FLOAT8  DEFAULT NULL,
+    ADD COLUMN IF NOT EXISTS "incDepositCount"  INT8  DEFAULT NULL,
+    ADD COLUMN IF NOT EXISTS "incPincoinBalance"  FLOAT8  DEFAULT NULL,
+    ADD COLUMN IF NOT EXISTS "incPincoinAllSum"  FLOAT8  DEFAULT NULL;
+
+-- links of compensating record of Revert and reverted one
+ALTER TABLE "journal"
+    ADD COLUMN IF NOT EXISTS "revertOf"    UUID  DEFAULT NULL,
+    ADD COLUMN IF NOT EXISTS "revertedBy"  UUID  DEFAULT NULL;
+
+-- the latest records of account, id is order of records of the same date
+CREATE INDEX IF NOT EXISTS "` + accountDateIndex + `" ON "journal" ("accountId", "date" DESC, "id" DESC);
 COMMIT;
 `
+	if s.cfg.Idempotent {
+		sql += `
+CREATE UNIQUE INDEX IF NOT EXISTS "` + idempotencyIndex + `" ON "journal" ("transactionId")
+    WHERE "incBalance" IS NOT NULL AND "revert" IS NOT TRUE;
+`
+	}
+
+	// constraint is not validated: accounts which are negative already could be topped up.
+	// Like the index it is kept by Setup of other modes, Teardown drops it with the table.
+	if s.cfg.Funds == funds.Constraint {
+		sql += `
+DO $$ BEGIN
+    ALTER TABLE "balance" ADD CONSTRAINT "` + fundsConstraint + `" CHECK ("balance" >= 0) NOT VALID;
+EXCEPTION WHEN duplicate_object THEN NULL;
+END $$;
+`
+	}
+
 	exec, err := s.pool.Exec(ctx, sql)
 	if err != nil {
 		return errors.WithStack(err)
@@ -84,13 +167,101 @@ COMMIT;
 	return nil
 }
 
-func (s *Repo) UpdateTX(ctx context.Context, in changing.Transaction) (_ interface{}, err error) {
+// UpdateTX increments balance and writes journal record with totals after it in one transaction.
+// Transaction is retried by Retry policy. With Idempotent config redelivered transaction returns recorded result.
+func (s *Repo) UpdateTX(ctx context.Context, in changing.Transaction) (_ store.Balance, err error) {
+	if err = s.call(ctx, fault.UpdateBeforeLock); err != nil {
+		return store.Balance{}, err
+	}
+
+	defer func() {
+		if hErr := s.call(ctx, fault.UpdateDefer); err == nil {
+			err = hErr
+		}
+	}()
+
+	var b store.Balance
+	attempts, err := s.cfg.Retry.Do(ctx, func() (err error) {
+		b, err = s.transaction(ctx, in)
+		return err
+	})
+
+	atomic.AddUint64(&s.retries, uint64(attempts-1))
+
+	var pe *pgconn.PgError
+	if err != nil && s.cfg.Idempotent && errors.As(err, &pe) &&
+		pe.Code == stateUniqueViolation && pe.ConstraintName == idempotencyIndex {
+		// concurrent redelivery was recorded first
+		prev, ok, lErr := s.recorded(ctx, s.pool, in)
+		switch {
+		case lErr != nil:
+			return store.Balance{}, lErr
+		case ok:
+			return prev, nil
+		}
+	}
+
+	return b, err
+}
+
+// transaction is single attempt of UpdateTX
+func (s *Repo) transaction(ctx context.Context, in changing.Transaction) (out store.Balance, err error) {
+	err = s.inTx(ctx, func(tx pgx.Tx) error {
+		if s.cfg.Idempotent {
+			prev, ok, err := s.recorded(ctx, tx, in)
+			if err != nil || ok {
+				out = prev
+				return err
+			}
+		}
+
+		b, err := s.upsert(ctx, tx, in.AccountID, newIncrements(in.Inc))
+		if err != nil {
+			return err
+		}
+
+		j := NewJournal(b, in)
+		sq := `INSERT INTO journal("id2","accountId","balance","change","currency","date","depositAllSum","depositCount",
+                "pincoinBalance","pincoinAllSum","pincoinChange","project","revert","transactionId",
+                "transactionBson", "transactionType",
+                "incBalance", "incDepositAllSum", "incDepositCount", "incPincoinBalance", "incPincoinAllSum"
+            ) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14,$15, $16, $17, $18, $19, $20, $21)`
+		_, err = tx.Exec(ctx, sq,
+			j.ID2, j.AccountID, j.Balance.Balance, j.Change, j.Currency, j.Date, j.DepositAllSum, j.DepositCount,
+			j.PincoinBalance, j.PincoinsAllSum, j.PincoinChange, j.Project, j.Revert, j.TransactionID,
+			j.TransactionIDBson, j.TransactionType,
+			in.Balance, in.DepositAllSum, int64(in.DepositCount), in.PincoinBalance, in.PincoinsAllSum,
+		)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		out = b.store()
+
+		return nil
+	})
+
+	return out, err
+}
+
+// inTx runs fn in transaction which is committed after UpdateBeforeCommit hook unless fn fails
+func (s *Repo) inTx(ctx context.Context, fn func(tx pgx.Tx) error) (err error) {
 	tx, err := s.pool.Begin(ctx)
 	if err != nil {
-		return nil, errors.WithStack(err)
+		return errors.WithStack(err)
 	}
 
 	defer func() {
+		// panic leaves err nil, partial transaction must not be committed
+		if p := recover(); p != nil {
+			_ = tx.Rollback(ctx)
+			panic(p)
+		}
+
+		if err == nil {
+			err = s.call(ctx, fault.UpdateBeforeCommit)
+		}
+
 		if err == nil {
 			err = errors.WithStack(tx.Commit(ctx))
 		} else {
@@ -98,7 +269,13 @@ func (s *Repo) UpdateTX(ctx context.Context, in changing.Transaction) (_ interfa
 		}
 	}()
 
-	res := tx.QueryRow(ctx, `INSERT INTO balance("accountId", "balance", "depositAllSum",
+	return fn(tx)
+}
+
+// upsert increments balance of account and returns totals after it, hooks of journal write follow it.
+// Decrement which Funds check refuses fails with store.ErrInsufficientFunds.
+func (s *Repo) upsert(ctx context.Context, tx pgx.Tx, account uint64, in increments) (Balance, error) {
+	sql := `INSERT INTO balance("accountId", "balance", "depositAllSum",
                     "depositCount", "pincoinBalance", "pincoinAllSum") VALUES ($1,$2,$3,$4,$5,$6) 
 		ON CONFLICT ON CONSTRAINT balance_pkey DO UPDATE SET 
 			balance = balance.balance + $2,
@@ -107,31 +284,190 @@ func (s *Repo) UpdateTX(ctx context.Context, in changing.Transaction) (_ interfa
 			"pincoinBalance" = balance."pincoinBalance" + $5,
 			"pincoinAllSum" = balance."pincoinAllSum" + $6
 			WHERE balance."accountId" = $1 
-			RETURNING "balance","depositAllSum", "depositCount", "pincoinBalance", "pincoinAllSum"`,
-		in.AccountID, in.Balance, in.DepositAllSum, in.DepositCount, in.PincoinBalance, in.PincoinsAllSum)
+			RETURNING "balance","depositAllSum", "depositCount", "pincoinBalance", "pincoinAllSum"`
 
-	b := Balance{AccountID: in.AccountID}
-	if err = res.Scan(&b.Balance, &b.DepositAllSum, &b.DepositCount, &b.PincoinBalance, &b.PincoinsAllSum); err != nil {
-		return nil, errors.WithStack(err)
+	conditional := s.cfg.Funds == funds.Conditional && in.Balance < 0
+	if conditional {
+		// existing row is updated only when balance covers decrement
+		sql = `UPDATE balance SET
+			balance = balance + $2,
+			"depositAllSum" = "depositAllSum" + $3,
+			"depositCount" = "depositCount" + $4,
+			"pincoinBalance" = "pincoinBalance" + $5,
+			"pincoinAllSum" = "pincoinAllSum" + $6
+			WHERE "accountId" = $1 AND balance + $2 >= 0
+			RETURNING "balance","depositAllSum", "depositCount", "pincoinBalance", "pincoinAllSum"`
 	}
 
-	j := NewJournal(b, in)
-	sq := `INSERT INTO journal("id2","accountId","balance","change","currency","date","depositAllSum","depositCount",
-                "pincoinBalance","pincoinAllSum","pincoinChange","project","revert","transactionId",
-                "transactionBson", "transactionType"
-            ) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14,$15, $16)`
-	_, err = tx.Exec(ctx, sq,
-		j.ID2, j.AccountID, j.Balance.Balance, j.Change, j.Currency, j.Date, j.DepositAllSum, j.DepositCount,
-		j.PincoinBalance, j.PincoinsAllSum, j.PincoinChange, j.Project, j.Revert, j.TransactionID,
-		j.TransactionIDBson, j.TransactionType,
-	)
-	if err != nil {
-		return nil, errors.WithStack(err)
+	if s.cfg.Funds == funds.Application && in.Balance < 0 {
+		if err := s.covers(ctx, tx, account, in.Balance); err != nil {
+			return Balance{}, err
+		}
+	}
+
+	b := Balance{AccountID: account}
+	err := tx.QueryRow(ctx, sql, account, in.Balance, in.DepositAllSum, in.DepositCount, in.PincoinBalance, in.PincoinsAllSum).
+		Scan(&b.Balance, &b.DepositAllSum, &b.DepositCount, &b.PincoinBalance, &b.PincoinsAllSum)
+
+	var pe *pgconn.PgError
+	switch {
+	case conditional && errors.Is(err, pgx.ErrNoRows):
+		return Balance{}, errors.WithStack(store.ErrInsufficientFunds)
+	case errors.As(err, &pe) && pe.Code == stateCheckViolation && pe.ConstraintName == fundsConstraint:
+		return Balance{}, errors.Wrap(store.ErrInsufficientFunds, err.Error())
+	case err != nil:
+		return Balance{}, errors.WithStack(err)
+	}
+
+	if err := s.call(ctx, fault.UpdateAfterUpsert); err != nil {
+		return Balance{}, err
+	}
+
+	if err := s.call(ctx, fault.UpdateBeforeJournal); err != nil {
+		return Balance{}, err
 	}
 
 	return b, nil
 }
 
+// covers is application funds check: balance is locked until commit and must cover decrement, missing account has zero
+func (s *Repo) covers(ctx context.Context, tx pgx.Tx, account uint64, inc float64) error {
+	var balance float64
+	err := tx.QueryRow(ctx, `SELECT "balance" FROM balance WHERE "accountId" = $1 FOR UPDATE`, account).Scan(&balance)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return errors.WithStack(err)
+	}
+
+	if s.cfg.Funds.Refuses(balance, inc) {
+		return errors.WithStack(store.ErrInsufficientFunds)
+	}
+
+	return nil
+}
+
+// Revert applies inverse increments of journal record whose id is uuid and writes compensating record.
+// Transaction is retried by Retry policy.
+func (s *Repo) Revert(ctx context.Context, journalID string) (_ store.Record, err error) {
+	id, err := uuid.Parse(journalID)
+	if err != nil {
+		return store.Record{}, errors.WithStack(store.ErrNoRecord)
+	}
+
+	if err = s.call(ctx, fault.UpdateBeforeLock); err != nil {
+		return store.Record{}, err
+	}
+
+	defer func() {
+		if hErr := s.call(ctx, fault.UpdateDefer); err == nil {
+			err = hErr
+		}
+	}()
+
+	var rec store.Record
+	attempts, err := s.cfg.Retry.Do(ctx, func() (err error) {
+		rec, err = s.revert(ctx, id)
+		return err
+	})
+
+	atomic.AddUint64(&s.retries, uint64(attempts-1))
+
+	return rec, err
+}
+
+// revert is single attempt of Revert, reverted record is locked until commit
+func (s *Repo) revert(ctx context.Context, id uuid.UUID) (out store.Record, err error) {
+	err = s.inTx(ctx, func(tx pgx.Tx) error {
+		var (
+			rec      = store.Record{RevertOf: id.String()}
+			txID     int64
+			change   float32
+			hasInc   bool
+			reverted bool
+			inc      increments
+		)
+
+		err := tx.QueryRow(ctx, `SELECT "accountId", "transactionId", "transactionType", "project", COALESCE("change", 0),
+			COALESCE("revert", FALSE), "revertedBy" IS NOT NULL, "incBalance" IS NOT NULL,
+			COALESCE("incBalance", 0), COALESCE("incDepositAllSum", 0), COALESCE("incDepositCount", 0),
+			COALESCE("incPincoinBalance", 0), COALESCE("incPincoinAllSum", 0)
+			FROM journal WHERE "id" = $1 FOR UPDATE`, id).
+			Scan(&rec.AccountID, &txID, &rec.TransactionType, &rec.Project, &change,
+				&rec.Revert, &reverted, &hasInc,
+				&inc.Balance, &inc.DepositAllSum, &inc.DepositCount, &inc.PincoinBalance, &inc.PincoinsAllSum)
+		switch {
+		case err == pgx.ErrNoRows:
+			return errors.WithStack(store.ErrNoRecord)
+		case err != nil:
+			return errors.WithStack(err)
+		case !hasInc || rec.Revert:
+			return errors.WithStack(store.ErrNotRevertible)
+		case reverted:
+			return errors.WithStack(store.ErrReverted)
+		}
+
+		b, err := s.upsert(ctx, tx, rec.AccountID, inc.neg())
+		if err != nil {
+			return err
+		}
+
+		rec.TransactionID, rec.Change, rec.Inc, rec.Total = uint64(txID), float64(change), inc.inc(), b.store()
+		rec.Date, rec.Revert = time.Now(), true
+
+		err = tx.QueryRow(ctx, `INSERT INTO journal("id2","accountId","balance","change","currency","date","depositAllSum","depositCount",
+                "pincoinBalance","pincoinAllSum","pincoinChange","project","revert","transactionId",
+                "transactionBson", "transactionType",
+                "incBalance", "incDepositAllSum", "incDepositCount", "incPincoinBalance", "incPincoinAllSum", "revertOf")
+			SELECT "id2","accountId",$2,"change","currency",$3,$4,$5,$6,$7,"pincoinChange","project",TRUE,"transactionId",
+				"transactionBson", "transactionType",
+				-"incBalance", -"incDepositAllSum", -"incDepositCount", -"incPincoinBalance", -"incPincoinAllSum", "id"
+			FROM journal WHERE "id" = $1
+			RETURNING "id"::text`,
+			id, b.Balance, rec.Date, b.DepositAllSum, b.DepositCount, b.PincoinBalance, b.PincoinsAllSum).Scan(&rec.ID)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		if _, err = tx.Exec(ctx, `UPDATE journal SET "revertedBy" = $2 WHERE "id" = $1`, id, rec.ID); err != nil {
+			return errors.WithStack(err)
+		}
+
+		out = rec
+
+		return nil
+	})
+
+	return out, err
+}
+
+// recorded returns totals of UpdateTX journal record with transactionId of in, redelivery to another account gets them too
+func (s *Repo) recorded(ctx context.Context, q interface {
+	QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row
+}, in changing.Transaction) (store.Balance, bool, error) {
+	res := q.QueryRow(ctx, `SELECT "accountId", "balance", "depositAllSum", "depositCount", "pincoinBalance", "pincoinAllSum"
+		FROM journal WHERE "transactionId" = $1 AND "incBalance" IS NOT NULL AND "revert" IS NOT TRUE`,
+		int64(in.TransactionID))
+
+	var b Balance
+	switch err := res.Scan(&b.AccountID, &b.Balance, &b.DepositAllSum, &b.DepositCount, &b.PincoinBalance, &b.PincoinsAllSum); err {
+	case nil:
+		return b.store(), true, nil
+	case pgx.ErrNoRows:
+		return store.Balance{}, false, nil
+	default:
+		return store.Balance{}, false, errors.WithStack(err)
+	}
+}
+
+// Retries of transactions made since start
+func (s *Repo) Retries() uint64 {
+	return atomic.LoadUint64(&s.retries)
+}
+
+// Idempotent reports whether UpdateTX applies redelivered transaction once
+func (s *Repo) Idempotent() bool {
+	return s.cfg.Idempotent
+}
+
 func (s *Repo) Insert(ctx context.Context, j Journal) error {
 	sq := `INSERT INTO journal("id2","accountId","balance","change","currency","date","depositAllSum","depositCount",
                 "pincoinBalance","pincoinAllSum","pincoinChange","project","revert","transactionId",
@@ -147,5 +483,212 @@ func (s *Repo) Insert(ctx context.Context, j Journal) error {
 	}
 
 	return nil
+}
+
+// InsertJournal writes journal record of transaction without balance change
+func (s *Repo) InsertJournal(ctx context.Context, in changing.Transaction) error {
+	return s.Insert(ctx, NewJournal(Balance{AccountID: in.AccountID}, in))
+}
+
+func (s *Repo) GetBalance(ctx context.Context, account uint64) (store.Balance, error) {
+	res := s.pool.QueryRow(ctx, `SELECT "balance", "depositAllSum", "depositCount", "pincoinBalance", "pincoinAllSum"
+		FROM balance WHERE "accountId" = $1`, account)
+
+	b := Balance{AccountID: account}
+	switch err := res.Scan(&b.Balance, &b.DepositAllSum, &b.DepositCount, &b.PincoinBalance, &b.PincoinsAllSum); err {
+	case nil:
+	case pgx.ErrNoRows:
+		return store.Balance{}, errors.WithStack(store.ErrNotFound)
+	default:
+		return store.Balance{}, errors.WithStack(err)
+	}
+
+	return b.store(), nil
+}
+
+func (s *Repo) ScanBalances(ctx context.Context, fn func(store.Balance) error) error {
+	rows, err := s.pool.Query(ctx, `SELECT "accountId", "balance", "depositAllSum", "depositCount", "pincoinBalance", "pincoinAllSum"
+		FROM balance`)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var b Balance
+		if err = rows.Scan(&b.AccountID, &b.Balance, &b.DepositAllSum, &b.DepositCount, &b.PincoinBalance, &b.PincoinsAllSum); err != nil {
+			return errors.WithStack(err)
+		}
+
+		if err = fn(b.store()); err != nil {
+			return err
+		}
+	}
+
+	return errors.WithStack(rows.Err())
+}
+
+func (s *Repo) ScanJournal(ctx context.Context, fn func(store.Entry) error) error {
+	rows, err := s.pool.Query(ctx, `SELECT "accountId", "transactionId", COALESCE("revert", FALSE),
+		"balance", "depositAllSum", "depositCount", "pincoinBalance", "pincoinAllSum",
+		"incBalance", "incDepositAllSum", "incDepositCount", "incPincoinBalance", "incPincoinAllSum"
+		FROM journal WHERE "incBalance" IS NOT NULL`)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			b    Balance
+			txID int64
+			inc  increments
+			e    store.Entry
+		)
 
+		err = rows.Scan(&b.AccountID, &txID, &e.Revert,
+			&b.Balance, &b.DepositAllSum, &b.DepositCount, &b.PincoinBalance, &b.PincoinsAllSum,
+			&inc.Balance, &inc.DepositAllSum, &inc.DepositCount, &inc.PincoinBalance, &inc.PincoinsAllSum)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		// compensating record keeps inverse increments of reverted one
+		if e.Revert {
+			inc = inc.neg()
+		}
+
+		e.AccountID, e.TransactionID, e.Total, e.Inc = b.AccountID, uint64(txID), b.store(), inc.inc()
+
+		if err = fn(e); err != nil {
+			return err
+		}
+	}
+
+	return errors.WithStack(rows.Err())
+}
+
+// ListJournal pages journal records of account by journal_account_date index, ID of record is its id
+func (s *Repo) ListJournal(ctx context.Context, account uint64, from, to time.Time, cursor string, limit int) (store.Page, error) {
+	if limit <= 0 {
+		return store.Page{}, errors.WithStack(store.ErrBadLimit)
+	}
+
+	c, err := store.ParseCursor(cursor)
+	if err != nil {
+		return store.Page{}, errors.WithStack(err)
+	}
+
+	where, args := []string{`"accountId" = $1`}, []interface{}{int64(account)}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if !from.IsZero() {
+		where = append(where, `"date" >= `+arg(from))
+	}
+
+	if !to.IsZero() {
+		where = append(where, `"date" < `+arg(to))
+	}
+
+	if !c.IsZero() {
+		id, err := uuid.Parse(c.ID)
+		if err != nil {
+			return store.Page{}, errors.WithStack(store.ErrBadCursor)
+		}
+
+		where = append(where, `("date", "id") < (`+arg(c.Date)+`, `+arg(id.String())+`::uuid)`)
+	}
+
+	rows, err := s.pool.Query(ctx, `SELECT "id"::text, "transactionId", "date", "transactionType", "project", "change", COALESCE("revert", FALSE),
+		"balance", "depositAllSum", "depositCount", "pincoinBalance", "pincoinAllSum",
+		COALESCE("incBalance", 0), COALESCE("incDepositAllSum", 0), COALESCE("incDepositCount", 0),
+		COALESCE("incPincoinBalance", 0), COALESCE("incPincoinAllSum", 0),
+		COALESCE("revertOf"::text, ''), COALESCE("revertedBy"::text, '')
+		FROM journal WHERE `+strings.Join(where, " AND ")+`
+		ORDER BY "date" DESC, "id" DESC LIMIT `+arg(limit+1), args...)
+	if err != nil {
+		return store.Page{}, errors.WithStack(err)
+	}
+
+	defer rows.Close()
+
+	var out []store.Record
+	for rows.Next() {
+		var (
+			rec    store.Record
+			b      = Balance{AccountID: account}
+			txID   int64
+			change float32
+			inc    increments
+		)
+
+		err = rows.Scan(&rec.ID, &txID, &rec.Date, &rec.TransactionType, &rec.Project, &change, &rec.Revert,
+			&b.Balance, &b.DepositAllSum, &b.DepositCount, &b.PincoinBalance, &b.PincoinsAllSum,
+			&inc.Balance, &inc.DepositAllSum, &inc.DepositCount, &inc.PincoinBalance, &inc.PincoinsAllSum,
+			&rec.RevertOf, &rec.RevertedBy)
+		if err != nil {
+			return store.Page{}, errors.WithStack(err)
+		}
+
+		if rec.Revert {
+			inc = inc.neg()
+		}
+
+		rec.AccountID, rec.TransactionID, rec.Total, rec.Inc = account, uint64(txID), b.store(), inc.inc()
+		rec.Change = float64(change)
+
+		out = append(out, rec)
+	}
+
+	if err = rows.Err(); err != nil {
+		return store.Page{}, errors.WithStack(err)
+	}
+
+	return store.NewPage(out, limit), nil
+}
+
+// Teardown drops tables of Setup
+func (s *Repo) Teardown(ctx context.Context) error {
+	if _, err := s.pool.Exec(ctx, `DROP TABLE IF EXISTS "journal", "balance"`); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
+
+// Size is total size of balance and journal tables with indexes
+func (s *Repo) Size(ctx context.Context) (int64, error) {
+	var size int64
+
+	err := s.pool.QueryRow(ctx, `SELECT pg_total_relation_size('balance') + pg_total_relation_size('journal')`).Scan(&size)
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+
+	return size, nil
+}
+
+// AddHook appends fn to placeholder of UpdateTX and Revert, it is safe to add hooks while transactions run
+func (s *Repo) AddHook(p fault.Point, fn fault.Hook) {
+	s.hooks.Add(p, fn)
+}
+
+// call runs hooks of placeholder, abort of fault becomes serialization failure which clients retry
+func (s *Repo) call(ctx context.Context, p fault.Point) error {
+	err := s.hooks.Call(ctx, p)
+	if errors.Is(err, fault.ErrAbort) {
+		return errors.WithStack(&pgconn.PgError{Severity: "ERROR", Code: stateSerialization, Message: err.Error()})
+	}
+
+	return errors.WithStack(err)
+}
+
+func (s *Repo) Close(_ context.Context) error {
+	s.pool.Close()
+	return nil
 }
@@ -7,10 +7,13 @@ import (
 	"context"
 	"fmt"
 	"math/rand"
+	"os"
 	"testing"
+	"time"
 
 	"github.com/d7561985/mongo-ab/internal/config"
 	"github.com/d7561985/mongo-ab/pkg/changing"
+	"github.com/d7561985/mongo-ab/pkg/store/storetest"
 	fuzz "github.com/google/gofuzz"
 	"github.com/stretchr/testify/require"
 )
@@ -30,6 +33,22 @@ func TestNew(t *testing.T) {
 	fmt.Println(b)
 }
 
+func TestContract(t *testing.T) {
+	addr := dbConnect
+	if v := os.Getenv(EnvPostgresAddr); v != "" {
+		addr = v
+	}
+
+	ctx := context.Background()
+
+	q, err := New(ctx, config.Postgres{Addr: addr})
+	require.NoError(t, err)
+	require.NoError(t, q.Setup(ctx))
+
+	// account of INT8 column
+	storetest.JournalLister(t, q, uint64(time.Now().UnixNano()))
+}
+
 func genRequest(usr uint64, add float64) changing.Transaction {
 	tx := changing.Transaction{}
 	fuzz.New().Fuzz(&tx)
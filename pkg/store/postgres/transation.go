@@ -4,6 +4,7 @@ import (
 	"time"
 
 	"github.com/d7561985/mongo-ab/pkg/changing"
+	"github.com/d7561985/mongo-ab/pkg/store"
 	"github.com/google/uuid"
 )
 
@@ -17,6 +18,17 @@ type Balance struct {
 	PincoinsAllSum float64
 }
 
+func (b Balance) store() store.Balance {
+	return store.Balance{
+		AccountID:      b.AccountID,
+		Balance:        b.Balance,
+		DepositAllSum:  b.DepositAllSum,
+		DepositCount:   uint64(b.DepositCount),
+		PincoinBalance: b.PincoinBalance,
+		PincoinsAllSum: b.PincoinsAllSum,
+	}
+}
+
 type Journal struct {
 	ID   uuid.UUID
 	ID2  []byte
@@ -51,3 +63,44 @@ func NewJournal(b Balance, in changing.Transaction) Journal {
 		Revert:            in.Set.Revert,
 	}
 }
+
+// increments of journal record, depositCount is signed to keep inverse ones of Revert
+type increments struct {
+	Balance       float64
+	DepositAllSum float64
+	DepositCount  int64
+
+	PincoinBalance float64
+	PincoinsAllSum float64
+}
+
+func newIncrements(in changing.Inc) increments {
+	return increments{
+		Balance:        in.Balance,
+		DepositAllSum:  in.DepositAllSum,
+		DepositCount:   int64(in.DepositCount),
+		PincoinBalance: in.PincoinBalance,
+		PincoinsAllSum: in.PincoinsAllSum,
+	}
+}
+
+// neg is inverse increments
+func (i increments) neg() increments {
+	return increments{
+		Balance:        -i.Balance,
+		DepositAllSum:  -i.DepositAllSum,
+		DepositCount:   -i.DepositCount,
+		PincoinBalance: -i.PincoinBalance,
+		PincoinsAllSum: -i.PincoinsAllSum,
+	}
+}
+
+func (i increments) inc() changing.Inc {
+	return changing.Inc{
+		Balance:        i.Balance,
+		DepositAllSum:  i.DepositAllSum,
+		DepositCount:   uint64(i.DepositCount),
+		PincoinBalance: i.PincoinBalance,
+		PincoinsAllSum: i.PincoinsAllSum,
+	}
+}
@@ -0,0 +1,150 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/d7561985/mongo-ab/pkg/changing"
+	"github.com/urfave/cli/v2"
+)
+
+var (
+	// ErrNotFound is returned for account which has no balance yet
+	ErrNotFound = errors.New("account not found")
+	// ErrNoRecord is returned for unknown journal record
+	ErrNoRecord = errors.New("journal record not found")
+	// ErrReverted is returned by Revert of journal record which is already reverted
+	ErrReverted = errors.New("journal record is already reverted")
+	// ErrNotRevertible is returned by Revert of journal record which is not of UpdateTX, e.g. of revert itself
+	ErrNotRevertible = errors.New("journal record is not revertible")
+	// ErrInsufficientFunds is returned for transaction which funds rule refuses, see funds.Mode
+	ErrInsufficientFunds = errors.New("insufficient funds")
+)
+
+// Balance is state of account
+type Balance struct {
+	AccountID     uint64
+	Balance       float64
+	DepositAllSum float64
+	DepositCount  uint64
+
+	PincoinBalance float64
+	PincoinsAllSum float64
+}
+
+// Store is database under test
+type Store interface {
+	// Setup creates schema, existing one is kept
+	Setup(ctx context.Context) error
+	// UpdateTX increments balance of account and writes journal record in one transaction
+	UpdateTX(ctx context.Context, tx changing.Transaction) (Balance, error)
+	// InsertJournal writes journal record only
+	InsertJournal(ctx context.Context, tx changing.Transaction) error
+	// GetBalance returns ErrNotFound for unknown account
+	GetBalance(ctx context.Context, account uint64) (Balance, error)
+	// Teardown drops schema with all data
+	Teardown(ctx context.Context) error
+	Close(ctx context.Context) error
+}
+
+// Sizer is store which reports its disk usage
+type Sizer interface {
+	// Size returns bytes of data and indexes
+	Size(ctx context.Context) (int64, error)
+}
+
+// Deduplicator is store which could apply UpdateTX of the same transaction id once
+type Deduplicator interface {
+	// Idempotent reports whether redelivered transaction returns recorded result instead of being applied again
+	Idempotent() bool
+}
+
+// Retrier is store which retries failed transactions
+type Retrier interface {
+	// Retries returns number of retries made since store was opened
+	Retries() uint64
+}
+
+// Entry is journal record of UpdateTX: increments of transaction and totals of account after them
+type Entry struct {
+	AccountID     uint64
+	TransactionID uint64
+	Inc           changing.Inc
+	Total         Balance
+	// Revert is compensating entry of Revert, it subtracts Inc of reverted entry
+	Revert bool
+}
+
+// Reverter is store which could revert UpdateTX
+type Reverter interface {
+	// Revert applies inverse increments of UpdateTX journal record to balance and writes compensating record
+	// linked to it in one transaction. Record is reverted once, the next Revert returns ErrReverted.
+	Revert(ctx context.Context, journalID string) (Record, error)
+}
+
+// Ledger is store whose balances and journal could be read in full, e.g. to verify them
+type Ledger interface {
+	ScanBalances(ctx context.Context, fn func(Balance) error) error
+	// ScanJournal passes records of UpdateTX, records of InsertJournal are skipped
+	ScanJournal(ctx context.Context, fn func(Entry) error) error
+}
+
+// Backend is store which commands could run, its flags are added to every such command
+type Backend struct {
+	Name  string
+	Flags []cli.Flag
+	// Open connects to store of flags, schema is created by Setup
+	Open func(c *cli.Context) (Store, error)
+	// Ephemeral store has no state out of process, commands which read state of previous run skip it
+	Ephemeral bool
+	// Target names data which store of flags writes, stores of the same target share it. Nil - every store has its own
+	Target func(c *cli.Context) string
+}
+
+var (
+	mu       sync.RWMutex
+	backends = map[string]Backend{}
+)
+
+// Register makes backend available by name, it is called from init of backend package
+func Register(b Backend) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if _, ok := backends[b.Name]; ok {
+		panic(fmt.Sprintf("store: backend %q registered twice", b.Name))
+	}
+
+	backends[b.Name] = b
+}
+
+// Get returns backend by name
+func Get(name string) (Backend, error) {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	b, ok := backends[name]
+	if !ok {
+		return Backend{}, fmt.Errorf("unknown store backend %q", name)
+	}
+
+	return b, nil
+}
+
+// Backends returns registered backends sorted by name
+func Backends() []Backend {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	out := make([]Backend, 0, len(backends))
+	for _, b := range backends {
+		out = append(out, b)
+	}
+
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+
+	return out
+}
@@ -0,0 +1,78 @@
+package store
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegister(t *testing.T) {
+	defer func() { backends = map[string]Backend{} }()
+
+	Register(Backend{Name: "b"})
+	Register(Backend{Name: "a"})
+
+	b, err := Get("b")
+	require.NoError(t, err)
+	assert.Equal(t, "b", b.Name)
+
+	_, err = Get("c")
+	assert.Error(t, err)
+
+	var names []string
+	for _, b := range Backends() {
+		names = append(names, b.Name)
+	}
+
+	assert.Equal(t, []string{"a", "b"}, names)
+
+	assert.Panics(t, func() { Register(Backend{Name: "a"}) })
+}
+
+func TestCursor(t *testing.T) {
+	c := Cursor{Date: time.Unix(0, 1_600_000_000_123_456_789), ID: "6a1f:b"}
+
+	got, err := ParseCursor(c.String())
+	require.NoError(t, err)
+	assert.True(t, c.Date.Equal(got.Date))
+	assert.Equal(t, c.ID, got.ID)
+
+	got, err = ParseCursor("")
+	require.NoError(t, err)
+	assert.True(t, got.IsZero())
+
+	for _, in := range []string{"%%", "eA", "MTI"} {
+		_, err = ParseCursor(in)
+		assert.ErrorIs(t, err, ErrBadCursor, in)
+	}
+}
+
+func TestCursorLocal(t *testing.T) {
+	defer func(l *time.Location) { time.Local = l }(time.Local)
+	time.Local = time.FixedZone("UTC+3", 3*60*60)
+
+	// journal date is read back from TIMESTAMP as UTC wall clock
+	date := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+
+	got, err := ParseCursor(Cursor{Date: date, ID: "1"}.String())
+	require.NoError(t, err)
+	assert.Equal(t, date, got.Date)
+	assert.Equal(t, 10, got.Date.Hour())
+}
+
+func TestNewPage(t *testing.T) {
+	records := []Record{{ID: "3"}, {ID: "2"}, {ID: "1"}}
+
+	p := NewPage(records, 3)
+	assert.Len(t, p.Records, 3)
+	assert.Empty(t, p.Next)
+
+	p = NewPage(records, 2)
+	assert.Len(t, p.Records, 2)
+
+	c, err := ParseCursor(p.Next)
+	require.NoError(t, err)
+	assert.Equal(t, "2", c.ID)
+}
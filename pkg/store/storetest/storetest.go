@@ -0,0 +1,70 @@
+// Package storetest is contract every store keeps, tests of stores run it against their backend
+package storetest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/d7561985/mongo-ab/pkg/changing"
+	"github.com/d7561985/mongo-ab/pkg/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// badCursor is well-formed cursor whose ID no store has: not a position, ObjectID or uuid
+var badCursor = store.Cursor{Date: time.Now(), ID: "not-an-id"}.String()
+
+// JournalLister checks paging of journal records of account which is new to s
+func JournalLister(t *testing.T, s store.Store, account uint64) {
+	ctx := context.Background()
+
+	l, ok := s.(store.JournalLister)
+	require.True(t, ok, "store doesn't list journal")
+
+	// microseconds of postgres TIMESTAMP, two records of every date
+	start := time.Now().UTC().Truncate(time.Millisecond)
+	for i := 0; i < 5; i++ {
+		tx := changing.Transaction{AccountID: account, Inc: changing.Inc{Balance: 10, DepositAllSum: 10, DepositCount: 1}}
+		tx.ID, tx.TransactionIDBson = primitive.NewObjectID(), primitive.NewObjectID()
+		tx.TransactionID, tx.Date = uint64(i), start.Add(time.Duration(i/2)*time.Second)
+		tx.TransactionType, tx.Project, tx.Change = "deposit", "contract", 10
+
+		_, err := s.UpdateTX(ctx, tx)
+		require.NoError(t, err)
+	}
+
+	var (
+		ids    []uint64
+		dates  []time.Time
+		cursor string
+	)
+
+	for {
+		p, err := l.ListJournal(ctx, account, time.Time{}, time.Time{}, cursor, 2)
+		require.NoError(t, err)
+
+		for _, rec := range p.Records {
+			ids, dates = append(ids, rec.TransactionID), append(dates, rec.Date)
+		}
+
+		if cursor = p.Next; cursor == "" {
+			break
+		}
+	}
+
+	// order of records of the same date is order of their IDs, random uuid for postgres
+	assert.ElementsMatch(t, []uint64{4, 3, 2, 1, 0}, ids)
+	for i := 1; i < len(dates); i++ {
+		assert.False(t, dates[i].After(dates[i-1]), "record %d is later than previous one", ids[i])
+	}
+
+	_, err := l.ListJournal(ctx, account, time.Time{}, time.Time{}, "", 0)
+	assert.ErrorIs(t, err, store.ErrBadLimit)
+
+	for _, in := range []string{"%%", badCursor} {
+		_, err = l.ListJournal(ctx, account, time.Time{}, time.Time{}, in, 2)
+		assert.ErrorIs(t, err, store.ErrBadCursor, in)
+	}
+}
@@ -0,0 +1,115 @@
+package trace
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/d7561985/mongo-ab/pkg/worker"
+)
+
+// queue of records of every replay thread
+const queue = 1024
+
+// Player splits trace between replay threads, records of the same recorded thread keep their order.
+// Speed 1 replays original timing, 2 twice as fast, 0 as fast as possible.
+type Player struct {
+	r       *Reader
+	speed   float64
+	start   time.Time
+	threads []chan Record
+}
+
+// NewPlayer starts the clock of original timing
+func NewPlayer(r *Reader, threads int, speed float64) *Player {
+	p := &Player{r: r, speed: speed, start: time.Now(), threads: make([]chan Record, threads)}
+
+	for i := range p.threads {
+		p.threads[i] = make(chan Record, queue)
+	}
+
+	return p
+}
+
+// Run feeds threads until trace or ctx is over, then threads exit when their queue is empty
+func (p *Player) Run(ctx context.Context) error {
+	defer func() {
+		for _, ch := range p.threads {
+			close(ch)
+		}
+	}()
+
+	for {
+		rec, err := p.r.Next()
+		if err == io.EOF {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		i := rec.Thread % len(p.threads)
+		if i < 0 {
+			i = -i
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case p.threads[i] <- rec:
+		}
+	}
+}
+
+// Thread returns operations of replay thread i which apply records
+func (p *Player) Thread(i int, apply func(Record) error) worker.Timed {
+	t := &thread{p: p, in: p.threads[i], apply: apply}
+
+	return worker.Timed{Due: t.due, Do: t.do}
+}
+
+type thread struct {
+	p     *Player
+	in    <-chan Record
+	apply func(Record) error
+	rec   Record
+}
+
+func (t *thread) due(ctx context.Context) (time.Time, bool) {
+	select {
+	case <-ctx.Done():
+		return time.Time{}, false
+	case rec, ok := <-t.in:
+		if !ok {
+			return time.Time{}, false
+		}
+
+		t.rec = rec
+	}
+
+	if t.p.speed <= 0 {
+		return time.Time{}, true
+	}
+
+	due := t.p.start.Add(time.Duration(float64(t.rec.At) / t.p.speed))
+
+	timer := time.NewTimer(time.Until(due))
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return time.Time{}, false
+	case <-timer.C:
+		return due, true
+	}
+}
+
+func (t *thread) do(time.Time) (string, error) {
+	op := t.rec.Op
+	if op == "" {
+		op = t.rec.Kind
+	}
+
+	return op, t.apply(t.rec)
+}
@@ -0,0 +1,246 @@
+package trace
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/d7561985/mongo-ab/pkg/changing"
+	"github.com/d7561985/mongo-ab/pkg/worker"
+)
+
+// Version of trace format
+const Version = 1
+
+// Header is optional first line of trace: {"header": {...}}
+type Header struct {
+	Version int       `json:"version"`
+	Created time.Time `json:"created"`
+	// Source is command which recorded trace
+	Source  string `json:"source,omitempty"`
+	Threads int    `json:"threads,omitempty"`
+	Seed    int64  `json:"seed,omitempty"`
+}
+
+// Record is single operation of trace, one JSON line
+type Record struct {
+	// At is intended start since the beginning of recording
+	At     time.Duration `json:"at"`
+	Thread int           `json:"thread"`
+	// Op is name of operation, Kind is how backend applies it: tx, insert
+	Op   string               `json:"op,omitempty"`
+	Kind string               `json:"kind"`
+	Tx   changing.Transaction `json:"tx"`
+}
+
+type headerLine struct {
+	Header *Header `json:"header"`
+}
+
+// Writer records operations of all threads, it is worker.Sink which closes file when run finishes.
+// Methods of nil Writer do nothing, so recording could be disabled without checks.
+type Writer struct {
+	mu    sync.Mutex
+	start time.Time
+	f     *os.File
+	buf   *bufio.Writer
+	gz    *gzip.Writer
+	enc   *json.Encoder
+	err   error
+	once  sync.Once
+}
+
+var _ worker.Sink = (*Writer)(nil)
+
+// Create starts trace at path, ".gz" suffix compresses it
+func Create(path string, h Header) (*Writer, error) {
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, fmt.Errorf("create trace: %w", err)
+		}
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("create trace: %w", err)
+	}
+
+	w := &Writer{start: time.Now(), f: f, buf: bufio.NewWriter(f)}
+
+	var out io.Writer = w.buf
+	if strings.HasSuffix(path, ".gz") {
+		w.gz = gzip.NewWriter(w.buf)
+		out = w.gz
+	}
+
+	w.enc = json.NewEncoder(out)
+
+	h.Version, h.Created = Version, w.start
+	if err = w.enc.Encode(headerLine{Header: &h}); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("write trace header: %w", err)
+	}
+
+	return w, nil
+}
+
+// Add records operation of thread whose intended start is begin, e.g. schedule of open-loop run,
+// so that replay reproduces arrivals rather than queueing of recorded run. The first write error is returned by Close.
+func (w *Writer) Add(thread int, begin time.Time, op, kind string, tx changing.Transaction) {
+	if w == nil {
+		return
+	}
+
+	at := begin.Sub(w.start)
+	if at < 0 {
+		at = 0
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.err != nil {
+		return
+	}
+
+	w.err = w.enc.Encode(Record{At: at, Thread: thread, Op: op, Kind: kind, Tx: tx})
+}
+
+// Close flushes trace, it is safe to call it more than once
+func (w *Writer) Close() error {
+	if w == nil {
+		return nil
+	}
+
+	w.once.Do(func() {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+
+		err := w.err
+		if w.gz != nil {
+			err = first(err, w.gz.Close())
+		}
+
+		err = first(err, w.buf.Flush())
+		err = first(err, w.f.Close())
+
+		if err != nil {
+			w.err = fmt.Errorf("write trace: %w", err)
+		}
+	})
+
+	return w.err
+}
+
+func (w *Writer) Sample(worker.Sample) {}
+
+func (w *Writer) Finish(worker.Summary) error {
+	return w.Close()
+}
+
+// Reader reads trace record by record
+type Reader struct {
+	f      *os.File
+	gz     *gzip.Reader
+	dec    *json.Decoder
+	header Header
+	// first record of trace without header
+	pending *Record
+}
+
+// Open reads trace at path, ".gz" suffix is decompressed. Trace without header is accepted, e.g. imported one.
+func Open(path string) (*Reader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open trace: %w", err)
+	}
+
+	r := &Reader{f: f}
+
+	var in io.Reader = bufio.NewReader(f)
+	if strings.HasSuffix(path, ".gz") {
+		if r.gz, err = gzip.NewReader(in); err != nil {
+			f.Close()
+			return nil, fmt.Errorf("open trace: %w", err)
+		}
+
+		in = r.gz
+	}
+
+	r.dec = json.NewDecoder(in)
+
+	var raw json.RawMessage
+	if err = r.dec.Decode(&raw); err != nil && err != io.EOF {
+		r.Close()
+		return nil, fmt.Errorf("read trace: %w", err)
+	}
+
+	if err == io.EOF {
+		return r, nil
+	}
+
+	var h headerLine
+	if err = json.Unmarshal(raw, &h); err == nil && h.Header != nil {
+		r.header = *h.Header
+		return r, nil
+	}
+
+	rec := Record{}
+	if err = json.Unmarshal(raw, &rec); err != nil {
+		r.Close()
+		return nil, fmt.Errorf("read trace record 1: %w", err)
+	}
+
+	r.pending = &rec
+
+	return r, nil
+}
+
+// Header of trace, zero when trace has none
+func (r *Reader) Header() Header {
+	return r.header
+}
+
+// Next record, io.EOF at the end of trace
+func (r *Reader) Next() (Record, error) {
+	if r.pending != nil {
+		rec := *r.pending
+		r.pending = nil
+
+		return rec, nil
+	}
+
+	rec := Record{}
+	if err := r.dec.Decode(&rec); err != nil {
+		if err == io.EOF {
+			return rec, err
+		}
+
+		return rec, fmt.Errorf("read trace: %w", err)
+	}
+
+	return rec, nil
+}
+
+func (r *Reader) Close() error {
+	if r.gz != nil {
+		r.gz.Close()
+	}
+
+	return r.f.Close()
+}
+
+func first(err, next error) error {
+	if err != nil {
+		return err
+	}
+
+	return next
+}
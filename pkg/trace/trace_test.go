@@ -0,0 +1,184 @@
+package trace
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/d7561985/mongo-ab/pkg/changing"
+	"github.com/d7561985/mongo-ab/pkg/worker"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func record(t *testing.T, path string, n int) []changing.Transaction {
+	w, err := Create(path, Header{Source: "test", Threads: 2, Seed: 42})
+	require.NoError(t, err)
+
+	var txs []changing.Transaction
+	for i := 0; i < n; i++ {
+		tx := changing.Transaction{AccountID: uint64(i)}
+		tx.Balance, tx.Type, tx.ID = float64(i), "deposit", primitive.NewObjectID()
+		tx.Date = time.Now().UTC().Truncate(time.Millisecond)
+
+		w.Add(i%2, time.Now(), "deposit", "tx", tx)
+		txs = append(txs, tx)
+	}
+
+	require.NoError(t, w.Finish(worker.Summary{}))
+	require.NoError(t, w.Close())
+
+	return txs
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, name := range []string{"trace.jsonl", "trace.jsonl.gz"} {
+		path := filepath.Join(t.TempDir(), name)
+		txs := record(t, path, 10)
+
+		r, err := Open(path)
+		require.NoError(t, err)
+
+		h := r.Header()
+		assert.Equal(t, Version, h.Version)
+		assert.Equal(t, 2, h.Threads)
+		assert.EqualValues(t, 42, h.Seed)
+
+		var prev time.Duration
+		for i, tx := range txs {
+			rec, err := r.Next()
+			require.NoError(t, err)
+
+			assert.Equal(t, i%2, rec.Thread)
+			assert.Equal(t, "tx", rec.Kind)
+			assert.True(t, rec.At >= prev)
+			assert.Equal(t, tx.AccountID, rec.Tx.AccountID)
+			assert.Equal(t, tx.Balance, rec.Tx.Balance)
+			assert.Equal(t, tx.ID, rec.Tx.ID)
+			assert.True(t, tx.Date.Equal(rec.Tx.Date))
+
+			prev = rec.At
+		}
+
+		_, err = r.Next()
+		assert.Equal(t, io.EOF, err)
+		assert.NoError(t, r.Close())
+	}
+}
+
+func TestWithoutHeader(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "import.jsonl")
+	in := `{"thread": 1, "kind": "insert", "tx": {"accountId": 7}}
+{"thread": 0, "kind": "tx", "tx": {"accountId": 8}}
+`
+	require.NoError(t, os.WriteFile(path, []byte(in), 0644))
+
+	r, err := Open(path)
+	require.NoError(t, err)
+
+	defer r.Close()
+
+	assert.Zero(t, r.Header())
+
+	for _, want := range []uint64{7, 8} {
+		rec, err := r.Next()
+		require.NoError(t, err)
+		assert.Equal(t, want, rec.Tx.AccountID)
+	}
+
+	_, err = r.Next()
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestNilWriter(t *testing.T) {
+	var w *Writer
+
+	w.Add(0, time.Now(), "tx", "tx", changing.Transaction{})
+	assert.NoError(t, w.Close())
+}
+
+func TestOpenLoopArrivals(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "trace.jsonl")
+
+	rec, err := Create(path, Header{Source: "test", Threads: 1})
+	require.NoError(t, err)
+
+	// operation is 3 times slower than schedule of 100 op/sec, so it queues up
+	w := worker.New(&worker.Config{Threads: 1, Iterations: 20, Rate: 100})
+	w.RunThreads(context.Background(), func(int) worker.Timed {
+		return worker.Timed{Do: func(begin time.Time) (string, error) {
+			rec.Add(0, begin, "tx", "tx", changing.Transaction{})
+			time.Sleep(30 * time.Millisecond)
+			return "tx", nil
+		}}
+	})
+	require.NoError(t, w.Wait())
+	require.NoError(t, rec.Close())
+
+	r, err := Open(path)
+	require.NoError(t, err)
+
+	var last Record
+	for {
+		next, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+
+		require.NoError(t, err)
+		last = next
+	}
+
+	// schedule of the 20th operation is 190ms, it started after 570ms of queueing
+	assert.Less(t, last.At, 400*time.Millisecond)
+}
+
+func TestPlayer(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "trace.jsonl")
+	record(t, path, 100)
+
+	for _, speed := range []float64{0, 1} {
+		r, err := Open(path)
+		require.NoError(t, err)
+
+		p := NewPlayer(r, 3, speed)
+
+		mu := sync.Mutex{}
+		seen := map[int][]uint64{}
+
+		w := worker.New(&worker.Config{Threads: 3})
+
+		go func() {
+			assert.NoError(t, p.Run(context.Background()))
+		}()
+
+		w.RunThreads(context.Background(), func(i int) worker.Timed {
+			return p.Thread(i, func(rec Record) error {
+				mu.Lock()
+				defer mu.Unlock()
+
+				seen[rec.Thread] = append(seen[rec.Thread], rec.Tx.AccountID)
+				return nil
+			})
+		})
+
+		require.NoError(t, w.Wait())
+		assert.EqualValues(t, 100, w.Summary().Ops)
+
+		// recorded thread goes to the same replay thread, so its order is kept
+		for thread, ids := range seen {
+			assert.Len(t, ids, 50)
+
+			for i, id := range ids {
+				assert.EqualValues(t, thread+i*2, id)
+			}
+		}
+
+		r.Close()
+	}
+}
@@ -0,0 +1,271 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// SLO which trial must hold to count as capacity, zero values are not checked
+type SLO struct {
+	P99       time.Duration
+	ErrorRate float64
+}
+
+// Violation returns reason why s breaks SLO or empty string
+func (o SLO) Violation(s Summary) string {
+	if s.Ops == 0 {
+		return "no successful operations"
+	}
+
+	if o.P99 > 0 && s.Latency.P99 > o.P99 {
+		return fmt.Sprintf("p99 %v > %v", round(s.Latency.P99), o.P99)
+	}
+
+	rate := float64(s.Failed) / float64(s.Ops+s.Failed)
+	if o.ErrorRate > 0 && rate > o.ErrorRate {
+		return fmt.Sprintf("error rate %.2f%% > %.2f%%", rate*100, o.ErrorRate*100)
+	}
+
+	return ""
+}
+
+// Search of max throughput which holds SLO
+type Search struct {
+	// From and To limit load: threads or open-loop rate when Rate is set
+	From, To float64
+	Rate     bool
+
+	// Step raises load linearly until SLO is broken, zero means binary search
+	Step float64
+
+	// Trial duration of every load point, warm-up of Config precedes each trial
+	Trial time.Duration
+	SLO   SLO
+}
+
+// ParseSearch reads load range in the same form as profile value: 10-500 threads or 1000-50000/s
+func ParseSearch(in string) (Search, error) {
+	rate := strings.HasSuffix(in, rateSuffix)
+
+	from, to, err := parseRange(strings.TrimSuffix(in, rateSuffix))
+	if err != nil {
+		return Search{}, fmt.Errorf("capacity range %q: %w", in, err)
+	}
+
+	if from <= 0 || to < from {
+		return Search{}, fmt.Errorf("capacity range %q: want 0 < from <= to", in)
+	}
+
+	return Search{From: from, To: to, Rate: rate}, nil
+}
+
+func (s Search) unit() string {
+	if s.Rate {
+		return "op/sec"
+	}
+
+	return "threads"
+}
+
+// precision of binary search: 1 thread or 2% of rate
+func (s Search) precision(load float64) float64 {
+	if s.Rate {
+		return math.Max(1, load*0.02)
+	}
+
+	return 1
+}
+
+// Trial is single measured load point
+type Trial struct {
+	Load      float64
+	Summary   Summary
+	Violation string
+}
+
+func (t Trial) OK() bool {
+	return t.Violation == ""
+}
+
+func (t Trial) sample(s Search) Sample {
+	threads := int64(t.Load)
+	if s.Rate {
+		threads = 0
+	}
+
+	return Sample{
+		Time:       time.Now(),
+		Elapsed:    t.Summary.Duration,
+		Stage:      fmt.Sprintf("capacity %g %s", t.Load, s.unit()),
+		Threads:    threads,
+		Ops:        t.Summary.Ops,
+		Failed:     t.Summary.Failed,
+		Total:      t.Summary.Ops,
+		Throughput: t.Summary.Throughput,
+		Latency:    t.Summary.Latency,
+		Errors:     t.Summary.Errors,
+	}
+}
+
+// Capacity is result of search: all measured points in order and the best one which holds SLO
+type Capacity struct {
+	Search Search
+	Trials []Trial
+
+	best int
+}
+
+// Best returns trial with the highest throughput which holds SLO
+func (c Capacity) Best() (Trial, bool) {
+	if c.best < 0 {
+		return Trial{}, false
+	}
+
+	return c.Trials[c.best], true
+}
+
+func (c Capacity) String() string {
+	b := &strings.Builder{}
+
+	fmt.Fprintln(b, "==== capacity curve ====")
+
+	w := tabwriter.NewWriter(b, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "%s\tcomb/sec\tops\terrors\tp50\tp99\tp99.9\tslo\n", c.Search.unit())
+
+	for _, t := range c.Trials {
+		slo := "ok"
+		if !t.OK() {
+			slo = t.Violation
+		}
+
+		fmt.Fprintf(w, "%g\t%.2f\t%d\t%d\t%v\t%v\t%v\t%s\n", t.Load, t.Summary.Throughput, t.Summary.Ops, t.Summary.Failed,
+			round(t.Summary.Latency.P50), round(t.Summary.Latency.P99), round(t.Summary.Latency.P999), slo)
+	}
+
+	_ = w.Flush()
+
+	best, ok := c.Best()
+	if !ok {
+		fmt.Fprintf(b, "==== capacity: SLO is not held even at %g %s ====", c.Search.From, c.Search.unit())
+		return b.String()
+	}
+
+	fmt.Fprintf(b, "==== capacity: %.2f comb/sec at %g %s, p99 %v ====",
+		best.Summary.Throughput, best.Load, c.Search.unit(), round(best.Summary.Latency.P99))
+
+	return b.String()
+}
+
+// FindCapacity runs short trials with growing load and stops at the highest throughput which holds SLO.
+// Cancel of ctx stops search, capacity found so far is returned.
+// Sinks of cfg receive every trial as sample and the best one as summary.
+func FindCapacity(ctx context.Context, cfg Config, s Search, factory func(thread int) Timed) (Capacity, error) {
+	res := s.find(ctx, cfg, factory)
+
+	for _, t := range res.Trials {
+		for _, sink := range cfg.Sinks {
+			sink.Sample(t.sample(s))
+		}
+	}
+
+	best, _ := res.Best()
+
+	var err error
+	for _, sink := range cfg.Sinks {
+		if e := sink.Finish(best.Summary); e != nil && err == nil {
+			err = e
+		}
+	}
+
+	return res, err
+}
+
+func (s Search) find(ctx context.Context, cfg Config, factory func(thread int) Timed) Capacity {
+	res := Capacity{Search: s, best: -1}
+
+	// trial returns false when search must stop: SLO is broken or ctx is done
+	trial := func(load float64) bool {
+		t := s.run(ctx, cfg, load, factory)
+
+		log.Printf("capacity trial %g %s: %.2f comb/sec, p99 %v %s",
+			load, s.unit(), t.Summary.Throughput, round(t.Summary.Latency.P99), t.Violation)
+
+		// interrupted trial is not representative
+		if ctx.Err() != nil {
+			return false
+		}
+
+		res.Trials = append(res.Trials, t)
+
+		if best, ok := res.Best(); t.OK() && (!ok || t.Summary.Throughput > best.Summary.Throughput) {
+			res.best = len(res.Trials) - 1
+		}
+
+		return t.OK()
+	}
+
+	if s.Step > 0 {
+		for load := s.From; load <= s.To && trial(load); load += s.Step {
+		}
+
+		return res
+	}
+
+	lo, hi := s.From, s.To
+
+	if !trial(lo) || lo == hi || trial(hi) || ctx.Err() != nil {
+		return res
+	}
+
+	for hi-lo > s.precision(lo) && ctx.Err() == nil {
+		mid := (lo + hi) / 2
+		if !s.Rate {
+			mid = math.Floor(mid)
+		}
+
+		if trial(mid) {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+
+	return res
+}
+
+func (s Search) run(ctx context.Context, cfg Config, load float64, factory func(thread int) Timed) Trial {
+	cfg.Profile = nil
+	cfg.Iterations = 0
+	cfg.Sinks = nil
+
+	if s.Rate {
+		cfg.Rate = load
+	} else {
+		cfg.Threads, cfg.Rate = int(load), 0
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, cfg.Warmup+s.Trial)
+	defer cancel()
+
+	w := New(&cfg)
+	w.RunThreads(ctx, factory)
+
+	t := Trial{Load: load}
+
+	err := w.Wait()
+	t.Summary = w.Summary()
+
+	switch {
+	case err != nil:
+		t.Violation = err.Error()
+	default:
+		t.Violation = s.SLO.Violation(t.Summary)
+	}
+
+	return t
+}
@@ -0,0 +1,51 @@
+package worker
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSearch(t *testing.T) {
+	s, err := ParseSearch("1000-50000/s")
+	require.NoError(t, err)
+	assert.Equal(t, Search{From: 1000, To: 50000, Rate: true}, s)
+
+	s, err = ParseSearch("10-500")
+	require.NoError(t, err)
+	assert.False(t, s.Rate)
+
+	for _, in := range []string{"", "0-10", "20-10", "a-b"} {
+		_, err = ParseSearch(in)
+		assert.Error(t, err, in)
+	}
+}
+
+func TestFindCapacity(t *testing.T) {
+	// server which serves 4 requests at a time, 10ms each: latency grows above 4 threads
+	slots := make(chan struct{}, 4)
+	factory := func(int) Timed {
+		return Timed{Do: func(time.Time) (string, error) {
+			slots <- struct{}{}
+			time.Sleep(10 * time.Millisecond)
+			<-slots
+			return Operation, nil
+		}}
+	}
+
+	for _, step := range []float64{0, 4} {
+		s := Search{From: 1, To: 32, Step: step, Trial: 200 * time.Millisecond, SLO: SLO{P99: 25 * time.Millisecond}}
+
+		c, err := FindCapacity(context.Background(), Config{}, s, factory)
+		require.NoError(t, err)
+
+		best, ok := c.Best()
+		require.True(t, ok, "step %v", step)
+		assert.GreaterOrEqual(t, best.Load, 4.)
+		assert.LessOrEqual(t, best.Load, 8.)
+		assert.Greater(t, best.Summary.Throughput, 250.)
+	}
+}
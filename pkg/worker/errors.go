@@ -0,0 +1,157 @@
+package worker
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/d7561985/mongo-ab/pkg/errclass"
+)
+
+// error rate budget is not checked before this number of operations
+const budgetMinOps = 100
+
+// ErrorBudget decides when failing run should be aborted, zero values are unlimited
+type ErrorBudget struct {
+	// MaxErrors total number of failed operations
+	MaxErrors uint64
+	// MaxRate share of failed operations in range [0, 1]
+	MaxRate float64
+}
+
+func (b ErrorBudget) Validate() error {
+	if b.MaxRate < 0 || b.MaxRate > 1 {
+		return fmt.Errorf("error rate budget %v is out of range [0, 1]", b.MaxRate)
+	}
+
+	return nil
+}
+
+// Exhausted returns reason of abort or empty string
+func (b ErrorBudget) Exhausted(ops, failed uint64) string {
+	if b.MaxErrors > 0 && failed > b.MaxErrors {
+		return fmt.Sprintf("%d errors exceed budget of %d", failed, b.MaxErrors)
+	}
+
+	total := ops + failed
+	if b.MaxRate > 0 && total >= budgetMinOps {
+		if rate := float64(failed) / float64(total); rate > b.MaxRate {
+			return fmt.Sprintf("error rate %.2f%% exceeds budget of %.2f%%", rate*100, b.MaxRate*100)
+		}
+	}
+
+	return ""
+}
+
+// Errors counts failed operations by class, rejections are kept apart from failures
+type Errors map[errclass.Class]uint64
+
+// Total number of failures, rejections are not counted
+func (e Errors) Total() uint64 {
+	var n uint64
+	for k, v := range e {
+		if !k.Rejection() {
+			n += v
+		}
+	}
+
+	return n
+}
+
+// Rejected number of operations which business rule refused
+func (e Errors) Rejected() uint64 {
+	var n uint64
+	for k, v := range e {
+		if k.Rejection() {
+			n += v
+		}
+	}
+
+	return n
+}
+
+// Sub returns errors happened after prev
+func (e Errors) Sub(prev Errors) Errors {
+	out := make(Errors, len(e))
+	for k, v := range e {
+		if d := v - prev[k]; d > 0 {
+			out[k] = d
+		}
+	}
+
+	return out
+}
+
+// Add returns sum of both
+func (e Errors) Add(o Errors) Errors {
+	out := make(Errors, len(e))
+	for k, v := range e {
+		out[k] = v
+	}
+
+	for k, v := range o {
+		out[k] += v
+	}
+
+	return out
+}
+
+// String of failures, rejections are not listed
+func (e Errors) String() string {
+	keys := make([]string, 0, len(e))
+	for k := range e {
+		if !k.Rejection() {
+			keys = append(keys, string(k))
+		}
+	}
+
+	if len(keys) == 0 {
+		return "0"
+	}
+
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		parts = append(parts, fmt.Sprintf("%s=%d", k, e[errclass.Class(k)]))
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// errorCounter is shared by threads, errors are expected to be rare
+type errorCounter struct {
+	mu     sync.Mutex
+	counts Errors
+	total  uint64
+}
+
+func newErrorCounter() *errorCounter {
+	return &errorCounter{counts: make(Errors)}
+}
+
+// add returns total number of failures and whether it's the first error of class
+func (c *errorCounter) add(class errclass.Class) (total uint64, first bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.counts[class]++
+	if !class.Rejection() {
+		c.total++
+	}
+
+	return c.total, c.counts[class] == 1
+}
+
+func (c *errorCounter) snapshot() Errors {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	out := make(Errors, len(c.counts))
+	for k, v := range c.counts {
+		out[k] = v
+	}
+
+	return out
+}
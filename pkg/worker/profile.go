@@ -0,0 +1,218 @@
+package worker
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	StageRamp  = "ramp"
+	StageStep  = "step"
+	StageSpike = "spike"
+	StageSoak  = "soak"
+	StageHold  = "hold"
+)
+
+// rateSuffix marks stage value as op/sec instead of thread count
+const rateSuffix = "/s"
+
+// Stage of load profile: thread count or target rate changes linearly from From to To during Duration
+type Stage struct {
+	Name     string
+	Duration time.Duration
+	From, To float64
+
+	// Rate stage drives open-loop scheduler, otherwise number of active threads
+	Rate bool
+}
+
+// At returns target of stage after elapsed time
+func (s Stage) At(elapsed time.Duration) float64 {
+	if s.Duration <= 0 || elapsed >= s.Duration {
+		return s.To
+	}
+
+	return s.From + (s.To-s.From)*float64(elapsed)/float64(s.Duration)
+}
+
+func (s Stage) String() string {
+	unit := "threads"
+	if s.Rate {
+		unit = "op/sec"
+	}
+
+	if s.From == s.To {
+		return fmt.Sprintf("%s %v %g %s", s.Name, s.Duration, s.To, unit)
+	}
+
+	return fmt.Sprintf("%s %v %g->%g %s", s.Name, s.Duration, s.From, s.To, unit)
+}
+
+// Profile is sequence of stages, run ends after the last one
+type Profile []Stage
+
+// ParseProfile reads comma separated stages in form kind:duration:value
+//
+//	ramp:1m:10-200       linear ramp of threads from 10 to 200
+//	step:5m:100-500x5    5 equal steps 100, 200 ... 500 threads, 1m each
+//	spike:30s:500        short burst
+//	soak:1h:200          long flat load
+//	hold:1m:5000/s       flat open-loop rate, "/s" suffix switches any stage to op/sec
+//
+// All stages of profile must be either thread or rate based.
+func ParseProfile(in string) (Profile, error) {
+	var out Profile
+
+	for _, item := range strings.Split(in, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		parts := strings.Split(item, ":")
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("stage %q: want kind:duration:value", item)
+		}
+
+		d, err := time.ParseDuration(parts[1])
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("stage %q: bad duration %q", item, parts[1])
+		}
+
+		stages, err := parseStage(parts[0], d, parts[2])
+		if err != nil {
+			return nil, fmt.Errorf("stage %q: %w", item, err)
+		}
+
+		out = append(out, stages...)
+	}
+
+	if len(out) == 0 {
+		return nil, fmt.Errorf("profile %q has no stages", in)
+	}
+
+	for _, s := range out {
+		if s.Rate != out[0].Rate {
+			return nil, fmt.Errorf("profile %q mixes thread and rate stages", in)
+		}
+	}
+
+	return out, nil
+}
+
+func parseStage(kind string, d time.Duration, value string) ([]Stage, error) {
+	rate := strings.HasSuffix(value, rateSuffix)
+	value = strings.TrimSuffix(value, rateSuffix)
+
+	steps := 0
+	if kind == StageStep {
+		i := strings.LastIndex(value, "x")
+		if i < 0 {
+			return nil, fmt.Errorf("step wants from-toxN value")
+		}
+
+		n, err := strconv.Atoi(value[i+1:])
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("bad steps number %q", value[i+1:])
+		}
+
+		steps, value = n, value[:i]
+
+		// both 100-500/sx5 and 100-500x5/s
+		if strings.HasSuffix(value, rateSuffix) {
+			rate, value = true, strings.TrimSuffix(value, rateSuffix)
+		}
+	}
+
+	from, to, err := parseRange(value)
+	if err != nil {
+		return nil, err
+	}
+
+	if !rate && (from < 1 || to < 1) {
+		return nil, fmt.Errorf("thread stage needs at least 1 thread")
+	}
+
+	switch kind {
+	case StageRamp:
+		return []Stage{{Name: kind, Duration: d, From: from, To: to, Rate: rate}}, nil
+	case StageSpike, StageSoak, StageHold:
+		if from != to {
+			return nil, fmt.Errorf("%s wants single value", kind)
+		}
+
+		return []Stage{{Name: kind, Duration: d, From: from, To: to, Rate: rate}}, nil
+	case StageStep:
+		out := make([]Stage, 0, steps)
+		for i := 1; i <= steps; i++ {
+			v := to
+			if steps > 1 {
+				v = from + (to-from)*float64(i-1)/float64(steps-1)
+			}
+
+			if !rate {
+				v = math.Round(v)
+			}
+
+			out = append(out, Stage{
+				Name:     fmt.Sprintf("%s %d/%d", kind, i, steps),
+				Duration: d / time.Duration(steps),
+				From:     v,
+				To:       v,
+				Rate:     rate,
+			})
+		}
+
+		return out, nil
+	default:
+		return nil, fmt.Errorf("unknown stage kind %q", kind)
+	}
+}
+
+func parseRange(v string) (from, to float64, err error) {
+	a, b := v, v
+	if i := strings.Index(v, "-"); i > 0 {
+		a, b = v[:i], v[i+1:]
+	}
+
+	if from, err = strconv.ParseFloat(a, 64); err != nil || from < 0 {
+		return 0, 0, fmt.Errorf("bad value %q", v)
+	}
+
+	if to, err = strconv.ParseFloat(b, 64); err != nil || to < 0 {
+		return 0, 0, fmt.Errorf("bad value %q", v)
+	}
+
+	return from, to, nil
+}
+
+func (p Profile) Duration() time.Duration {
+	var d time.Duration
+	for _, s := range p {
+		d += s.Duration
+	}
+
+	return d
+}
+
+// Rate reports whether profile drives open-loop rate
+func (p Profile) Rate() bool {
+	return len(p) > 0 && p[0].Rate
+}
+
+// Threads returns thread pool size required by profile, def is used for rate profiles
+func (p Profile) Threads(def int) int {
+	if len(p) == 0 || p.Rate() {
+		return def
+	}
+
+	max := 0.
+	for _, s := range p {
+		max = math.Max(max, math.Max(s.From, s.To))
+	}
+
+	return int(math.Ceil(max))
+}
@@ -0,0 +1,34 @@
+package worker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseProfile(t *testing.T) {
+	p, err := ParseProfile("ramp:1m:10-200, soak:10m:200,spike:30s:500,step:4m:100-400x4")
+	require.NoError(t, err)
+	require.Len(t, p, 7)
+
+	assert.Equal(t, Stage{Name: StageRamp, Duration: time.Minute, From: 10, To: 200}, p[0])
+	assert.Equal(t, Stage{Name: "step 2/4", Duration: time.Minute, From: 200, To: 200}, p[4])
+	assert.Equal(t, 15*time.Minute+30*time.Second, p.Duration())
+	assert.Equal(t, 500, p.Threads(30))
+	assert.False(t, p.Rate())
+
+	assert.Equal(t, 105., p[0].At(30*time.Second))
+
+	p, err = ParseProfile("ramp:1m:0-5000/s,hold:1m:5000/s,step:2m:1000-2000/sx2")
+	require.NoError(t, err)
+	assert.True(t, p.Rate())
+	assert.Equal(t, 2000., p[3].To)
+	assert.Equal(t, 30, p.Threads(30))
+
+	for _, bad := range []string{"", "ramp:1m", "soak:1m:1-2", "step:1m:1-2", "ramp:x:1", "walk:1m:1", "soak:1m:0", "ramp:1m:1-2,hold:1m:5/s"} {
+		_, err := ParseProfile(bad)
+		assert.Error(t, err, bad)
+	}
+}
@@ -0,0 +1,143 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	"sync/atomic"
+	"time"
+)
+
+type Arrival string
+
+const (
+	// Fixed arrivals are evenly spaced 1/rate apart
+	Fixed Arrival = "fixed"
+	// Poisson arrivals have exponentially distributed gaps with mean 1/rate
+	Poisson Arrival = "poisson"
+)
+
+func (a Arrival) Validate() error {
+	switch a {
+	case Fixed, Poisson, "":
+		return nil
+	default:
+		return fmt.Errorf("unsupported arrival %q, use %s or %s", a, Fixed, Poisson)
+	}
+}
+
+// backlog of scheduled but not yet picked operations
+const backlog = 1024
+
+// Scheduler emits intended start time of every operation of open-loop run.
+// Schedule never waits for operations to complete, so when the database slows down
+// backlog grows and latency measured from intended start contains queueing time.
+// Arrival which finds backlog full is dropped and counted, schedule keeps its pace.
+type Scheduler struct {
+	C <-chan time.Time
+
+	c       chan time.Time
+	rate    uint64 // float64 bits, changed by load profile
+	arrival Arrival
+	rnd     *rand.Rand
+	dropped uint64
+}
+
+// NewScheduler with seed of Poisson arrivals, zero seed is random
+func NewScheduler(rate float64, arrival Arrival, seed int64) *Scheduler {
+	c := make(chan time.Time, backlog)
+
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+
+	return &Scheduler{
+		C:       c,
+		c:       c,
+		rate:    math.Float64bits(rate),
+		arrival: arrival,
+		rnd:     rand.New(rand.NewSource(seed)),
+	}
+}
+
+// paused scheduler polls rate with this period
+const pause = 10 * time.Millisecond
+
+func (s *Scheduler) Rate() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&s.rate))
+}
+
+// SetRate changes rate of running scheduler
+func (s *Scheduler) SetRate(rate float64) {
+	atomic.StoreUint64(&s.rate, math.Float64bits(rate))
+}
+
+// Run blocks until ctx is done
+func (s *Scheduler) Run(ctx context.Context) {
+	last, u := time.Now(), s.unit()
+
+	for {
+		rate := s.Rate()
+		if rate <= 0 {
+			// paused, schedule resumes from the moment rate becomes positive
+			last = time.Now()
+			if !sleep(ctx, pause) {
+				return
+			}
+
+			continue
+		}
+
+		next := last.Add(time.Duration(u * float64(time.Second) / rate))
+		if d := time.Until(next); d > 0 {
+			// wake up at least every pause to follow rate changes
+			if d > pause {
+				d = pause
+			}
+
+			if !sleep(ctx, d) {
+				return
+			}
+
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case s.c <- next:
+		default:
+			// threads are behind by the whole backlog, waiting would turn run into closed loop
+			if atomic.AddUint64(&s.dropped, 1) == 1 {
+				log.Printf("open-loop: backlog of %d arrivals is full, arrivals are dropped", backlog)
+			}
+		}
+
+		last, u = next, s.unit()
+	}
+}
+
+// Dropped returns number of arrivals which found backlog full
+func (s *Scheduler) Dropped() uint64 {
+	return atomic.LoadUint64(&s.dropped)
+}
+
+// unit gap between arrivals in 1/rate units
+func (s *Scheduler) unit() float64 {
+	if s.arrival == Poisson {
+		return s.rnd.ExpFloat64()
+	}
+
+	return 1
+}
+
+func sleep(ctx context.Context, d time.Duration) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(d):
+		return true
+	}
+}
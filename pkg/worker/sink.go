@@ -0,0 +1,75 @@
+package worker
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Sample is statistics of single report interval
+type Sample struct {
+	Time    time.Time
+	Elapsed time.Duration
+	Stage   string
+	Warmup  bool
+	Threads int64
+
+	// Ops, Failed and Rejected happened during interval, Total is cumulative number of successful operations
+	Ops        uint64
+	Failed     uint64
+	Rejected   uint64
+	Total      uint64
+	Throughput float64
+	Latency    Latency
+	Errors     Errors
+	// Retries made inside operations during interval
+	Retries uint64
+}
+
+// Sink receives results of run: sample of every report interval and final summary
+type Sink interface {
+	Sample(Sample)
+	Finish(Summary) error
+}
+
+type sinksKey struct{}
+
+// ContextWithSink adds sink to every worker run with ctx, so caller could collect results of code it doesn't own
+func ContextWithSink(ctx context.Context, sink Sink) context.Context {
+	return context.WithValue(ctx, sinksKey{}, append(sinksFrom(ctx), sink))
+}
+
+func sinksFrom(ctx context.Context) []Sink {
+	sinks, _ := ctx.Value(sinksKey{}).([]Sink)
+
+	return sinks[:len(sinks):len(sinks)]
+}
+
+// Collector keeps summaries of all runs it was sink of
+type Collector struct {
+	mu        sync.Mutex
+	summaries []Summary
+}
+
+func (c *Collector) Sample(Sample) {}
+
+func (c *Collector) Finish(s Summary) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.summaries = append(c.summaries, s)
+
+	return nil
+}
+
+// Merged returns summary of all runs, see Merge
+func (c *Collector) Merged() Summary {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.summaries) == 1 {
+		return c.summaries[0]
+	}
+
+	return Merge(c.summaries...)
+}
@@ -0,0 +1,221 @@
+package worker
+
+import (
+	"fmt"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/d7561985/mongo-ab/pkg/histogram"
+)
+
+// Latency percentiles of some period
+type Latency struct {
+	Mean time.Duration
+	P50  time.Duration
+	P90  time.Duration
+	P99  time.Duration
+	P999 time.Duration
+	Max  time.Duration
+}
+
+func NewLatency(h *histogram.Histogram) Latency {
+	return Latency{
+		Mean: h.Mean(),
+		P50:  h.Percentile(50),
+		P90:  h.Percentile(90),
+		P99:  h.Percentile(99),
+		P999: h.Percentile(99.9),
+		Max:  h.Max(),
+	}
+}
+
+func (l Latency) String() string {
+	return fmt.Sprintf("p50: %v p90: %v p99: %v p99.9: %v max: %v",
+		round(l.P50), round(l.P90), round(l.P99), round(l.P999), round(l.Max))
+}
+
+type Summary struct {
+	Duration time.Duration
+	// Ops successful operations, only they are counted in throughput and latency
+	Ops    uint64
+	Failed uint64
+	// Rejected operations which business rule refused, e.g. insufficient funds, they are not failures
+	Rejected   uint64
+	Throughput float64
+	Latency    Latency
+	Errors     Errors
+	// Retries made inside operations, e.g. of store transactions under contention
+	Retries uint64
+	// Dropped arrivals of open-loop run which found backlog full, their operations were never made
+	Dropped uint64
+
+	// Histogram latency is calculated from, it allows to merge summaries of several runs
+	Histogram *histogram.Histogram
+
+	// Warmup which preceded measurement
+	Warmup Warmup
+
+	// Stages of load profile if any
+	Stages []StageSummary
+}
+
+type StageSummary struct {
+	Stage Stage
+	Summary
+}
+
+func (s StageSummary) String() string {
+	return fmt.Sprintf("stage %s finished | comb/sec: %.2f ops: %d errors: %d | %s",
+		s.Stage, s.Throughput, s.Ops, s.Failed, s.Latency)
+}
+
+func (s Summary) String() string {
+	b := &strings.Builder{}
+
+	fmt.Fprintln(b, "==== summary ====")
+	if s.Warmup.Duration > 0 && (s.Warmup.Ops > 0 || s.Warmup.Failed > 0) {
+		fmt.Fprintf(b, "warm-up:   %s\n", s.Warmup)
+	}
+	fmt.Fprintf(b, "duration:  %v\n", s.Duration.Round(time.Millisecond))
+	fmt.Fprintf(b, "ops:       %d\n", s.Ops)
+	fmt.Fprintf(b, "errors:    %s\n", s.Errors)
+	if s.Rejected > 0 {
+		fmt.Fprintf(b, "rejected:  %d\n", s.Rejected)
+	}
+	if s.Retries > 0 {
+		fmt.Fprintf(b, "retries:   %d (%.3f per op)\n", s.Retries, s.RetriesPerOp())
+	}
+	if s.Dropped > 0 {
+		fmt.Fprintf(b, "dropped:   %d arrivals over backlog\n", s.Dropped)
+	}
+	fmt.Fprintf(b, "comb/sec:  %.2f\n", s.Throughput)
+	fmt.Fprintf(b, "mean:      %v\n", round(s.Latency.Mean))
+	fmt.Fprintf(b, "p50:       %v\n", round(s.Latency.P50))
+	fmt.Fprintf(b, "p90:       %v\n", round(s.Latency.P90))
+	fmt.Fprintf(b, "p99:       %v\n", round(s.Latency.P99))
+	fmt.Fprintf(b, "p99.9:     %v\n", round(s.Latency.P999))
+	fmt.Fprintf(b, "max:       %v", round(s.Latency.Max))
+
+	if len(s.Stages) == 0 {
+		return b.String()
+	}
+
+	fmt.Fprintln(b, "\n==== stages ====")
+
+	w := tabwriter.NewWriter(b, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "stage\tduration\ttarget\tops\terrors\tcomb/sec\tp50\tp99\tp99.9\tmax")
+
+	for _, st := range s.Stages {
+		fmt.Fprintf(w, "%s\t%v\t%s\t%d\t%d\t%.2f\t%v\t%v\t%v\t%v\n",
+			st.Stage.Name, st.Duration.Round(time.Second), target(st.Stage), st.Ops, st.Failed, st.Throughput,
+			round(st.Latency.P50), round(st.Latency.P99), round(st.Latency.P999), round(st.Latency.Max))
+	}
+
+	_ = w.Flush()
+
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// RetriesPerOp is average number of retries per successful operation
+func (s Summary) RetriesPerOp() float64 {
+	if s.Ops == 0 {
+		return 0
+	}
+
+	return float64(s.Retries) / float64(s.Ops)
+}
+
+// Merge summaries of runs made at the same time, e.g. by several hosts.
+// Throughput is summed up, latency is taken from merged histograms.
+// Stages are merged by position when all runs have the same profile.
+func Merge(in ...Summary) Summary {
+	out := Summary{Errors: make(Errors), Histogram: histogram.New()}
+
+	for _, s := range in {
+		out.Ops += s.Ops
+		out.Failed += s.Failed
+		out.Rejected += s.Rejected
+		out.Retries += s.Retries
+		out.Dropped += s.Dropped
+		out.Throughput += s.Throughput
+		out.Errors = out.Errors.Add(s.Errors)
+
+		if s.Duration > out.Duration {
+			out.Duration = s.Duration
+		}
+
+		if s.Warmup.Duration > out.Warmup.Duration {
+			out.Warmup.Duration = s.Warmup.Duration
+		}
+
+		out.Warmup.Ops += s.Warmup.Ops
+		out.Warmup.Failed += s.Warmup.Failed
+
+		if s.Histogram != nil {
+			out.Histogram.Merge(s.Histogram)
+		}
+	}
+
+	out.Latency = NewLatency(out.Histogram)
+	out.Stages = mergeStages(in)
+
+	return out
+}
+
+func mergeStages(in []Summary) []StageSummary {
+	if len(in) == 0 || len(in[0].Stages) == 0 {
+		return nil
+	}
+
+	for _, s := range in {
+		if len(s.Stages) != len(in[0].Stages) {
+			return nil
+		}
+	}
+
+	out := make([]StageSummary, len(in[0].Stages))
+	for i := range out {
+		list := make([]Summary, 0, len(in))
+		for _, s := range in {
+			list = append(list, s.Stages[i].Summary)
+		}
+
+		out[i] = StageSummary{Stage: in[0].Stages[i].Stage, Summary: Merge(list...)}
+	}
+
+	return out
+}
+
+func throughput(ops uint64, d time.Duration) float64 {
+	if d <= 0 {
+		return 0
+	}
+
+	return float64(ops) / d.Seconds()
+}
+
+func target(s Stage) string {
+	unit := ""
+	if s.Rate {
+		unit = rateSuffix
+	}
+
+	if s.From == s.To {
+		return fmt.Sprintf("%g%s", s.To, unit)
+	}
+
+	return fmt.Sprintf("%g-%g%s", s.From, s.To, unit)
+}
+
+// round keeps 3 significant digits which is histogram precision anyway
+func round(d time.Duration) time.Duration {
+	switch {
+	case d >= time.Second:
+		return d.Round(time.Millisecond)
+	case d >= time.Millisecond:
+		return d.Round(time.Microsecond)
+	default:
+		return d
+	}
+}
@@ -0,0 +1,100 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/d7561985/mongo-ab/pkg/errclass"
+)
+
+// Warmup phase of run: load is applied as usual but operations are left out of statistics
+type Warmup struct {
+	Duration time.Duration
+	Ops      uint64
+	Failed   uint64
+}
+
+func (w Warmup) String() string {
+	return fmt.Sprintf("%v, %d ops and %d errors excluded", w.Duration.Round(time.Millisecond), w.Ops, w.Failed)
+}
+
+func (s *services) startWarmup(ctx context.Context) {
+	if s.cfg.Warmup <= 0 && s.cfg.WarmupOps == 0 {
+		s.finishWarmup()
+		return
+	}
+
+	atomic.StoreInt32(&s.warm, 1)
+	s.cfg.Metrics.SetWarmup(true)
+	log.Printf("warm-up: %v or %d ops, whichever comes first", s.cfg.Warmup, s.cfg.WarmupOps)
+
+	if s.cfg.Warmup > 0 {
+		go func() {
+			if sleep(ctx, s.cfg.Warmup) {
+				s.finishWarmup()
+			}
+		}()
+	}
+}
+
+func (s *services) warming() bool {
+	return atomic.LoadInt32(&s.warm) == 1
+}
+
+// warmed counts operation made during warm-up, metrics don't skip it
+func (s *services) warmed(op string, d time.Duration, err error) {
+	if err != nil {
+		class := errclass.Of(err)
+		if class.Rejection() {
+			s.cfg.Metrics.Reject(op)
+			return
+		}
+
+		atomic.AddUint64(&s.warmFailed, 1)
+		s.cfg.Metrics.Fail(op, string(class))
+		return
+	}
+
+	s.cfg.Metrics.Observe(op, d)
+
+	if n := atomic.AddUint64(&s.warmOps, 1); s.cfg.WarmupOps > 0 && n >= s.cfg.WarmupOps {
+		s.finishWarmup()
+	}
+}
+
+// finishWarmup starts measurement
+func (s *services) finishWarmup() {
+	s.warmOnce.Do(func() {
+		now := time.Now()
+
+		s.warmup = Warmup{
+			Duration: now.Sub(s.start),
+			Ops:      atomic.LoadUint64(&s.warmOps),
+			Failed:   atomic.LoadUint64(&s.warmFailed),
+		}
+
+		s.retryBase = s.retries()
+		s.dropBase = s.dropped()
+		atomic.StoreInt64(&s.begin, now.UnixNano())
+		atomic.StoreInt32(&s.warm, 0)
+		s.cfg.Metrics.SetWarmup(false)
+		close(s.warmDone)
+
+		if s.warmup.Ops > 0 || s.warmup.Failed > 0 {
+			fmt.Printf("==== warm-up finished: %s ====\n", s.warmup)
+		}
+	})
+}
+
+// measured returns duration of measurement, zero while warming up
+func (s *services) measured() time.Duration {
+	select {
+	case <-s.warmDone:
+		return time.Since(time.Unix(0, atomic.LoadInt64(&s.begin)))
+	default:
+		return 0
+	}
+}
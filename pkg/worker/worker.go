@@ -4,17 +4,60 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"math"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/d7561985/mongo-ab/pkg/errclass"
+	"github.com/d7561985/mongo-ab/pkg/histogram"
+	"github.com/d7561985/mongo-ab/pkg/metrics"
 	"github.com/pkg/errors"
 )
 
 const (
-	Threads = 30
+	Threads   = 30
+	Interval  = time.Second
+	Operation = "op"
 )
 
 type Config struct {
 	Threads int
+
+	// Rate of operations per second for all threads together.
+	// Zero means closed-loop: every thread calls fn again as soon as previous call returns.
+	Rate    float64
+	Arrival Arrival
+	// Seed of Poisson arrivals, the same seed gives the same schedule, zero is random
+	Seed int64
+
+	// Iterations limits operations per thread, zero is unlimited
+	Iterations int
+
+	// Interval between progress reports
+	Interval time.Duration
+
+	// Profile of stages, run stops after the last stage.
+	// Thread stages resize active threads, rate stages drive open-loop rate.
+	Profile Profile
+
+	// Budget of failed operations, run is aborted when exhausted
+	Budget ErrorBudget
+
+	// Warmup duration or number of operations which are left out of statistics,
+	// whichever comes first. Load profile starts after warm-up.
+	Warmup    time.Duration
+	WarmupOps uint64
+
+	// Sinks receive every interval sample and final summary
+	Sinks []Sink
+
+	// Metrics are updated live, warm-up included. Operation is type of operations made by Run.
+	Metrics   *metrics.Metrics
+	Operation string
+
+	// Retries is cumulative number of retries made inside operations, e.g. of store transactions
+	Retries func() uint64
 }
 
 func (c Config) GetWithDefault() *Config {
@@ -22,51 +65,300 @@ func (c Config) GetWithDefault() *Config {
 		c.Threads = Threads
 	}
 
+	if c.Arrival == "" {
+		c.Arrival = Fixed
+	}
+
+	if c.Interval == 0 {
+		c.Interval = Interval
+	}
+
+	if c.Operation == "" {
+		c.Operation = Operation
+	}
+
+	c.Threads = c.Profile.Threads(c.Threads)
+
 	return &c
 }
 
 func New(cfg *Config) *services {
 	c := cfg.GetWithDefault()
 
-	return &services{cfg: c, ch: make(chan struct{}, c.Threads)}
+	hist := make([]*histogram.Histogram, c.Threads)
+	for i := range hist {
+		hist[i] = histogram.New()
+	}
+
+	s := &services{
+		cfg:      c,
+		ch:       make(chan struct{}, c.Threads),
+		hist:     hist,
+		errs:     newErrorCounter(),
+		active:   int64(c.Threads),
+		warmDone: make(chan struct{}),
+	}
+
+	// counter of retries could outlive run, e.g. trials of capacity search share store
+	s.retryBase = s.retries()
+
+	return s
 }
 
 type services struct {
 	cfg *Config
 
 	ch chan struct{}
+
+	// per thread latency, merged only for reports
+	hist  []*histogram.Histogram
+	start time.Time
+
+	errs *errorCounter
+	// successful operations, cheap to read on every error
+	done uint64
+
+	// threads with lower index are active, the rest wait for the load profile
+	active int64
+	stages []StageSummary
+	stage  atomic.Value
+
+	// warm-up state, begin is UnixNano of measurement start
+	warm       int32
+	warmOps    uint64
+	warmFailed uint64
+	warmOnce   sync.Once
+	warmDone   chan struct{}
+	warmup     Warmup
+	begin      int64
+
+	// retries made before measurement
+	retryBase uint64
+
+	// schedule of open-loop run, nil for closed-loop
+	sched *Scheduler
+	// arrivals dropped before measurement
+	dropBase uint64
+
+	// abort reason when error budget is exhausted
+	abortOnce sync.Once
+	err       error
+	cancel    context.CancelFunc
 }
 
+// Run the same fn in every thread until ctx is done or all iterations are made, its operations are of cfg Operation
 func (s *services) Run(ctx context.Context, fn func() error) {
-	counter := make([]uint, s.cfg.Threads)
+	s.RunThreads(ctx, func(int) Timed {
+		return Timed{Do: func(time.Time) (string, error) { return s.cfg.Operation, fn() }}
+	})
+}
+
+// Timed is operation stream of thread
+type Timed struct {
+	// Due waits for the next operation and returns its intended start, zero time is now.
+	// False means there are no more operations and thread exits. Nil Due has every operation due when it is picked.
+	Due func(ctx context.Context) (time.Time, bool)
+	// Do makes operation whose intended start is begin: schedule of open-loop run, Due or time it was picked.
+	// It reports type of operation, type is label of metrics.
+	Do func(begin time.Time) (string, error)
+}
+
+// RunThreads calls factory once per thread, so every thread could own its state. Latency counts from intended start.
+func (s *services) RunThreads(ctx context.Context, factory func(thread int) Timed) {
+	s.start = time.Now()
+	s.cfg.Sinks = append(s.cfg.Sinks, sinksFrom(ctx)...)
+	s.cfg.Metrics.SetThreads(atomic.LoadInt64(&s.active))
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	s.cancel = cancel
+
+	rate := s.cfg.Rate
+	if s.cfg.Profile.Rate() {
+		rate = s.cfg.Profile[0].From
+	}
+
+	var sched *Scheduler
+	if rate > 0 || s.cfg.Profile.Rate() {
+		sched = NewScheduler(rate, s.cfg.Arrival, s.cfg.Seed)
+		s.sched = sched
+		go sched.Run(ctx)
+
+		s.cfg.Metrics.SetRate(rate)
+		log.Printf("open-loop: %.2f op/sec, %s arrival", rate, s.cfg.Arrival)
+	}
+
+	// end of warm-up reads schedule
+	s.startWarmup(ctx)
+
+	driven := make(chan struct{})
+	if len(s.cfg.Profile) > 0 {
+		s.apply(s.cfg.Profile[0], 0, sched)
+		go func() {
+			defer close(driven)
+			s.drive(ctx, cancel, sched)
+		}()
+	} else {
+		close(driven)
+	}
+
+	wg := sync.WaitGroup{}
+	wg.Add(s.cfg.Threads)
 
 	for i := 0; i < s.cfg.Threads; i++ {
-		go s.work(ctx, i, &counter[i], fn)
+		go func(i int) {
+			defer wg.Done()
+			s.work(ctx, i, s.hist[i], sched, factory(i))
+		}(i)
+	}
+
+	go func() {
+		wg.Wait()
+		cancel()
+	}()
+
+	s.counter(ctx)
+	<-driven
+}
+
+// drive walks through profile stages and stops the run after the last one
+func (s *services) drive(ctx context.Context, cancel func(), sched *Scheduler) {
+	defer cancel()
+
+	select {
+	case <-ctx.Done():
+		return
+	case <-s.warmDone:
+	}
+
+	tick := time.NewTicker(100 * time.Millisecond)
+	defer tick.Stop()
+
+	for _, st := range s.cfg.Profile {
+		begin, prev, prevErrs, prevRetries := time.Now(), s.merge(), s.errs.snapshot(), s.retries()
+		s.stage.Store(st.Name)
+		log.Printf("stage %s", st)
+
+		for el := time.Duration(0); el < st.Duration; el = time.Since(begin) {
+			s.apply(st, el, sched)
+
+			select {
+			case <-ctx.Done():
+				s.finishStage(st, begin, prev, prevErrs, prevRetries)
+				return
+			case <-tick.C:
+			}
+		}
+
+		s.finishStage(st, begin, prev, prevErrs, prevRetries)
 	}
+}
 
-	s.counter(ctx, time.Now(), counter)
+func (s *services) apply(st Stage, elapsed time.Duration, sched *Scheduler) {
+	v := st.At(elapsed)
+
+	if st.Rate {
+		sched.SetRate(v)
+		s.cfg.Metrics.SetRate(v)
+		return
+	}
+
+	atomic.StoreInt64(&s.active, int64(math.Round(v)))
+	s.cfg.Metrics.SetThreads(int64(math.Round(v)))
+}
+
+func (s *services) finishStage(st Stage, begin time.Time, prev *histogram.Histogram, prevErrs Errors, prevRetries uint64) {
+	d := time.Since(begin)
+	h := s.merge().Sub(prev)
+	errs := s.errs.snapshot().Sub(prevErrs)
+
+	res := StageSummary{Stage: st, Summary: Summary{
+		Duration:   d,
+		Ops:        h.Count(),
+		Failed:     errs.Total(),
+		Rejected:   errs.Rejected(),
+		Throughput: throughput(h.Count(), d),
+		Latency:    NewLatency(h),
+		Errors:     errs,
+		Retries:    s.retries() - prevRetries,
+		Histogram:  h,
+	}}
+
+	s.stages = append(s.stages, res)
+	fmt.Println(res)
 }
 
-func (s *services) counter(ctx context.Context, start time.Time, counter []uint) {
+func (s *services) counter(ctx context.Context) {
+	prev := histogram.New()
+	prevErrs := make(Errors)
+	prevWarm := uint64(0)
+	prevRetries := s.retries()
+
 	for {
 		select {
 		case <-ctx.Done():
 			return
-		case <-time.After(time.Second):
-			ms := time.Since(start)
+		case <-time.After(s.cfg.Interval):
+			if s.warming() {
+				warm := atomic.LoadUint64(&s.warmOps)
+				s.sample(Sample{Warmup: true, Elapsed: time.Since(s.start), Ops: warm - prevWarm, Total: warm})
+				prevWarm = warm
+
+				prevRetries = s.retries()
+
+				fmt.Println("warm-up:", time.Since(s.start).Seconds(), "ops:", warm)
+				continue
+			}
+
+			ms := s.measured()
+
+			cur, errs, retries := s.merge(), s.errs.snapshot(), s.retries()
+			diff, diffErrs := cur.Sub(prev), errs.Sub(prevErrs)
+			l := NewLatency(diff)
+			failed, diffRetries := diffErrs.Total(), retries-prevRetries
+			prev, prevErrs, prevRetries = cur, errs, retries
 
-			var i uint
-			for _, v := range counter {
-				i += v
+			s.sample(Sample{
+				Elapsed:  ms,
+				Ops:      diff.Count(),
+				Failed:   failed,
+				Rejected: diffErrs.Rejected(),
+				Total:    cur.Count(),
+				Latency:  l,
+				Errors:   diffErrs,
+				Retries:  diffRetries,
+			})
+
+			q := float64(cur.Count()) / ms.Seconds()
+			if len(s.cfg.Profile) > 0 {
+				fmt.Println("comb/sec:", q, "duration:", ms.Seconds(), cur.Count(), "|", l, "| errors:", failed, "| threads:", atomic.LoadInt64(&s.active))
+				continue
 			}
 
-			q := float64(i) / ms.Seconds()
-			fmt.Println("comb/sec:", q, "duration:", ms.Seconds(), i)
+			fmt.Println("comb/sec:", q, "duration:", ms.Seconds(), cur.Count(), "|", l, "| errors:", failed)
 		}
 	}
 }
 
-func (s *services) work(ctx context.Context, i int, c *uint, fn func() error) {
+func (s *services) sample(in Sample) {
+	if len(s.cfg.Sinks) == 0 {
+		return
+	}
+
+	in.Time = time.Now()
+	in.Threads = atomic.LoadInt64(&s.active)
+	in.Throughput = throughput(in.Ops, s.cfg.Interval)
+	if st, ok := s.stage.Load().(string); ok {
+		in.Stage = st
+	}
+
+	for _, sink := range s.cfg.Sinks {
+		sink.Sample(in)
+	}
+}
+
+func (s *services) work(ctx context.Context, i int, h *histogram.Histogram, sched *Scheduler, fn Timed) {
 	log.Printf("[%d] worker start", i)
 
 	defer func() {
@@ -74,25 +366,180 @@ func (s *services) work(ctx context.Context, i int, c *uint, fn func() error) {
 		s.ch <- struct{}{}
 	}()
 
-	for {
-		select {
-		case <-ctx.Done():
-			return
-		default:
+	for n := 0; s.cfg.Iterations == 0 || n < s.cfg.Iterations; n++ {
+		// parked by load profile
+		for int64(i) >= atomic.LoadInt64(&s.active) {
+			if !sleep(ctx, pause) {
+				return
+			}
 		}
 
-		if err := fn(); err != nil {
-			log.Panicf("worker fn %+v", errors.WithStack(err))
+		begin := time.Now()
+
+		if sched != nil {
+			// open-loop: latency counts from intended start, so queueing is not hidden
+			select {
+			case <-ctx.Done():
+				return
+			case begin = <-sched.C:
+			}
+		} else {
+			select {
+			case <-ctx.Done():
+				return
+			default:
+			}
 		}
 
-		*c++
+		if fn.Due != nil {
+			due, ok := fn.Due(ctx)
+			if !ok {
+				return
+			}
+
+			if !due.IsZero() {
+				begin = due
+			}
+		}
+
+		warm := s.warming()
+
+		op, err := fn.Do(begin)
+		d := time.Since(begin)
+
+		if warm {
+			s.warmed(op, d, err)
+			continue
+		}
+
+		if err != nil {
+			s.fail(ctx, i, op, err)
+			continue
+		}
+
+		h.Record(d)
+		atomic.AddUint64(&s.done, 1)
+		s.cfg.Metrics.Observe(op, d)
 	}
 }
 
-func (s *services) Wait() {
+// fail counts error by class and aborts the run when error budget is exhausted
+func (s *services) fail(ctx context.Context, i int, op string, err error) {
+	class := errclass.Of(err)
+
+	// interrupted by shutdown or end of run, not a failure of database
+	if ctx.Err() != nil && (class == errclass.Canceled || errors.Is(err, context.DeadlineExceeded)) {
+		return
+	}
+
+	// refusal of business rule is expected outcome, it doesn't spend error budget
+	if class.Rejection() {
+		s.errs.add(class)
+		s.cfg.Metrics.Reject(op)
+		return
+	}
+
+	s.cfg.Metrics.Fail(op, string(class))
+
+	failed, first := s.errs.add(class)
+	if first {
+		log.Printf("[%d] first %s error: %+v", i, class, errors.WithStack(err))
+	}
+
+	reason := s.cfg.Budget.Exhausted(atomic.LoadUint64(&s.done), failed)
+	if reason == "" {
+		return
+	}
+
+	s.abortOnce.Do(func() {
+		s.err = fmt.Errorf("error budget exhausted: %s, last %s error: %w", reason, class, err)
+		log.Printf("abort: %v", s.err)
+		s.cancel()
+	})
+}
+
+// retries made so far, zero without Config.Retries
+func (s *services) retries() uint64 {
+	if s.cfg.Retries == nil {
+		return 0
+	}
+
+	return s.cfg.Retries()
+}
+
+// dropped arrivals of open-loop schedule
+func (s *services) dropped() uint64 {
+	if s.sched == nil {
+		return 0
+	}
+
+	return s.sched.Dropped()
+}
+
+// merge per thread histograms into single snapshot
+func (s *services) merge() *histogram.Histogram {
+	out := histogram.New()
+	for _, h := range s.hist {
+		out.Merge(h.Snapshot())
+	}
+
+	return out
+}
+
+// Summary of whole run, valid after Wait
+func (s *services) Summary() Summary {
+	h := s.merge()
+	d := s.measured()
+
+	errs := s.errs.snapshot()
+
+	warmup := Warmup{
+		Duration: time.Since(s.start),
+		Ops:      atomic.LoadUint64(&s.warmOps),
+		Failed:   atomic.LoadUint64(&s.warmFailed),
+	}
+	if d > 0 {
+		warmup = s.warmup
+	}
+
+	return Summary{
+		Duration:   d,
+		Ops:        h.Count(),
+		Failed:     errs.Total(),
+		Rejected:   errs.Rejected(),
+		Throughput: throughput(h.Count(), d),
+		Latency:    NewLatency(h),
+		Errors:     errs,
+		Retries:    s.retries() - s.retryBase,
+		Dropped:    s.dropped() - s.dropBase,
+		Histogram:  h,
+		Warmup:     warmup,
+		Stages:     s.stages,
+	}
+}
+
+// Wait for all threads and hand summary to sinks.
+// Error is returned when run was aborted by error budget or sink failed.
+func (s *services) Wait() error {
 	for i := 0; i < s.cfg.Threads; i++ {
 		<-s.ch
 	}
 
 	close(s.ch)
+
+	summary := s.Summary()
+	fmt.Println(summary)
+
+	var sinkErr error
+	for _, sink := range s.cfg.Sinks {
+		if err := sink.Finish(summary); err != nil && sinkErr == nil {
+			sinkErr = errors.WithStack(err)
+		}
+	}
+
+	if s.err != nil {
+		return s.err
+	}
+
+	return sinkErr
 }
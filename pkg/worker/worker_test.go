@@ -0,0 +1,214 @@
+package worker
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/d7561985/mongo-ab/pkg/errclass"
+	"github.com/d7561985/mongo-ab/pkg/store"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIterations(t *testing.T) {
+	var n int64
+
+	w := New(&Config{Threads: 4, Iterations: 25})
+	w.Run(context.Background(), func() error {
+		atomic.AddInt64(&n, 1)
+		return nil
+	})
+	require.NoError(t, w.Wait())
+
+	assert.EqualValues(t, 100, n)
+	assert.EqualValues(t, 100, w.Summary().Ops)
+}
+
+func TestOpenLoop(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	w := New(&Config{Threads: 2, Rate: 200})
+	w.Run(ctx, func() error {
+		// slower than schedule for single thread, so queueing must be visible
+		time.Sleep(20 * time.Millisecond)
+		return nil
+	})
+	require.NoError(t, w.Wait())
+
+	s := w.Summary()
+	assert.InDelta(t, 100, s.Ops, 10, "two threads with 20ms ops make 100 op/sec")
+	assert.Greater(t, s.Latency.Max, 100*time.Millisecond, "latency counts from intended start")
+}
+
+func TestSchedulerSeed(t *testing.T) {
+	a, b := NewScheduler(100, Poisson, 7), NewScheduler(100, Poisson, 7)
+	for i := 0; i < 100; i++ {
+		require.Equal(t, a.unit(), b.unit())
+	}
+
+	assert.NotEqual(t, a.unit(), NewScheduler(100, Poisson, 8).unit())
+}
+
+func TestSchedulerDrop(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	// nobody picks arrivals, schedule keeps its pace instead of waiting for backlog
+	s := NewScheduler(100_000, Fixed, 0)
+	s.Run(ctx)
+
+	assert.Len(t, s.C, backlog)
+	assert.Greater(t, s.Dropped(), uint64(backlog))
+}
+
+func TestProfile(t *testing.T) {
+	p, err := ParseProfile("soak:300ms:1,spike:300ms:4")
+	require.NoError(t, err)
+
+	w := New(&Config{Profile: p})
+	w.Run(context.Background(), func() error {
+		time.Sleep(10 * time.Millisecond)
+		return nil
+	})
+	require.NoError(t, w.Wait())
+
+	s := w.Summary()
+	require.Len(t, s.Stages, 2)
+	assert.InDelta(t, 100, s.Stages[0].Throughput, 20)
+	assert.InDelta(t, 400, s.Stages[1].Throughput, 80)
+}
+
+func TestErrorBudget(t *testing.T) {
+	var n int64
+
+	w := New(&Config{Threads: 2, Budget: ErrorBudget{MaxRate: 0.1}})
+	w.Run(context.Background(), func() error {
+		if atomic.AddInt64(&n, 1)%4 == 0 {
+			return context.DeadlineExceeded
+		}
+
+		return nil
+	})
+
+	err := w.Wait()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "error budget exhausted")
+
+	s := w.Summary()
+	assert.Greater(t, s.Errors[errclass.Timeout], uint64(0))
+	assert.Equal(t, s.Failed, s.Errors.Total())
+}
+
+func TestEndOfRun(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	// operations in flight are interrupted by deadline of run, they are not failures
+	w := New(&Config{Threads: 2, Budget: ErrorBudget{MaxErrors: 1}})
+	w.Run(ctx, func() error {
+		<-ctx.Done()
+		return errors.WithStack(ctx.Err())
+	})
+	require.NoError(t, w.Wait())
+
+	assert.Zero(t, w.Summary().Failed)
+}
+
+func TestRejections(t *testing.T) {
+	var n int64
+
+	// every other operation is refused, budget is about failures only
+	w := New(&Config{Threads: 2, Iterations: 100, Budget: ErrorBudget{MaxErrors: 1}})
+	w.Run(context.Background(), func() error {
+		if atomic.AddInt64(&n, 1)%2 == 0 {
+			return errors.WithStack(store.ErrInsufficientFunds)
+		}
+
+		return nil
+	})
+	require.NoError(t, w.Wait())
+
+	s := w.Summary()
+	assert.EqualValues(t, 200, s.Ops+s.Rejected, "iterations are per thread")
+	assert.EqualValues(t, 100, s.Rejected)
+	assert.Zero(t, s.Failed)
+	assert.Equal(t, "0", s.Errors.String())
+	assert.Contains(t, s.String(), "rejected:  100")
+}
+
+func TestRevertRace(t *testing.T) {
+	// lost race of concurrent reverts doesn't abort run
+	w := New(&Config{Threads: 2, Iterations: 100, Budget: ErrorBudget{MaxErrors: 1}})
+	w.Run(context.Background(), func() error {
+		return errors.WithStack(store.ErrReverted)
+	})
+	require.NoError(t, w.Wait())
+
+	s := w.Summary()
+	assert.EqualValues(t, 200, s.Rejected)
+	assert.EqualValues(t, 200, s.Errors[errclass.Reverted])
+	assert.Zero(t, s.Failed)
+}
+
+func TestWarmup(t *testing.T) {
+	w := New(&Config{Threads: 1, Iterations: 100, WarmupOps: 30})
+	w.Run(context.Background(), func() error { return nil })
+	require.NoError(t, w.Wait())
+
+	s := w.Summary()
+	assert.EqualValues(t, 70, s.Ops)
+	assert.EqualValues(t, 30, s.Warmup.Ops)
+	assert.Greater(t, s.Duration, time.Duration(0))
+}
+
+func TestRetries(t *testing.T) {
+	// retries of previous run and of warm-up are excluded
+	retries := uint64(7)
+
+	w := New(&Config{Threads: 1, Iterations: 100, WarmupOps: 30, Retries: func() uint64 { return atomic.LoadUint64(&retries) }})
+	w.Run(context.Background(), func() error {
+		atomic.AddUint64(&retries, 1)
+		return nil
+	})
+	require.NoError(t, w.Wait())
+
+	s := w.Summary()
+	assert.EqualValues(t, 70, s.Retries)
+	assert.Equal(t, 1.0, s.RetriesPerOp())
+	assert.Contains(t, s.String(), "retries:   70")
+}
+
+type testSink struct {
+	samples []Sample
+	summary *Summary
+}
+
+func (t *testSink) Sample(s Sample) { t.samples = append(t.samples, s) }
+
+func (t *testSink) Finish(s Summary) error {
+	t.summary = &s
+	return nil
+}
+
+func TestSinks(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 350*time.Millisecond)
+	defer cancel()
+
+	sink := new(testSink)
+
+	w := New(&Config{Threads: 1, Interval: 100 * time.Millisecond, Sinks: []Sink{sink}})
+	w.Run(ctx, func() error {
+		time.Sleep(time.Millisecond)
+		return nil
+	})
+	require.NoError(t, w.Wait())
+
+	require.NotNil(t, sink.summary)
+	require.NotEmpty(t, sink.samples)
+	assert.Greater(t, sink.samples[0].Ops, uint64(0))
+	assert.Equal(t, w.Summary().Ops, sink.summary.Ops)
+}
@@ -0,0 +1,312 @@
+package workload
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/d7561985/mongo-ab/pkg/changing"
+	"gopkg.in/yaml.v3"
+)
+
+// File is workload description, YAML or JSON:
+//
+//	name: casino
+//	accounts: zipfian:0.99
+//	operations:
+//	  - name: deposit
+//	    kind: tx
+//	    weight: 40
+//	    amount: uniform:10:1000
+//	    type: deposit
+//	    transactionType: Add Deposit
+//	    project: casino
+//
+// Kind is operation of command which runs the file, e.g. tx and insert for mongo and postgres.
+type File struct {
+	Name string `yaml:"name"`
+	// Accounts is key distribution of account selection, see keys.Parse
+	Accounts   string      `yaml:"accounts"`
+	Operations []Operation `yaml:"operations"`
+}
+
+type Operation struct {
+	Name   string  `yaml:"name"`
+	Kind   string  `yaml:"kind"`
+	Weight float64 `yaml:"weight"`
+	// Amount distribution: 100, const:100, uniform:min:max, normal:mean:stddev, exponential:mean
+	Amount          string `yaml:"amount"`
+	Type            string `yaml:"type"`
+	TransactionType string `yaml:"transactionType"`
+	Project         string `yaml:"project"`
+}
+
+// Mix is loaded workload which picks operations by weight
+type Mix struct {
+	File
+	amounts []Amount
+	// cumulative weights
+	bounds []float64
+}
+
+// Load reads workload file. Kinds are operations supported by command, operation without kind gets the first one.
+func Load(path string, kinds ...string) (*Mix, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read workload: %w", err)
+	}
+
+	return Parse(data, kinds...)
+}
+
+// Parse is Load of file content, JSON is accepted as YAML subset
+func Parse(data []byte, kinds ...string) (*Mix, error) {
+	var f File
+
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+
+	if err := dec.Decode(&f); err != nil {
+		return nil, fmt.Errorf("parse workload: %w", err)
+	}
+
+	return f.Compile(kinds...)
+}
+
+// Compile validates file and prepares it for generation
+func (f File) Compile(kinds ...string) (*Mix, error) {
+	if len(f.Operations) == 0 {
+		return nil, fmt.Errorf("workload %q has no operations", f.Name)
+	}
+
+	m := &Mix{File: f}
+	m.Operations = append([]Operation(nil), f.Operations...)
+
+	names := map[string]bool{}
+	total := 0.0
+
+	for i := range m.Operations {
+		op := &m.Operations[i]
+
+		if op.Name == "" {
+			return nil, fmt.Errorf("workload operation #%d has no name", i+1)
+		}
+
+		if names[op.Name] {
+			return nil, fmt.Errorf("workload operation %q is duplicated", op.Name)
+		}
+
+		names[op.Name] = true
+
+		if op.Weight <= 0 {
+			return nil, fmt.Errorf("workload operation %q: weight must be positive", op.Name)
+		}
+
+		if op.Kind == "" && len(kinds) > 0 {
+			op.Kind = kinds[0]
+		}
+
+		if len(kinds) > 0 && !contains(kinds, op.Kind) {
+			return nil, fmt.Errorf("workload operation %q: unsupported kind %q, use %s", op.Name, op.Kind, strings.Join(kinds, ", "))
+		}
+
+		a, err := ParseAmount(op.Amount)
+		if err != nil {
+			return nil, fmt.Errorf("workload operation %q: %w", op.Name, err)
+		}
+
+		total += op.Weight
+		m.amounts = append(m.amounts, a)
+		m.bounds = append(m.bounds, total)
+	}
+
+	return m, nil
+}
+
+// Single is workload of the only operation kind, e.g. operation flag of command
+func Single(kind string, kinds ...string) (*Mix, error) {
+	return File{Name: kind, Operations: []Operation{{Name: kind, Kind: kind, Weight: 1}}}.Compile(kinds...)
+}
+
+// ParseMix is workload of operation kinds with weights, e.g. tx:80,balance:15,journal:5
+func ParseMix(in string, kinds ...string) (*Mix, error) {
+	f := File{Name: in}
+
+	for _, part := range strings.Split(in, ",") {
+		kv := strings.Split(strings.TrimSpace(part), ":")
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("mix %q: want kind:weight, got %q", in, part)
+		}
+
+		w, err := strconv.ParseFloat(kv[1], 64)
+		if err != nil {
+			return nil, fmt.Errorf("mix %q: bad weight %q", in, kv[1])
+		}
+
+		f.Operations = append(f.Operations, Operation{Name: kv[0], Kind: kv[0], Weight: w})
+	}
+
+	return f.Compile(kinds...)
+}
+
+// String lists operations with their share
+func (m *Mix) String() string {
+	total := m.bounds[len(m.bounds)-1]
+
+	parts := make([]string, 0, len(m.Operations))
+	for i, op := range m.Operations {
+		parts = append(parts, fmt.Sprintf("%s %.1f%% %s(%s)", op.Name, op.Weight/total*100, op.Kind, m.amounts[i]))
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+// Op is single generated operation
+type Op struct {
+	*Operation
+	Amount float64
+}
+
+// Apply sets fields of operation which are described in file
+func (o Op) Apply(tx *changing.Transaction) {
+	if o.Type != "" {
+		tx.Type = o.Type
+	}
+
+	if o.TransactionType != "" {
+		tx.TransactionType = o.TransactionType
+	}
+
+	if o.Project != "" {
+		tx.Project = o.Project
+	}
+}
+
+// Stream generates operations of single thread
+type Stream struct {
+	m *Mix
+	r *rand.Rand
+}
+
+func (m *Mix) Stream(r *rand.Rand) *Stream {
+	return &Stream{m: m, r: r}
+}
+
+func (s *Stream) Next() Op {
+	// the only operation takes nothing from stream, so that seeds of single operation runs are kept
+	if len(s.m.bounds) == 1 {
+		return Op{Operation: &s.m.Operations[0], Amount: s.m.amounts[0].Draw(s.r)}
+	}
+
+	p := s.r.Float64() * s.m.bounds[len(s.m.bounds)-1]
+	i := sort.SearchFloat64s(s.m.bounds, p)
+
+	// p == bound belongs to the next operation
+	if i < len(s.m.bounds)-1 && s.m.bounds[i] == p {
+		i++
+	}
+
+	return Op{Operation: &s.m.Operations[i], Amount: s.m.amounts[i].Draw(s.r)}
+}
+
+const (
+	Const       = "const"
+	Uniform     = "uniform"
+	Normal      = "normal"
+	Exponential = "exponential"
+)
+
+// defAmount keeps amount of operations without workload file
+const defAmount = 100
+
+// Amount is distribution of operation amount
+type Amount struct {
+	Kind string
+	A, B float64
+}
+
+// ParseAmount parses amount spec, empty one is const 100
+func ParseAmount(in string) (Amount, error) {
+	if in == "" {
+		return Amount{Kind: Const, A: defAmount}, nil
+	}
+
+	if v, err := strconv.ParseFloat(in, 64); err == nil {
+		return Amount{Kind: Const, A: v}, nil
+	}
+
+	parts := strings.Split(in, ":")
+	args := make([]float64, 0, len(parts)-1)
+
+	for _, p := range parts[1:] {
+		v, err := strconv.ParseFloat(p, 64)
+		if err != nil {
+			return Amount{}, fmt.Errorf("amount %q: bad number %q", in, p)
+		}
+
+		args = append(args, v)
+	}
+
+	want := map[string]int{Const: 1, Uniform: 2, Normal: 2, Exponential: 1}
+
+	n, ok := want[parts[0]]
+	if !ok {
+		return Amount{}, fmt.Errorf("amount %q: unknown distribution, use const, uniform, normal, exponential", in)
+	}
+
+	if len(args) != n {
+		return Amount{}, fmt.Errorf("amount %q: %s needs %d arguments", in, parts[0], n)
+	}
+
+	a := Amount{Kind: parts[0], A: args[0]}
+	if n == 2 {
+		a.B = args[1]
+	}
+
+	if a.Kind == Uniform && a.B < a.A {
+		return Amount{}, fmt.Errorf("amount %q: max is less than min", in)
+	}
+
+	if a.Kind == Normal && a.B < 0 {
+		return Amount{}, fmt.Errorf("amount %q: negative stddev", in)
+	}
+
+	return a, nil
+}
+
+// Draw returns next amount. Exponential with negative mean gives negative amounts.
+func (a Amount) Draw(r *rand.Rand) float64 {
+	switch a.Kind {
+	case Uniform:
+		return a.A + r.Float64()*(a.B-a.A)
+	case Normal:
+		return a.A + r.NormFloat64()*a.B
+	case Exponential:
+		return r.ExpFloat64() * a.A
+	default:
+		return a.A
+	}
+}
+
+func (a Amount) String() string {
+	switch a.Kind {
+	case Uniform, Normal:
+		return fmt.Sprintf("%s:%g:%g", a.Kind, a.A, a.B)
+	default:
+		return fmt.Sprintf("%s:%g", a.Kind, a.A)
+	}
+}
+
+func contains(in []string, s string) bool {
+	for _, v := range in {
+		if v == s {
+			return true
+		}
+	}
+
+	return false
+}
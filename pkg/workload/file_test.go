@@ -0,0 +1,152 @@
+package workload
+
+import (
+	"testing"
+
+	"github.com/d7561985/mongo-ab/pkg/changing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	yml := `
+name: test
+accounts: hotspot:90:10
+operations:
+  - name: deposit
+    weight: 3
+    amount: uniform:10:20
+    type: deposit
+    transactionType: Add Deposit
+    project: casino
+  - name: audit
+    kind: insert
+    weight: 1
+`
+	json := `{"name": "test", "accounts": "hotspot:90:10", "operations": [
+		{"name": "deposit", "weight": 3, "amount": "uniform:10:20", "type": "deposit", "transactionType": "Add Deposit", "project": "casino"},
+		{"name": "audit", "kind": "insert", "weight": 1}]}`
+
+	for _, in := range []string{yml, json} {
+		m, err := Parse([]byte(in), "tx", "insert")
+		require.NoError(t, err)
+
+		assert.Equal(t, "hotspot:90:10", m.Accounts)
+		assert.Equal(t, "tx", m.Operations[0].Kind)
+		assert.Equal(t, "deposit 75.0% tx(uniform:10:20), audit 25.0% insert(const:100)", m.String())
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := map[string]string{
+		"empty":     `name: x`,
+		"no name":   `operations: [{weight: 1}]`,
+		"duplicate": `operations: [{name: a, weight: 1}, {name: a, weight: 1}]`,
+		"weight":    `operations: [{name: a}]`,
+		"kind":      `operations: [{name: a, kind: delete, weight: 1}]`,
+		"amount":    `operations: [{name: a, weight: 1, amount: "uniform:5"}]`,
+		"unknown":   `operations: [{name: a, weight: 1, ratio: 2}]`,
+	}
+
+	for name, in := range tests {
+		_, err := Parse([]byte(in), "tx", "insert")
+		assert.Error(t, err, name)
+	}
+}
+
+func TestParseAmount(t *testing.T) {
+	tests := map[string]Amount{
+		"":                 {Kind: Const, A: 100},
+		"-5":               {Kind: Const, A: -5},
+		"const:7":          {Kind: Const, A: 7},
+		"uniform:-500:-10": {Kind: Uniform, A: -500, B: -10},
+		"normal:40:15":     {Kind: Normal, A: 40, B: 15},
+		"exponential:200":  {Kind: Exponential, A: 200},
+	}
+
+	for in, want := range tests {
+		a, err := ParseAmount(in)
+		require.NoError(t, err, in)
+		assert.Equal(t, want, a, in)
+	}
+
+	for _, in := range []string{"uniform:10:1", "normal:1:-1", "pareto:1", "const:x", "const:1:2"} {
+		_, err := ParseAmount(in)
+		assert.Error(t, err, in)
+	}
+}
+
+func TestStream(t *testing.T) {
+	m, err := File{Operations: []Operation{
+		{Name: "a", Weight: 3, Amount: "uniform:10:20"},
+		{Name: "b", Weight: 1, Amount: "1", Project: "p"},
+	}}.Compile()
+	require.NoError(t, err)
+
+	s, same := m.Stream(Rand(1, 0)), m.Stream(Rand(1, 0))
+	counts := map[string]int{}
+
+	const n = 100_000
+	for i := 0; i < n; i++ {
+		op := s.Next()
+		assert.Equal(t, op, same.Next())
+
+		counts[op.Name]++
+
+		if op.Name == "a" {
+			assert.True(t, op.Amount >= 10 && op.Amount < 20, op.Amount)
+		}
+	}
+
+	assert.InDelta(t, 0.75, float64(counts["a"])/n, 0.01)
+
+	tx := changing.Transaction{}
+	Op{Operation: &m.Operations[1]}.Apply(&tx)
+	assert.Equal(t, "p", tx.Project)
+}
+
+func TestSingle(t *testing.T) {
+	m, err := Single("tx", "tx", "insert")
+	require.NoError(t, err)
+
+	// the only operation keeps stream of transactions untouched
+	r, ref := Rand(1, 0), Rand(1, 0)
+	op := m.Stream(r).Next()
+
+	assert.Equal(t, "tx", op.Name)
+	assert.EqualValues(t, 100, op.Amount)
+	assert.Equal(t, ref.Int63(), r.Int63())
+
+	_, err = Single("delete", "tx", "insert")
+	assert.Error(t, err)
+}
+
+func TestParseMix(t *testing.T) {
+	m, err := ParseMix("tx:80, balance:15,journal:5", "tx", "balance", "journal")
+	require.NoError(t, err)
+	require.Len(t, m.Operations, 3)
+	assert.Equal(t, Operation{Name: "balance", Kind: "balance", Weight: 15}, m.Operations[1])
+
+	for _, in := range []string{"tx", "tx:a", "tx:0", "tx:1,tx:1", "delete:1"} {
+		_, err = ParseMix(in, "tx", "balance", "journal")
+		assert.Error(t, err, in)
+	}
+}
+
+func TestExamples(t *testing.T) {
+	_, err := Load("../../data/workload/casino.yaml", "tx", "insert")
+	assert.NoError(t, err)
+
+	_, err = Load("../../data/workload/wallet.yaml", "tx", "insert", "balance", "journal")
+	assert.NoError(t, err)
+
+	m, err := Load("../../data/workload/production.yaml", "debit", "credit", "transfer", "zero", "squash")
+	require.NoError(t, err)
+
+	var total float64
+	for _, op := range m.Operations {
+		total += op.Weight
+	}
+
+	assert.InDelta(t, 100, total, 1e-9)
+}
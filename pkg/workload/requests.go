@@ -0,0 +1,226 @@
+package workload
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/d7561985/mongo-ab/pkg/agregate/transaction"
+	"github.com/d7561985/mongo-ab/pkg/changing"
+)
+
+// Generators of transactions
+const (
+	// Fuzz fills random fields, balance changes by operation amount
+	Fuzz = "fuzz"
+	// Requests builds valid changing.ChangeRequest which goes through Make
+	Requests = "requests"
+)
+
+// Generator makes transaction of operation for account
+type Generator interface {
+	Make(account uint64, op Op) changing.Transaction
+}
+
+// NewGenerator returns constructor of generator for thread of threads by name, r must not be shared between threads.
+// Dates of generator which sets them start from start, e.g. of run.
+func NewGenerator(name string, start time.Time) (func(r *rand.Rand, thread, threads int) Generator, error) {
+	switch name {
+	case Fuzz, "":
+		return func(r *rand.Rand, _, _ int) Generator { return NewTransactions(r) }, nil
+	case Requests:
+		return func(r *rand.Rand, thread, threads int) Generator {
+			return NewChangeRequests(r, thread, threads, start)
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported generator %q, use %s or %s", name, Fuzz, Requests)
+	}
+}
+
+// Make is Next of operation amount with fields described by workload file
+func (t *Transactions) Make(account uint64, op Op) changing.Transaction {
+	tx := t.Next(account, op.Amount)
+	op.Apply(&tx)
+
+	return tx
+}
+
+const (
+	casino = "casino"
+	sport  = "sport"
+)
+
+// share of every request type, bets dominate like in production
+var requestMix = []struct {
+	typ    changing.TransactionType
+	weight float64
+}{
+	{changing.Deposit, 20},
+	{changing.Bet, 55},
+	{changing.Withdraw, 10},
+	{changing.LotteryWin, 10},
+	{changing.FreebetWin, 5},
+}
+
+// ChangeRequests generates changing.ChangeRequest of thread of threads. Accounts are split between threads,
+// thread owns accounts whose id modulo threads is thread and keeps their state with New and Mix rules,
+// so bets and withdrawals fit balance, request which the rules reject becomes a deposit.
+type ChangeRequests struct {
+	r     *rand.Rand
+	total float64
+	now   time.Time
+
+	thread, threads uint64
+	accounts        map[uint64]*transaction.Transaction
+}
+
+// NewChangeRequests with dates going from start, so recent journal of run has them
+func NewChangeRequests(r *rand.Rand, thread, threads int, start time.Time) *ChangeRequests {
+	if threads < 1 {
+		threads = 1
+	}
+
+	g := &ChangeRequests{r: r, now: start, thread: uint64(thread % threads), threads: uint64(threads),
+		accounts: make(map[uint64]*transaction.Transaction)}
+	for _, m := range requestMix {
+		g.total += m.weight
+	}
+
+	return g
+}
+
+// Make applies Next request to thread's view of account and returns its transaction.
+// Project of operation is kept, its amount and types are replaced by request rules.
+// Date goes forward from start by random steps, so the same seed and start give the same transactions.
+func (g *ChangeRequests) Make(id uint64, op Op) changing.Transaction {
+	project := casino
+	if op.Operation != nil && op.Project != "" {
+		project = op.Project
+	}
+
+	tx := g.Next(id, project).Make()
+
+	g.now = g.now.Add(time.Millisecond + time.Duration(g.r.Int63n(int64(time.Second))))
+	tx.Date = g.now
+
+	return tx
+}
+
+// Next returns request which rules of changing accept for account of thread nearest to id
+func (g *ChangeRequests) Next(id uint64, project string) changing.ChangeRequest {
+	id = g.own(id)
+	state := g.accounts[id]
+
+	req := g.request(id, project, state)
+
+	next := g.apply(req, state)
+	if next.Status != "success" {
+		req = g.deposit(id, project)
+		next = g.apply(req, state)
+	}
+
+	g.accounts[id] = next
+
+	return req
+}
+
+// own returns account of thread which is nearest to id and not above it, unless id is below threads
+func (g *ChangeRequests) own(id uint64) uint64 {
+	own := id - id%g.threads + g.thread
+	if own > id && id >= g.threads {
+		own -= g.threads
+	}
+
+	return own
+}
+
+func (g *ChangeRequests) apply(req changing.ChangeRequest, state *transaction.Transaction) *transaction.Transaction {
+	switch {
+	case state == nil:
+		return req.New()
+	case req.Project == sport:
+		s := changing.SportChanging{ChangeRequest: req}
+		return s.Mix(state)
+	default:
+		return req.Mix(state)
+	}
+}
+
+func (g *ChangeRequests) request(id uint64, project string, state *transaction.Transaction) changing.ChangeRequest {
+	var balance float64
+	if state != nil {
+		balance = state.Balance
+	}
+
+	p := g.r.Float64() * g.total
+
+	typ := requestMix[len(requestMix)-1].typ
+	for _, m := range requestMix {
+		if p < m.weight {
+			typ = m.typ
+			break
+		}
+
+		p -= m.weight
+	}
+
+	req := g.base(id, project, typ)
+
+	switch typ {
+	case changing.Deposit:
+		return g.deposit(id, project)
+	case changing.Bet:
+		// stake is part of balance, every bet earns pincoins
+		req.Bet = money(balance * (0.01 + g.r.Float64()*0.24))
+		req.Change = -req.Bet
+		req.PincoinChange = money(req.Bet / 100)
+		req.TransactionType = "bet"
+	case changing.Withdraw:
+		req.Change = -money(balance * (0.1 + g.r.Float64()*0.4))
+		req.TransactionType = "withdraw"
+	case changing.LotteryWin:
+		req.Change = money(1 + g.r.ExpFloat64()*20)
+		req.TransactionType = "lottery_win"
+	case changing.FreebetWin:
+		req.Project = sport
+		req.Change = money(1 + g.r.Float64()*49)
+		req.TransactionType = "freebet_win"
+	}
+
+	// nothing to stake or withdraw
+	if req.Change == 0 {
+		return g.deposit(id, project)
+	}
+
+	return req
+}
+
+func (g *ChangeRequests) deposit(id uint64, project string) changing.ChangeRequest {
+	req := g.base(id, project, changing.Deposit)
+	req.Change = money(10 + g.r.ExpFloat64()*100)
+	req.PincoinChange = money(req.Change / 100)
+	req.TransactionType = "deposit"
+
+	return req
+}
+
+func (g *ChangeRequests) base(id uint64, project string, typ changing.TransactionType) changing.ChangeRequest {
+	req := changing.ChangeRequest{
+		AccountID:     id,
+		Currency:      123,
+		Type:          typ,
+		Project:       project,
+		TransactionID: uint64(g.r.Int63()),
+	}
+
+	// Make takes BsonID as id of transaction
+	_, _ = g.r.Read(req.BsonID[:])
+
+	return req
+}
+
+// money keeps cents
+func money(v float64) float64 {
+	return math.Round(v*100) / 100
+}
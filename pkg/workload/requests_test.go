@@ -0,0 +1,120 @@
+package workload
+
+import (
+	"testing"
+	"time"
+
+	"github.com/d7561985/mongo-ab/pkg/agregate/transaction"
+	"github.com/d7561985/mongo-ab/pkg/changing"
+	"github.com/d7561985/mongo-ab/pkg/keys"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChangeRequests(t *testing.T) {
+	g := NewChangeRequests(Rand(42, 0), 0, 1, time.Now())
+
+	state := map[uint64]*transaction.Transaction{}
+	types := map[changing.TransactionType]int{}
+
+	for i := 0; i < 10_000; i++ {
+		id := uint64(i % 10)
+		req := g.Next(id, casino)
+		types[req.Type]++
+
+		prev := state[id]
+
+		var next *transaction.Transaction
+		switch {
+		case prev == nil:
+			next = req.New()
+		case req.Type == changing.FreebetWin:
+			assert.Equal(t, sport, req.Project)
+			next = (&changing.SportChanging{ChangeRequest: req}).Mix(prev)
+		default:
+			next = req.Mix(prev)
+		}
+
+		require.Equal(t, "success", next.Status, "%+v", req)
+		assert.True(t, next.Balance >= 0, next.Balance)
+		assert.NotZero(t, req.Change)
+
+		if req.Type == changing.Bet {
+			assert.True(t, req.Bet <= prev.Balance)
+			assert.Equal(t, -req.Bet, req.Change)
+		}
+
+		state[id] = next
+	}
+
+	for _, m := range requestMix {
+		assert.NotZero(t, types[m.typ], m.typ)
+	}
+
+	assert.True(t, types[changing.Bet] > types[changing.Deposit])
+}
+
+func TestChangeRequestsMake(t *testing.T) {
+	start := time.Now()
+	a, b := NewChangeRequests(Rand(1, 2), 2, 4, start), NewChangeRequests(Rand(1, 2), 2, 4, start)
+
+	last := start
+	for i := 0; i < 100; i++ {
+		op := Op{Operation: &Operation{Project: "lottery"}}
+		x, y := a.Make(uint64(i%12), op), b.Make(uint64(i%12), op)
+
+		assert.Equal(t, x, y)
+		assert.False(t, x.ID.IsZero())
+		assert.True(t, x.Date.After(last))
+		last = x.Date
+
+		// thread 2 of 4 owns 2, 6, 10
+		assert.EqualValues(t, 2, x.AccountID%4)
+		assert.True(t, x.AccountID <= uint64(i%12) || x.AccountID == 2, x.AccountID)
+		assert.InDelta(t, x.Change, x.Balance, 0.01)
+
+		if x.Type != string(changing.FreebetWin) {
+			assert.Equal(t, "lottery", x.Project)
+		}
+
+		if x.Type == string(changing.Deposit) {
+			assert.EqualValues(t, 1, x.DepositCount)
+			assert.Equal(t, x.Change, x.DepositAllSum)
+		}
+	}
+}
+
+func TestChangeRequestsMix(t *testing.T) {
+	const threads, ops = 4, 250_000
+
+	users, err := keys.Parse(keys.Uniform, 100_000)
+	require.NoError(t, err)
+
+	types := map[changing.TransactionType]float64{}
+	for thread := 0; thread < threads; thread++ {
+		r := Rand(1, thread)
+		next, g := users.Generator(r, thread, threads), NewChangeRequests(r, thread, threads, time.Now())
+
+		for i := 0; i < ops; i++ {
+			types[g.Next(next.Next(), casino).Type]++
+		}
+	}
+
+	// the first request of every account is a deposit or a win, later ones follow the mix
+	for _, m := range requestMix {
+		assert.InDelta(t, m.weight/100, types[m.typ]/(threads*ops), 0.07, m.typ)
+	}
+}
+
+func TestNewGenerator(t *testing.T) {
+	for _, name := range []string{"", Fuzz, Requests} {
+		gen, err := NewGenerator(name, time.Now())
+		require.NoError(t, err)
+
+		tx := gen(Rand(1, 0), 0, 1).Make(7, Op{Operation: &Operation{Name: "tx"}, Amount: 100})
+		assert.EqualValues(t, 7, tx.AccountID)
+	}
+
+	_, err := NewGenerator("random", time.Now())
+	assert.Error(t, err)
+}
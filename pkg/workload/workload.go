@@ -0,0 +1,54 @@
+package workload
+
+import (
+	"math/rand"
+	"time"
+
+	"github.com/d7561985/mongo-ab/pkg/changing"
+	fuzz "github.com/google/gofuzz"
+)
+
+// Seed returns seed itself or random one for zero, so that every run could be reproduced by printed seed
+func Seed(seed int64) int64 {
+	for seed == 0 {
+		seed = rand.New(rand.NewSource(time.Now().UnixNano())).Int63()
+	}
+
+	return seed
+}
+
+// Rand returns source of thread's workload stream: the same seed and thread give the same sequence
+func Rand(seed int64, thread int) *rand.Rand {
+	return rand.New(rand.NewSource(seed + int64(thread)*1_000_003))
+}
+
+// Transactions generates changing.Transaction stream of single thread
+type Transactions struct {
+	r *rand.Rand
+	f *fuzz.Fuzzer
+}
+
+func NewTransactions(r *rand.Rand) *Transactions {
+	return &Transactions{r: r, f: fuzz.New().RandSource(r)}
+}
+
+// Next transaction of account, fields which are not set explicitly are fuzzed
+func (t *Transactions) Next(account uint64, add float64) changing.Transaction {
+	tx := changing.Transaction{}
+	t.f.Fuzz(&tx)
+
+	tx.Inc = changing.Inc{
+		Balance:        add,
+		DepositAllSum:  100,
+		DepositCount:   1,
+		PincoinBalance: 100,
+		PincoinsAllSum: 1,
+	}
+
+	tx.AccountID = account
+	tx.Currency = 123
+	tx.Change = add
+	tx.TransactionID = uint64(t.r.Int63())
+
+	return tx
+}
@@ -0,0 +1,24 @@
+package workload
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeterministic(t *testing.T) {
+	a, b := NewTransactions(Rand(42, 3)), NewTransactions(Rand(42, 3))
+	other := NewTransactions(Rand(42, 4))
+
+	for i := 0; i < 100; i++ {
+		x, y, z := a.Next(uint64(i), 100), b.Next(uint64(i), 100), other.Next(uint64(i), 100)
+
+		assert.Equal(t, x, y)
+		assert.NotEqual(t, x.TransactionID, z.TransactionID)
+	}
+}
+
+func TestSeed(t *testing.T) {
+	assert.EqualValues(t, 7, Seed(7))
+	assert.NotZero(t, Seed(0))
+}